@@ -50,3 +50,8 @@ func decrypt(ciphertext []byte) []byte {
 	}
 	return ciphertext
 }
+
+// encryptDatagram is encrypt for UDP, where the datagram itself says how long it is so there's no length header
+func encryptDatagram(plaintext string) []byte {
+	return encrypt(plaintext)[4:]
+}
@@ -0,0 +1,308 @@
+package kasalink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	lightingServiceModule = "smartlife.iot.smartbulb.lightingservice"
+	bulbEnergyMeterModule = "smartlife.iot.common.emeter"
+	getBulbRealtime       = `{"smartlife.iot.common.emeter":{"get_realtime":{}}}`
+)
+
+// The limits the lighting service takes. Color temperature is in kelvin, the range is the KL130's, bulbs with a
+// narrower one clamp it themselves.
+const (
+	MaxHue          = 360
+	MaxSaturation   = 100
+	MaxBrightness   = 100
+	MinColorTemp    = 2500
+	MaxColorTemp    = 9000
+	maxTransitionMS = 10 * 60 * 1000
+)
+
+// LightState is what a bulb is showing. While the bulb is off, the rest is what it'll come back on as.
+type LightState struct {
+	On   bool
+	Mode string
+	// Hue (0-360) and Saturation (0-100) only mean something while ColorTemp is 0
+	Hue        int
+	Saturation int
+	// ColorTemp is in kelvin, 0 when the bulb is showing a color
+	ColorTemp  int
+	Brightness int
+}
+
+// LightPreset is one of the bulb's preferred states, the presets the Kasa app shows
+type LightPreset struct {
+	Index      int `json:"index"`
+	Hue        int `json:"hue"`
+	Saturation int `json:"saturation"`
+	ColorTemp  int `json:"color_temp"`
+	Brightness int `json:"brightness"`
+}
+
+// PowerReading is what a bulb's energy meter says right now
+type PowerReading struct {
+	// Power is in milliwatts
+	Power int
+	// Total is in watt hours, since the meter's stats were last erased
+	Total int
+}
+
+// Bulb is a Kasa smart bulb (KL and LB series). It talks to the bulb with the same cipher KasaPowerPlug does, over
+// TCP or UDP.
+type Bulb struct {
+	kpp *KasaPowerPlug
+	// service is the module the light state lives in, and setMethod the method that changes it. Light strips have
+	// their own of both.
+	service   string
+	setMethod string
+}
+
+// NewBulb gives you a Bulb that's already gotten its system info. It talks TCP, see UseUDP for the alternative.
+func NewBulb(ctx context.Context, address string) (*Bulb, error) {
+	var kpp = &KasaPowerPlug{
+		plugNetworkLocation: address,
+		timeout:             5 * time.Second,
+	}
+	kpp.Unsafe.kpp = kpp
+	if _, err := kpp.fetchSystemInfo(ctx); err != nil {
+		kpp.closer()
+		return nil, err
+	}
+	return newBulb(kpp), nil
+}
+
+// newBulb takes over a KasaPowerPlug that's already talked to a bulb
+func newBulb(kpp *KasaPowerPlug) *Bulb {
+	return &Bulb{kpp: kpp, service: lightingServiceModule, setMethod: "transition_light_state"}
+}
+
+// UseUDP switches between talking to the bulb over UDP and over TCP. Over UDP every command gets repeated until the
+// bulb answers, which is harmless for everything a Bulb sends, and can get through to a bulb whose TCP is flaky. But
+// there's no ordering, and an answer too big for a datagram (a light strip's effects, say) never arrives, so TCP is
+// the default.
+func (b *Bulb) UseUDP(udp bool) {
+	if udp {
+		b.kpp.closer()
+		b.kpp.tplinkClient = nil
+	}
+	b.kpp.udp = udp
+}
+
+// SetLogger lets you give the Bulb a place to send logs
+func (b *Bulb) SetLogger(newLogger *log.Logger) {
+	b.kpp.SetLogger(newLogger)
+}
+
+// GetSystemInfo gives you the bulb's system info, the cached copy if there is one
+func (b *Bulb) GetSystemInfo() (*SystemInfo, error) {
+	return b.kpp.GetSystemInfo()
+}
+
+// Capabilities tells you what the bulb can do, going by its system info
+func (b *Bulb) Capabilities() (Capabilities, error) {
+	return b.kpp.Capabilities()
+}
+
+// Close hangs up on the bulb, if there's a connection open
+func (b *Bulb) Close() error {
+	return b.kpp.Close()
+}
+
+// LightState asks the bulb what it's showing
+func (b *Bulb) LightState(ctx context.Context) (*LightState, error) {
+	var service, err = b.lightingService(ctx, fmt.Sprintf(`{%q:{"get_light_state":{}}}`, b.service),
+		"get_light_state")
+	if err != nil {
+		return nil, err
+	}
+	return service.GetLightState.public(), nil
+}
+
+// TurnOn turns the bulb on, back to whatever it was showing, fading in over transition
+func (b *Bulb) TurnOn(ctx context.Context, transition time.Duration) (*LightState, error) {
+	return b.transition(ctx, map[string]interface{}{"on_off": 1}, transition)
+}
+
+// TurnOff turns the bulb off, fading out over transition
+func (b *Bulb) TurnOff(ctx context.Context, transition time.Duration) (*LightState, error) {
+	return b.transition(ctx, map[string]interface{}{"on_off": 0}, transition)
+}
+
+// SetBrightness turns the bulb on at brightness (1-100), without changing its color
+func (b *Bulb) SetBrightness(ctx context.Context, brightness int, transition time.Duration) (*LightState, error) {
+	if err := b.kpp.require("dimming", func(caps Capabilities) bool { return caps.Dimming }); err != nil {
+		return nil, err
+	}
+	if brightness < 1 || brightness > MaxBrightness {
+		return nil, fmt.Errorf("brightness has to be 1 to %d, not %d", MaxBrightness, brightness)
+	}
+	return b.transition(ctx, map[string]interface{}{"on_off": 1, "brightness": brightness}, transition)
+}
+
+// SetHSV turns the bulb on showing a color, hue 0-360, saturation 0-100 and brightness 1-100
+func (b *Bulb) SetHSV(ctx context.Context, hue, saturation, brightness int, transition time.Duration) (*LightState,
+	error) {
+	if err := b.kpp.require("color", func(caps Capabilities) bool { return caps.Color }); err != nil {
+		return nil, err
+	}
+	switch {
+	case hue < 0 || hue > MaxHue:
+		return nil, fmt.Errorf("hue has to be 0 to %d, not %d", MaxHue, hue)
+	case saturation < 0 || saturation > MaxSaturation:
+		return nil, fmt.Errorf("saturation has to be 0 to %d, not %d", MaxSaturation, saturation)
+	case brightness < 1 || brightness > MaxBrightness:
+		return nil, fmt.Errorf("brightness has to be 1 to %d, not %d", MaxBrightness, brightness)
+	}
+	// color_temp has to go to 0 or the bulb stays white
+	return b.transition(ctx, map[string]interface{}{"on_off": 1, "hue": hue, "saturation": saturation, "color_temp": 0,
+		"brightness": brightness}, transition)
+}
+
+// SetColorTemp turns the bulb on showing white at kelvin (MinColorTemp-MaxColorTemp)
+func (b *Bulb) SetColorTemp(ctx context.Context, kelvin int, transition time.Duration) (*LightState, error) {
+	var err = b.kpp.require("color temperature", func(caps Capabilities) bool { return caps.ColorTemp })
+	if err != nil {
+		return nil, err
+	}
+	if kelvin < MinColorTemp || kelvin > MaxColorTemp {
+		return nil, fmt.Errorf("color temperature has to be %d to %d kelvin, not %d", MinColorTemp, MaxColorTemp,
+			kelvin)
+	}
+	return b.transition(ctx, map[string]interface{}{"on_off": 1, "color_temp": kelvin}, transition)
+}
+
+// Presets gives you the bulb's preferred states, fresh from the bulb
+func (b *Bulb) Presets(ctx context.Context) ([]LightPreset, error) {
+	var sysInfo, err = b.kpp.fetchSystemInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return sysInfo.PreferredState, nil
+}
+
+// SavePreset overwrites the bulb's preferred state at preset.Index
+func (b *Bulb) SavePreset(ctx context.Context, preset LightPreset) error {
+	var args, err = json.Marshal(preset)
+	if err != nil {
+		return err
+	}
+	_, err = b.lightingService(ctx, fmt.Sprintf(`{%q:{"set_preferred_state":%s}}`, b.service, args),
+		"set_preferred_state")
+	return err
+}
+
+// ApplyPreset turns the bulb on showing preset
+func (b *Bulb) ApplyPreset(ctx context.Context, preset LightPreset, transition time.Duration) (*LightState, error) {
+	if preset.ColorTemp != 0 {
+		return b.transition(ctx, map[string]interface{}{"on_off": 1, "color_temp": preset.ColorTemp,
+			"brightness": preset.Brightness}, transition)
+	}
+	return b.transition(ctx, map[string]interface{}{"on_off": 1, "hue": preset.Hue, "saturation": preset.Saturation,
+		"color_temp": 0, "brightness": preset.Brightness}, transition)
+}
+
+// Realtime reads the bulb's energy meter
+func (b *Bulb) Realtime(ctx context.Context) (*PowerReading, error) {
+	var response, err = b.kpp.query(ctx, getBulbRealtime)
+	if err != nil {
+		return nil, err
+	}
+	if response.BulbEnergyMeter == nil {
+		return nil, errNoAnswer(bulbEnergyMeterModule, "get_realtime")
+	}
+	if response.BulbEnergyMeter.Realtime == nil {
+		return nil, response.BulbEnergyMeter.missing(bulbEnergyMeterModule, "get_realtime")
+	}
+	var rt = response.BulbEnergyMeter.Realtime
+	if err = rt.err(bulbEnergyMeterModule, "get_realtime"); err != nil {
+		return nil, err
+	}
+	return &PowerReading{Power: rt.Power, Total: rt.TotalWatts}, nil
+}
+
+// transition changes the light state with the given fields, and gives back the state the bulb ends up in
+func (b *Bulb) transition(ctx context.Context, fields map[string]interface{}, period time.Duration) (*LightState,
+	error) {
+	var ms = int(period / time.Millisecond)
+	if ms < 0 || ms > maxTransitionMS {
+		return nil, fmt.Errorf("transitions can take 0 to %s, not %s", time.Duration(maxTransitionMS)*time.Millisecond,
+			period)
+	}
+	fields["transition_period"] = ms
+	// without ignore_default, turning the bulb on brings back its default state instead of what we asked for
+	fields["ignore_default"] = 1
+	var args, err = json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	var service *lightingService
+	if service, err = b.lightingService(ctx, fmt.Sprintf(`{%q:{%q:%s}}`, b.service, b.setMethod, args),
+		b.setMethod); err != nil {
+		return nil, err
+	}
+	if service.SetLightState != nil {
+		return service.SetLightState.public(), nil
+	}
+	return service.TransitionLightState.public(), nil
+}
+
+// lightingService sends a single light state method and makes sure the bulb answered it without complaint
+func (b *Bulb) lightingService(ctx context.Context, cmd, method string) (*lightingService, error) {
+	var response, err = b.kpp.query(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+	var service = response.LightingService
+	if b.service == lightStripModule {
+		service = response.LightStrip
+	}
+	if service == nil {
+		return nil, errNoAnswer(b.service, method)
+	}
+	var answer *thingWithErrCode
+	switch method {
+	case "get_light_state":
+		if service.GetLightState != nil {
+			answer = &service.GetLightState.thingWithErrCode
+		}
+	case "transition_light_state":
+		if service.TransitionLightState != nil {
+			answer = &service.TransitionLightState.thingWithErrCode
+		}
+	case "set_light_state":
+		if service.SetLightState != nil {
+			answer = &service.SetLightState.thingWithErrCode
+		}
+	case "set_preferred_state":
+		answer = service.SetPreferredState
+	}
+	if answer == nil {
+		return nil, service.missing(b.service, method)
+	}
+	if err = answer.err(b.service, method); err != nil {
+		return nil, err
+	}
+	return service, nil
+}
+
+// public turns the bulb's idea of a light state into a LightState
+func (ls *lightState) public() *LightState {
+	var state = &LightState{On: ls.OnOff == 1, Mode: ls.Mode}
+	var shown = ls
+	if ls.OnOff == 0 && ls.DftOnState != nil {
+		shown = ls.DftOnState
+	}
+	state.Hue, state.Saturation = shown.Hue, shown.Saturation
+	state.ColorTemp, state.Brightness = shown.ColorTemp, shown.Brightness
+	if state.Mode == "" {
+		state.Mode = shown.Mode
+	}
+	return state
+}
@@ -0,0 +1,96 @@
+package kasalink
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBulb(t *testing.T) {
+	var mb, err = NewMockBulb()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mb.Close()
+	var (
+		ctx    = context.Background()
+		device Device
+		state  *LightState
+	)
+	if device, err = NewDevice(ctx, mb.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	var b, ok = device.(*Bulb)
+	if !ok {
+		t.Fatalf("expected a *Bulb for a KL130, got %T", device)
+	}
+	defer b.Close()
+	if b.kpp.udp {
+		t.Fatal("a bulb should start out on TCP")
+	}
+	b.UseUDP(true)
+
+	if state, err = b.SetHSV(ctx, 240, 100, 20, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if !state.On || state.Hue != 240 || state.ColorTemp != 0 || state.Brightness != 20 {
+		t.Fatalf("unexpected state after SetHSV %+v", state)
+	}
+	if state, err = b.TurnOff(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	if state.On || state.Hue != 240 || state.Brightness != 20 {
+		t.Fatalf("expected the bulb off, remembering its color, got %+v", state)
+	}
+
+	b.UseUDP(false)
+	if state, err = b.SetColorTemp(ctx, 6500, 0); err != nil {
+		t.Fatal(err)
+	}
+	if state, err = b.LightState(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !state.On || state.ColorTemp != 6500 {
+		t.Fatalf("unexpected state after SetColorTemp %+v", state)
+	}
+	if _, err = b.SetColorTemp(ctx, 12000, 0); err == nil {
+		t.Fatal("expected 12000K to be refused")
+	}
+
+	var presets []LightPreset
+	if presets, err = b.Presets(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(presets) != 2 {
+		t.Fatalf("expected 2 presets, got %+v", presets)
+	}
+	if err = b.SavePreset(ctx, LightPreset{Index: 1, Hue: 200, Saturation: 80, Brightness: 5}); err != nil {
+		t.Fatal(err)
+	}
+	if presets, err = b.Presets(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if state, err = b.ApplyPreset(ctx, presets[1], time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if state.Hue != 200 || state.Brightness != 5 {
+		t.Fatalf("unexpected state after ApplyPreset %+v", state)
+	}
+
+	var reading *PowerReading
+	if reading, err = b.Realtime(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("bulb is drawing %dmW", reading.Power)
+}
+
+func TestBulb_notSupported(t *testing.T) {
+	var b = newBulb(&KasaPowerPlug{
+		plugNetworkLocation: "127.0.0.1:1",
+		SysInfo:             &SystemInfo{Model: "KL110(US)", MICType: "IOT.SMARTBULB", IsDimmable: 1},
+	})
+	if _, err := b.SetHSV(context.Background(), 0, 100, 100, 0); !errors.Is(err, ErrNotSupported) {
+		t.Fatalf("expected ErrNotSupported for color on a KL110, got %v", err)
+	}
+}
@@ -0,0 +1,286 @@
+package kasalink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	defaultCalibrationTolerance = 0.01
+	defaultCalibrationSamples   = 3
+	// the meter only updates about once a second, sampling faster just reads the same thing again
+	defaultCalibrationInterval = time.Second
+)
+
+// ErrCalibrationFailed means the meter still didn't agree with the reference after new gains were applied. The
+// outlet it happened on is put back on its original gains.
+var ErrCalibrationFailed = errors.New("energy meter calibration failed")
+
+// EMeterGains are the energy meter's calibration, what its raw voltage and current readings get scaled by
+type EMeterGains struct {
+	VGain int `json:"vgain"`
+	IGain int `json:"igain"`
+}
+
+// EMeterReading is what the energy meter says right now, in volts, amps and watts
+type EMeterReading struct {
+	Voltage float64
+	Current float64
+	Power   float64
+}
+
+// CalibrationReference is what a trusted meter reads on the same circuit and load, and how hard to try to match it
+type CalibrationReference struct {
+	// Voltage is in volts. Current is in amps, leave it 0 to only calibrate voltage.
+	Voltage float64
+	Current float64
+	// Tolerance is how far off (as a fraction, 0.01 is 1%) the meter can still be once it's calibrated, it defaults
+	// to 1%
+	Tolerance float64
+	// Samples readings are averaged each time the meter is read, SampleInterval apart. They default to 3 and a second.
+	Samples        int
+	SampleInterval time.Duration
+}
+
+// CalibrationResult is how calibrating one outlet went. Original is the backup to hand RestoreEMeterGains if you
+// change your mind.
+type CalibrationResult struct {
+	// Child is the outlet, or -1 for a device without children
+	Child    int
+	Original EMeterGains
+	Applied  EMeterGains
+	// Before and After are the averaged readings either side of the new gains
+	Before EMeterReading
+	After  EMeterReading
+	// VoltageError and CurrentError are how far After is from the reference, as a fraction
+	VoltageError float64
+	CurrentError float64
+}
+
+// EMeterGains asks the energy meter for its calibration, pass at most one child
+func (kpp *KasaPowerPlug) EMeterGains(ctx context.Context, children ...int) (EMeterGains, error) {
+	var module, err = kpp.emeter(ctx, getVandIGain, "get_vgain_igain", children...)
+	if err != nil {
+		return EMeterGains{}, err
+	}
+	return module.VGainIGain.EMeterGains, nil
+}
+
+// SetEMeterGains changes the energy meter's calibration. CalibrateEMeter works the gains out for you.
+func (kpp *KasaPowerPlug) SetEMeterGains(ctx context.Context, gains EMeterGains, children ...int) error {
+	if gains.VGain <= 0 || gains.IGain <= 0 {
+		return fmt.Errorf("gains have to be positive, not %+v", gains)
+	}
+	var _, err = kpp.emeter(ctx, fmt.Sprintf(setVandIGainFormatString, gains.VGain, gains.IGain), "set_vgain_igain",
+		children...)
+	return err
+}
+
+// EMeterReading reads the energy meter, pass at most one child
+func (kpp *KasaPowerPlug) EMeterReading(ctx context.Context, children ...int) (*EMeterReading, error) {
+	var module, err = kpp.emeter(ctx, getCurrentAndVoltage, "get_realtime", children...)
+	if err != nil {
+		return nil, err
+	}
+	var rt = module.Realtime
+	if kpp.quirks()&QuirkEmeterUnitsV1 != 0 {
+		rt.fromV1Units()
+	}
+	return &EMeterReading{
+		Voltage: float64(rt.Voltage) / 1000,
+		Current: float64(rt.Current) / 1000,
+		Power:   float64(rt.Power) / 1000,
+	}, nil
+}
+
+// CalibrateEMeter brings each child's energy meter in line with a reference meter, every outlet if you don't name any
+// (or the device's own meter, if it has no outlets): it backs up the gains, scales them by how far off the meter
+// reads, applies them and reads the meter again to make sure. Keep the reference load running on each outlet the
+// whole time. If an outlet still doesn't agree within the tolerance, it gets its original gains back and you get
+// ErrCalibrationFailed, along with the results so far (outlets that did calibrate keep their new gains).
+func (kpp *KasaPowerPlug) CalibrateEMeter(ctx context.Context, ref CalibrationReference,
+	children ...int) ([]CalibrationResult, error) {
+	if err := kpp.requireEnergyMeter(); err != nil {
+		return nil, err
+	}
+	if ref.Voltage <= 0 || ref.Current < 0 {
+		return nil, fmt.Errorf("a reference of %vV %vA can't be right", ref.Voltage, ref.Current)
+	}
+	if ref.Tolerance <= 0 {
+		ref.Tolerance = defaultCalibrationTolerance
+	}
+	if ref.Samples <= 0 {
+		ref.Samples = defaultCalibrationSamples
+	}
+	if ref.SampleInterval <= 0 {
+		ref.SampleInterval = defaultCalibrationInterval
+	}
+	if len(children) == 0 {
+		var sysInfo = kpp.SysInfo
+		if sysInfo == nil {
+			var err error
+			if sysInfo, err = kpp.fetchSystemInfo(ctx); err != nil {
+				return nil, err
+			}
+		}
+		// a strip's meters are per outlet, it doesn't have one of its own
+		children = []int{-1}
+		if count := CapabilitiesOf(sysInfo).Children; count > 0 {
+			children = make([]int, count)
+			for i := range children {
+				children[i] = i
+			}
+		}
+	}
+	var results = make([]CalibrationResult, 0, len(children))
+	for _, child := range children {
+		var result, err = kpp.calibrateChild(ctx, ref, child)
+		if result != nil {
+			results = append(results, *result)
+		}
+		if err != nil {
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+// RestoreEMeterGains puts every outlet in results back on its Original gains
+func (kpp *KasaPowerPlug) RestoreEMeterGains(ctx context.Context, results []CalibrationResult) error {
+	for _, result := range results {
+		if err := kpp.SetEMeterGains(ctx, result.Original, childArgs(result.Child)...); err != nil {
+			return fmt.Errorf("restoring outlet %d: %w", result.Child, err)
+		}
+	}
+	return nil
+}
+
+// calibrateChild calibrates a single outlet, see CalibrateEMeter. The result is nil if nothing was changed.
+func (kpp *KasaPowerPlug) calibrateChild(ctx context.Context, ref CalibrationReference,
+	child int) (*CalibrationResult, error) {
+	var (
+		result = &CalibrationResult{Child: child}
+		err    error
+	)
+	if result.Original, err = kpp.EMeterGains(ctx, childArgs(child)...); err != nil {
+		return nil, err
+	}
+	if result.Before, err = kpp.averageReading(ctx, ref, child); err != nil {
+		return nil, err
+	}
+	if result.Before.Voltage <= 0 || (ref.Current > 0 && result.Before.Current <= 0) {
+		return nil, fmt.Errorf("outlet %d reads %vV %vA, is the reference load plugged in and on?", child,
+			result.Before.Voltage, result.Before.Current)
+	}
+	// the readings are the raw values times the gains, so the gains scale straight with how far off they are
+	result.Applied = EMeterGains{
+		VGain: int(math.Round(float64(result.Original.VGain) * ref.Voltage / result.Before.Voltage)),
+		IGain: result.Original.IGain,
+	}
+	if ref.Current > 0 {
+		result.Applied.IGain = int(math.Round(float64(result.Original.IGain) * ref.Current / result.Before.Current))
+	}
+	if err = kpp.SetEMeterGains(ctx, result.Applied, childArgs(child)...); err != nil {
+		return nil, err
+	}
+	if result.After, err = kpp.averageReading(ctx, ref, child); err != nil {
+		return result, kpp.restoreAfter(ctx, result, err)
+	}
+	result.VoltageError = math.Abs(result.After.Voltage-ref.Voltage) / ref.Voltage
+	if ref.Current > 0 {
+		result.CurrentError = math.Abs(result.After.Current-ref.Current) / ref.Current
+	}
+	if result.VoltageError > ref.Tolerance || result.CurrentError > ref.Tolerance {
+		return result, kpp.restoreAfter(ctx, result, fmt.Errorf("%w: outlet %d is %.1f%% off on voltage and %.1f%% "+
+			"off on current", ErrCalibrationFailed, child, result.VoltageError*100, result.CurrentError*100))
+	}
+	return result, nil
+}
+
+// restoreAfter puts result's outlet back on its original gains after cause went wrong, and gives back cause
+func (kpp *KasaPowerPlug) restoreAfter(ctx context.Context, result *CalibrationResult, cause error) error {
+	if err := kpp.SetEMeterGains(ctx, result.Original, childArgs(result.Child)...); err != nil {
+		return fmt.Errorf("%v, and restoring the original gains %+v failed too: %w", cause, result.Original, err)
+	}
+	return cause
+}
+
+// averageReading reads the meter ref.Samples times and averages them
+func (kpp *KasaPowerPlug) averageReading(ctx context.Context, ref CalibrationReference,
+	child int) (EMeterReading, error) {
+	var sum EMeterReading
+	for i := 0; i < ref.Samples; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return EMeterReading{}, ctx.Err()
+			case <-time.After(ref.SampleInterval):
+			}
+		}
+		var reading, err = kpp.EMeterReading(ctx, childArgs(child)...)
+		if err != nil {
+			return EMeterReading{}, err
+		}
+		sum.Voltage += reading.Voltage
+		sum.Current += reading.Current
+		sum.Power += reading.Power
+	}
+	var n = float64(ref.Samples)
+	return EMeterReading{Voltage: sum.Voltage / n, Current: sum.Current / n, Power: sum.Power / n}, nil
+}
+
+// childArgs turns a child index, or -1 for none, into the children argument everything else takes
+func childArgs(child int) []int {
+	if child < 0 {
+		return nil
+	}
+	return []int{child}
+}
+
+// emeter sends a single emeter method and makes sure the device answered it without complaint
+func (kpp *KasaPowerPlug) emeter(ctx context.Context, cmd, method string, children ...int) (*energyMeter, error) {
+	if err := kpp.requireEnergyMeter(); err != nil {
+		return nil, err
+	}
+	if len(children) > 1 {
+		return nil, fmt.Errorf("%s is one outlet at a time, not %v", method, children)
+	}
+	var response, err = kpp.query(ctx, cmd, children...)
+	if err != nil {
+		return nil, err
+	}
+	if response.EnergyMeter == nil {
+		return nil, errNoAnswer("emeter", method)
+	}
+	var answer *thingWithErrCode
+	switch method {
+	case "get_realtime":
+		if response.EnergyMeter.Realtime != nil {
+			answer = &response.EnergyMeter.Realtime.thingWithErrCode
+		}
+	case "get_vgain_igain":
+		if response.EnergyMeter.VGainIGain != nil {
+			answer = &response.EnergyMeter.VGainIGain.thingWithErrCode
+		}
+	case "set_vgain_igain":
+		answer = response.EnergyMeter.SetVGainIGain
+	case "get_daystat":
+		if response.EnergyMeter.DayStat != nil {
+			answer = &response.EnergyMeter.DayStat.thingWithErrCode
+		}
+	case "get_monthstat":
+		if response.EnergyMeter.MonthStat != nil {
+			answer = &response.EnergyMeter.MonthStat.thingWithErrCode
+		}
+	}
+	if answer == nil {
+		return nil, response.EnergyMeter.missing("emeter", method)
+	}
+	if err = answer.err("emeter", method); err != nil {
+		return nil, err
+	}
+	return response.EnergyMeter, nil
+}
@@ -0,0 +1,130 @@
+package kasalink
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCalibrateEMeter(t *testing.T) {
+	if !useMock {
+		t.Skip("not recalibrating a real device")
+	}
+	var (
+		kpp *KasaPowerPlug
+		ctx = context.Background()
+		ref = CalibrationReference{Voltage: 117.6, Current: 1.25, SampleInterval: time.Millisecond}
+	)
+	mockOrNot(&kpp, t)
+	defer kpp.Close()
+	var results, err = kpp.CalibrateEMeter(ctx, ref, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("got %d results for 2 outlets", len(results))
+	}
+	for _, result := range results {
+		t.Logf("Outlet %d: %+v -> %+v, now %.2f%% and %.2f%% off", result.Child, result.Before, result.After,
+			result.VoltageError*100, result.CurrentError*100)
+		if result.Original != mockEMeterDefault {
+			t.Errorf("outlet %d backed up %+v, not %+v", result.Child, result.Original, mockEMeterDefault)
+		}
+		if d := result.Applied.VGain - mockEMeterGains.VGain; d < -5 || d > 5 {
+			t.Errorf("outlet %d got vgain %d, want about %d", result.Child, result.Applied.VGain,
+				mockEMeterGains.VGain)
+		}
+		if d := result.Applied.IGain - mockEMeterGains.IGain; d < -15 || d > 15 {
+			t.Errorf("outlet %d got igain %d, want about %d", result.Child, result.Applied.IGain,
+				mockEMeterGains.IGain)
+		}
+	}
+	var gains EMeterGains
+	if gains, err = kpp.EMeterGains(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	if gains != mockEMeterDefault {
+		t.Errorf("outlet 2 wasn't calibrated, but has %+v", gains)
+	}
+	if err = kpp.RestoreEMeterGains(ctx, results); err != nil {
+		t.Fatal(err)
+	}
+	if gains, err = kpp.EMeterGains(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	if gains != mockEMeterDefault {
+		t.Errorf("outlet 0 restored to %+v, not %+v", gains, mockEMeterDefault)
+	}
+}
+
+func TestCalibrateEMeterFails(t *testing.T) {
+	if !useMock {
+		t.Skip("not recalibrating a real device")
+	}
+	var (
+		kpp *KasaPowerPlug
+		ctx = context.Background()
+	)
+	mockOrNot(&kpp, t)
+	defer kpp.Close()
+	// the meter only reads to the milliamp, so it can't get this close
+	var results, err = kpp.CalibrateEMeter(ctx, CalibrationReference{Voltage: 117.6, Current: 1.2504,
+		Tolerance: 1e-6, Samples: 1}, 3)
+	if !errors.Is(err, ErrCalibrationFailed) {
+		t.Fatalf("got %v", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("got %d results", len(results))
+	}
+	var gains EMeterGains
+	if gains, err = kpp.EMeterGains(ctx, 3); err != nil {
+		t.Fatal(err)
+	}
+	if gains != mockEMeterDefault {
+		t.Errorf("outlet 3 was left on %+v, not put back on %+v", gains, mockEMeterDefault)
+	}
+	if _, err = kpp.CalibrateEMeter(ctx, CalibrationReference{Voltage: -120}); err == nil {
+		t.Error("calibrated to a negative voltage")
+	}
+}
+
+func TestCalibrateEMeterEveryOutlet(t *testing.T) {
+	var s, err = NewSimulator(SimulatorConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	for child := 0; child < s.Outlets(); child++ {
+		// 1A at the Simulator's 120V
+		if err = s.SetLoad(child, ConstantLoad(120)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var device Device
+	if device, err = NewDevice(ctx, s.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	defer device.Close()
+	var kpp = device.(*KasaPowerPlug)
+	if _, err = kpp.TurnDeviceOn(0, 1, 2, 3, 4, 5); err != nil {
+		t.Fatal(err)
+	}
+	// an HS300 has no meter of its own, so with no outlets named every one of them gets calibrated
+	var results []CalibrationResult
+	results, err = kpp.CalibrateEMeter(ctx, CalibrationReference{Voltage: 118, Current: 1.02,
+		SampleInterval: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 6 {
+		t.Fatalf("got %d results for an HS300", len(results))
+	}
+	for i, result := range results {
+		if result.Child != i || result.Applied == result.Original {
+			t.Errorf("outlet %d: %+v", i, result)
+		}
+	}
+}
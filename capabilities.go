@@ -0,0 +1,122 @@
+package kasalink
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNotSupported means the device doesn't do what you asked of it, so the command was never sent
+var ErrNotSupported = errors.New("not supported by this device")
+
+// Capabilities is what a device can do, as far as its system info says
+type Capabilities struct {
+	// EnergyMeter is the emeter module, realtime readings, gains, and usage stats
+	EnergyMeter bool
+	// Timer is the count_down module
+	Timer bool
+	// Dimming is brightness control, a dimmer switch or a dimmable bulb
+	Dimming bool
+	// Color is hue and saturation control, on color bulbs and light strips
+	Color bool
+	// ColorTemp is white color temperature control, on the bulbs that have it
+	ColorTemp bool
+	// Motion is a PIR motion sensor, like on the ES20M and KS200M
+	Motion bool
+	// Children is how many outlets the device has that can be addressed on their own, 0 for single outlet devices
+	Children int
+}
+
+// CapabilitiesOf works out what a device can do from its system info. Plugs and switches list what they do in
+// feature ("TIM:ENE" is timers and an energy meter), bulbs and strips say it with is_dimmable and is_color instead.
+// Nothing in feature says dimmer, so dimmer switches come from the model registry, or dev_name for models not in it.
+func CapabilitiesOf(sysInfo *SystemInfo) Capabilities {
+	var (
+		caps     = Capabilities{Children: sysInfo.ChildNum}
+		features = strings.Split(sysInfo.Feature, ":")
+		micType  = sysInfo.MICType
+	)
+	if micType == "" {
+		// older plug firmware calls it type instead
+		micType = sysInfo.Type
+	}
+	for _, feature := range features {
+		switch feature {
+		case "TIM":
+			caps.Timer = true
+		case "ENE":
+			caps.EnergyMeter = true
+		}
+	}
+	var m, known = ModelOf(sysInfo)
+	switch {
+	case micType == "IOT.SMARTBULB":
+		// every Kasa bulb and strip meters itself, it just doesn't say so
+		caps.EnergyMeter = true
+		caps.Dimming = sysInfo.IsDimmable == 1
+		caps.Color = sysInfo.IsColor == 1
+		caps.ColorTemp = sysInfo.IsVariableTemp == 1
+	case known:
+		caps.Dimming = m.Dimmable
+	default:
+		// a dimmer switch we don't have in the registry still calls itself one, like "Smart Wi-Fi Dimmer"
+		caps.Dimming = strings.Contains(strings.ToLower(sysInfo.DevName), "dimmer")
+	}
+	if caps.Children == 0 {
+		caps.Children = len(sysInfo.Children)
+	}
+	if known {
+		// some firmware leaves ENE out of feature on models that do have a meter
+		caps.EnergyMeter = caps.EnergyMeter || m.EnergyMeter
+		// nothing in a motion switch's system info gives its sensors away
+		caps.Motion = m.Kind == KindMotionSwitch
+	}
+	return caps
+}
+
+// Capabilities tells you what the device can do, going by its system info (asking for it if need be)
+func (kpp *KasaPowerPlug) Capabilities() (Capabilities, error) {
+	var sysInfo, err = kpp.GetSystemInfo()
+	if err != nil {
+		return Capabilities{}, err
+	}
+	return CapabilitiesOf(sysInfo), nil
+}
+
+// require checks the device can do something before a command goes out for it. If we don't have the device's system
+// info there's nothing to go on, so the command goes out anyway and the device gets to say no itself.
+func (kpp *KasaPowerPlug) require(what string, has func(Capabilities) bool) error {
+	if kpp.SysInfo == nil {
+		return nil
+	}
+	if !has(CapabilitiesOf(kpp.SysInfo)) {
+		return fmt.Errorf("%w: %s has no %s", ErrNotSupported, kpp.SysInfo.Model, what)
+	}
+	return nil
+}
+
+func (kpp *KasaPowerPlug) requireEnergyMeter() error {
+	return kpp.require("energy meter", func(caps Capabilities) bool { return caps.EnergyMeter })
+}
+
+func (kpp *KasaPowerPlug) requireTimer() error {
+	return kpp.require("countdown timer", func(caps Capabilities) bool { return caps.Timer })
+}
+
+// requireChildren makes sure every child is an outlet the device actually has
+func (kpp *KasaPowerPlug) requireChildren(children []int) error {
+	if kpp.SysInfo == nil {
+		return nil
+	}
+	var count = CapabilitiesOf(kpp.SysInfo).Children
+	for _, child := range children {
+		if child < 0 || child >= count {
+			if count == 0 {
+				return fmt.Errorf("%w: %s has no child outlets", ErrNotSupported, kpp.SysInfo.Model)
+			}
+			return fmt.Errorf("%w: %s has outlets 0 to %d, not %d", ErrNotSupported, kpp.SysInfo.Model, count-1,
+				child)
+		}
+	}
+	return nil
+}
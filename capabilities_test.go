@@ -0,0 +1,62 @@
+package kasalink
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCapabilitiesOf(t *testing.T) {
+	var tests = []struct {
+		name    string
+		sysInfo SystemInfo
+		want    Capabilities
+	}{
+		{"HS100", SystemInfo{Model: "HS100(US)", MICType: "IOT.SMARTPLUGSWITCH", Feature: "TIM"},
+			Capabilities{Timer: true}},
+		{"HS110 old firmware", SystemInfo{Model: "HS110(EU)", Type: "IOT.SMARTPLUGSWITCH", Feature: "TIM:ENE"},
+			Capabilities{Timer: true, EnergyMeter: true}},
+		{"HS300", SystemInfo{Model: "HS300(US)", MICType: "IOT.SMARTPLUGSWITCH", Feature: "TIM:ENE", ChildNum: 6},
+			Capabilities{Timer: true, EnergyMeter: true, Children: 6}},
+		{"HS220", SystemInfo{Model: "HS220(US)", MICType: "IOT.SMARTPLUGSWITCH", Feature: "TIM", Brightness: 50},
+			Capabilities{Timer: true, Dimming: true}},
+		{"HS220 without brightness", SystemInfo{Model: "HS220(US)", MICType: "IOT.SMARTPLUGSWITCH", Feature: "TIM"},
+			Capabilities{Timer: true, Dimming: true}},
+		{"KS230", SystemInfo{Model: "KS230(US)", MICType: "IOT.SMARTPLUGSWITCH", Feature: "TIM",
+			DevName: "Smart Wi-Fi 3-Way Dimmer Switch"}, Capabilities{Timer: true, Dimming: true}},
+		{"plug with a brightness", SystemInfo{Model: "HS200(US)", MICType: "IOT.SMARTPLUGSWITCH", Feature: "TIM",
+			Brightness: 100}, Capabilities{Timer: true}},
+		{"KS200M", SystemInfo{Model: "KS200M(US)", MICType: "IOT.SMARTPLUGSWITCH", Feature: "TIM"},
+			Capabilities{Timer: true, Motion: true}},
+		{"ES20M", SystemInfo{Model: "ES20M(US)", MICType: "IOT.SMARTPLUGSWITCH", Feature: "TIM", Brightness: 50},
+			Capabilities{Timer: true, Dimming: true, Motion: true}},
+		{"KL130", SystemInfo{Model: "KL130(US)", MICType: "IOT.SMARTBULB", IsDimmable: 1, IsColor: 1,
+			IsVariableTemp: 1}, Capabilities{EnergyMeter: true, Dimming: true, Color: true, ColorTemp: true}},
+	}
+	for _, tt := range tests {
+		var sysInfo = tt.sysInfo
+		if got := CapabilitiesOf(&sysInfo); got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestKasaPowerPlug_ErrNotSupported(t *testing.T) {
+	// nothing listens at this address, so anything that makes it onto the wire fails some other way
+	var kpp = &KasaPowerPlug{
+		plugNetworkLocation: "127.0.0.1:1",
+		SysInfo:             &SystemInfo{Model: "HS100(US)", MICType: "IOT.SMARTPLUGSWITCH", Feature: "TIM"},
+	}
+	if _, err := kpp.GetRealtimeCurrentAndVoltage(); !errors.Is(err, ErrNotSupported) {
+		t.Fatalf("expected ErrNotSupported for the energy meter, got %v", err)
+	}
+	if _, err := kpp.EraseEMeterStats(); !errors.Is(err, ErrNotSupported) {
+		t.Fatalf("expected ErrNotSupported for the energy meter, got %v", err)
+	}
+	if _, err := kpp.TurnDeviceOn(1); !errors.Is(err, ErrNotSupported) {
+		t.Fatalf("expected ErrNotSupported for a child outlet, got %v", err)
+	}
+	kpp.SysInfo.Feature = ""
+	if _, err := kpp.GetCountdownRule(); !errors.Is(err, ErrNotSupported) {
+		t.Fatalf("expected ErrNotSupported for the timer, got %v", err)
+	}
+}
@@ -12,7 +12,6 @@ var (
 func init() {
 	flag.StringVar(&uid, "tpLinkUser", "", "User ID to test TPLink functionality")
 	flag.StringVar(&pass, "tpLinkPass", "", "Password for the TPLink User")
-	flag.Parse()
 }
 
 func TestGetCloudToken(t *testing.T) {
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/PaulSRock/kasalink"
+)
+
+// harden handles "kasaset harden", which cuts a list of devices off from the TP-Link cloud, and keeps what they had
+// before in a state file so "kasaset restore" can put it back
+func harden(args []string) {
+	var (
+		fs      = flag.NewFlagSet("harden", flag.ExitOnError)
+		hosts   = fs.String("hosts", "", "Comma separated list of devices to harden")
+		server  = fs.String("server", kasalink.NoCloudServer, "Cloud server to point the devices at")
+		state   = fs.String("state", "kasa-harden.json", "File to keep the original cloud settings in")
+		timeout = fs.Duration("timeout", 10*time.Second, "How long each device gets")
+		failed  bool
+	)
+	_ = fs.Parse(args)
+	var results = loadState(*state)
+	for _, host := range splitHosts(*hosts) {
+		var ctx, cancel = context.WithTimeout(context.Background(), *timeout)
+		var result, err = hardenOne(ctx, host, *server)
+		cancel()
+		if result != nil {
+			if previous, ok := results[result.DeviceID]; ok {
+				// hardening twice would otherwise lose the real originals
+				result.Original = previous.Original
+			}
+			results[result.DeviceID] = *result
+		}
+		if err != nil {
+			failed = true
+			fmt.Printf("%s: %s\n", host, err)
+			continue
+		}
+		fmt.Printf("%s: %s (%s) bound: %t, server: %s, connected: %t\n", host, result.Alias, result.DeviceID,
+			result.Final.Binded, result.Final.Server, result.Final.CloudConnected)
+	}
+	saveState(*state, results)
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func hardenOne(ctx context.Context, host, server string) (*kasalink.HardenResult, error) {
+	var plug, err = kasalink.NewKasaPowerPlug(host)
+	if err != nil {
+		return nil, err
+	}
+	defer plug.Close()
+	return plug.HardenTo(ctx, server)
+}
+
+// restore handles "kasaset restore", which puts devices back on the cloud servers recorded by "kasaset harden". Devices
+// that were put back are dropped from the state file, and the file goes once they all have been
+func restore(args []string) {
+	var (
+		fs      = flag.NewFlagSet("restore", flag.ExitOnError)
+		state   = fs.String("state", "kasa-harden.json", "File the original cloud settings were kept in")
+		timeout = fs.Duration("timeout", 10*time.Second, "How long each device gets")
+		failed  bool
+	)
+	_ = fs.Parse(args)
+	var results = loadState(*state)
+	for id, result := range results {
+		var ctx, cancel = context.WithTimeout(context.Background(), *timeout)
+		var err = restoreOne(ctx, result)
+		cancel()
+		if err != nil {
+			failed = true
+			fmt.Printf("%s: %s\n", result.Address, err)
+			continue
+		}
+		delete(results, id)
+		fmt.Printf("%s: %s (%s) back on %s", result.Address, result.Alias, result.DeviceID, result.Original.Server)
+		if result.Original.Binded {
+			fmt.Printf(", it was bound to %s, bind it again to get that back", result.Original.Username)
+		}
+		fmt.Println()
+	}
+	if len(results) > 0 {
+		// keep what's left so restore can be run again for the devices that didn't make it
+		saveState(*state, results)
+	} else if err := os.Remove(*state); err != nil && !os.IsNotExist(err) {
+		log.Fatal(err)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func restoreOne(ctx context.Context, result kasalink.HardenResult) error {
+	var plug, err = kasalink.NewKasaPowerPlug(result.Address)
+	if err != nil {
+		return err
+	}
+	defer plug.Close()
+	return plug.RestoreCloud(ctx, result.Original)
+}
+
+func loadState(file string) map[string]kasalink.HardenResult {
+	var results = map[string]kasalink.HardenResult{}
+	var b, err = ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return results
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err = json.Unmarshal(b, &results); err != nil {
+		log.Fatalf("reading %s: %s", file, err)
+	}
+	return results
+}
+
+func saveState(file string, results map[string]kasalink.HardenResult) {
+	var b, err = json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err = ioutil.WriteFile(file, b, 0600); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// splitHosts turns "10.0.0.4,10.0.0.5:9999" into addresses, adding the Kasa port where it's missing
+func splitHosts(hosts string) []string {
+	var addrs []string
+	for _, host := range strings.Split(hosts, ",") {
+		host = strings.TrimSpace(host)
+		if host == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(host); err != nil {
+			host = net.JoinHostPort(host, "9999")
+		}
+		addrs = append(addrs, host)
+	}
+	return addrs
+}
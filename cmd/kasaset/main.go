@@ -3,6 +3,7 @@ package main
 import (
 	"flag"
 	"log"
+	"os"
 
 	"github.com/PaulSRock/kasalink"
 )
@@ -12,6 +13,19 @@ var plugNumber = flag.Int("plug", 0, "Plug to switch")
 var on = flag.Bool("on", false, "Plug state")
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "provision":
+			provision(os.Args[2:])
+			return
+		case "harden":
+			harden(os.Args[2:])
+			return
+		case "restore":
+			restore(os.Args[2:])
+			return
+		}
+	}
 	flag.Parse()
 	plug, err := kasalink.NewKasaPowerPlug(*host)
 	if err != nil {
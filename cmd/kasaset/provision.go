@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/PaulSRock/kasalink"
+)
+
+var keyTypes = map[string]kasalink.KeyType{
+	"auto": kasalink.KeyTypeAuto,
+	"none": kasalink.KeyTypeNone,
+	"wep":  kasalink.KeyTypeWEP,
+	"wpa":  kasalink.KeyTypeWPA,
+	"wpa2": kasalink.KeyTypeWPA2,
+}
+
+// provision handles "kasaset provision", which sets up a factory fresh device without the Kasa app
+func provision(args []string) {
+	var (
+		fs          = flag.NewFlagSet("provision", flag.ExitOnError)
+		setup       = fs.String("setup", kasalink.DefaultSetupAddress, "Address of the device on its setup network")
+		alias       = fs.String("alias", "", "Name to give the device")
+		tz          = fs.String("tz", "", "IANA timezone for the device, like America/New_York")
+		lat         = fs.Float64("lat", 0, "Latitude of the device")
+		lon         = fs.Float64("lon", 0, "Longitude of the device")
+		cloudServer = fs.String("cloud-server", "", "Cloud server for the device to use instead of TP-Link's")
+		ssid        = fs.String("ssid", "", "Wi-Fi network for the device to join")
+		pass        = fs.String("pass", "", "Password for the Wi-Fi network")
+		keyType     = fs.String("key-type", "auto", "Wi-Fi security: auto, none, wep, wpa or wpa2")
+		discovery   = fs.String("discovery", kasalink.DefaultDiscoveryAddress, "Where to look for the device once it has joined")
+		timeout     = fs.Duration("timeout", 3*time.Minute, "How long to wait for the whole thing")
+	)
+	_ = fs.Parse(args)
+	var kt, ok = keyTypes[strings.ToLower(*keyType)]
+	if !ok {
+		log.Fatalf("unknown key type %q", *keyType)
+	}
+	var ctx, cancel = context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	var found, err = kasalink.Provision(ctx, kasalink.ProvisionConfig{
+		SetupAddress:     *setup,
+		Alias:            *alias,
+		Timezone:         *tz,
+		Location:         kasalink.Location{Lat: *lat, Lon: *lon},
+		CloudServer:      *cloudServer,
+		SSID:             *ssid,
+		Password:         *pass,
+		KeyType:          kt,
+		DiscoveryAddress: *discovery,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("%s (%s) is on the LAN at %s\n", found.SysInfo.Alias, found.SysInfo.DeviceID, found.Address)
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PaulSRock/kasalink"
+)
+
+// house is the running fleet, and the control API for it
+type house struct {
+	lock      sync.Mutex
+	devices   map[string]*device
+	order     []string
+	discovery *kasalink.DiscoveryResponder
+}
+
+// device is one simulated device in the house, and what it's been told to do
+type device struct {
+	Name    string           `json:"name"`
+	Profile string           `json:"profile"`
+	Address string           `json:"address"`
+	Outlets int              `json:"outlets"`
+	Loads   map[int]loadSpec `json:"loads,omitempty"`
+	Faults  *faultSpec       `json:"faults,omitempty"`
+	sim     *kasalink.Simulator
+}
+
+// startHouse starts every device in f, and discovery if f wants it. If any of them won't start, none of them do.
+func startHouse(f *fleet) (_ *house, err error) {
+	var h = &house{devices: map[string]*device{}}
+	defer func() {
+		if err != nil {
+			h.close()
+		}
+	}()
+	for n, spec := range f.Devices {
+		var profile *kasalink.SimulatorProfile
+		if profile, err = spec.profile(); err != nil {
+			return nil, fmt.Errorf("device %d: %w", n+1, err)
+		}
+		var addresses []string
+		if addresses, err = spec.addresses(); err != nil {
+			return nil, fmt.Errorf("device %d: %w", n+1, err)
+		}
+		var names = spec.names(profile.Name, func(name string) bool {
+			return h.devices[name] != nil
+		})
+		for i, name := range names {
+			if h.devices[name] != nil {
+				return nil, fmt.Errorf("there's two devices called %q", name)
+			}
+			var d = &device{Name: name, Profile: profile.Name, Loads: map[int]loadSpec{}}
+			if d.sim, err = kasalink.NewSimulator(kasalink.SimulatorConfig{Address: addresses[i],
+				Profile: profile}); err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			d.Address, d.Outlets = d.sim.Addr(), d.sim.Outlets()
+			h.devices[name] = d
+			h.order = append(h.order, name)
+			for outlet, load := range spec.Loads {
+				if err = d.setLoad(outlet, load); err != nil {
+					return nil, fmt.Errorf("%s: %w", name, err)
+				}
+			}
+			if spec.Faults != nil {
+				d.setFaults(spec.Faults)
+			}
+		}
+	}
+	if f.Discovery != "" {
+		var sims []*kasalink.Simulator
+		for _, name := range h.order {
+			sims = append(sims, h.devices[name].sim)
+		}
+		if h.discovery, err = kasalink.NewDiscoveryResponder(f.Discovery, sims...); err != nil {
+			return nil, fmt.Errorf("discovery: %w", err)
+		}
+	}
+	return h, nil
+}
+
+func (h *house) close() {
+	if h.discovery != nil {
+		_ = h.discovery.Close()
+	}
+	for _, d := range h.devices {
+		if err := d.sim.Close(); err != nil {
+			log.Printf("closing %s: %v", d.Name, err)
+		}
+	}
+}
+
+// setLoad plugs load into outlet, which is 0 for a device without outlets
+func (d *device) setLoad(outlet int, spec loadSpec) error {
+	var load, err = spec.load(time.Now())
+	if err != nil {
+		return err
+	}
+	var child = outlet
+	if d.Outlets == 0 {
+		if outlet != 0 {
+			return fmt.Errorf("%s has no outlets, its load is load 0", d.Name)
+		}
+		child = -1
+	}
+	if err = d.sim.SetLoad(child, load); err != nil {
+		return err
+	}
+	d.Loads[outlet] = spec
+	return nil
+}
+
+// setFaults has the device misbehave the way spec says, or behave again for nil
+func (d *device) setFaults(spec *faultSpec) {
+	if spec == nil {
+		d.sim.SetFaults(kasalink.Faults{})
+	} else {
+		spec.apply(d.sim)
+	}
+	d.Faults = spec
+}
+
+// ServeHTTP is the control API:
+//
+//	GET    /devices                       every device, what it plays, where, and what it's been told to do
+//	GET    /devices/{name}                one device
+//	PUT    /devices/{name}/faults         a faultSpec, to start misbehaving
+//	DELETE /devices/{name}/faults         to stop
+//	PUT    /devices/{name}/loads/{outlet} a loadSpec, to plug something else in
+func (h *house) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	var parts = strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if parts[0] != "devices" {
+		http.NotFound(w, r)
+		return
+	}
+	if len(parts) == 1 {
+		if r.Method != http.MethodGet {
+			http.Error(w, "only GET here", http.StatusMethodNotAllowed)
+			return
+		}
+		var devices = make([]*device, 0, len(h.order))
+		for _, name := range h.order {
+			devices = append(devices, h.devices[name])
+		}
+		reply(w, devices)
+		return
+	}
+	var d = h.devices[parts[1]]
+	if d == nil {
+		http.Error(w, fmt.Sprintf("no device called %q", parts[1]), http.StatusNotFound)
+		return
+	}
+	switch {
+	case len(parts) == 2 && r.Method == http.MethodGet:
+		reply(w, d)
+	case len(parts) == 3 && parts[2] == "faults" && r.Method == http.MethodPut:
+		var spec faultSpec
+		if !readBody(w, r, &spec) {
+			return
+		}
+		d.setFaults(&spec)
+		reply(w, d)
+	case len(parts) == 3 && parts[2] == "faults" && r.Method == http.MethodDelete:
+		d.setFaults(nil)
+		reply(w, d)
+	case len(parts) == 4 && parts[2] == "loads" && r.Method == http.MethodPut:
+		var outlet, err = strconv.Atoi(parts[3])
+		if err != nil || outlet < 0 {
+			http.Error(w, fmt.Sprintf("outlet has to be a number, not %q", parts[3]), http.StatusBadRequest)
+			return
+		}
+		var spec loadSpec
+		if !readBody(w, r, &spec) {
+			return
+		}
+		if err = d.setLoad(outlet, spec); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		reply(w, d)
+	default:
+		http.Error(w, fmt.Sprintf("can't %s %s", r.Method, r.URL.Path), http.StatusMethodNotAllowed)
+	}
+}
+
+// readBody reads the request body, YAML or JSON, into v, or answers with why not
+func readBody(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	var b, err = ioutil.ReadAll(r.Body)
+	if err == nil {
+		err = decode(b, v)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func reply(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	var enc = json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		log.Println("Error answering control request:", err)
+	}
+}
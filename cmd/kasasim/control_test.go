@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PaulSRock/kasalink"
+)
+
+func TestHouse_ServeHTTP(t *testing.T) {
+	var f fleet
+	if err := decode([]byte(testFleet), &f); err != nil {
+		t.Fatal(err)
+	}
+	var h, err = startHouse(&f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.close()
+	var control = func(method, path, body string) (int, string) {
+		var w = httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w.Code, w.Body.String()
+	}
+
+	var code, body = control(http.MethodGet, "/devices", "")
+	var devices []device
+	if err = json.Unmarshal([]byte(body), &devices); code != http.StatusOK || err != nil {
+		t.Fatalf("GET /devices: %d %s", code, body)
+	}
+	var names []string
+	for _, d := range devices {
+		names = append(names, d.Name)
+	}
+	if strings.Join(names, " ") != "sump hs110v2-1 hs110v2-2" || devices[0].Outlets != 6 {
+		t.Errorf("house has %+v", devices)
+	}
+
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var sump = h.devices["sump"]
+	code, body = control(http.MethodPut, "/devices/sump/faults",
+		`errors: {system.get_sysinfo: {err_code: -1, err_msg: "module not support"}}`)
+	if code != http.StatusOK || sump.Faults == nil || len(sump.Faults.Errors) != 1 {
+		t.Fatalf("PUT faults: %d %s", code, body)
+	}
+	if _, err = kasalink.NewDevice(ctx, sump.Address); err == nil {
+		t.Error("sump answered get_sysinfo with its faults on")
+	}
+	if code, body = control(http.MethodDelete, "/devices/sump/faults", ""); code != http.StatusOK ||
+		sump.Faults != nil {
+		t.Fatalf("DELETE faults: %d %s", code, body)
+	}
+	var plug kasalink.Device
+	if plug, err = kasalink.NewDevice(ctx, sump.Address); err != nil {
+		t.Fatalf("sump didn't answer with its faults off: %s", err)
+	}
+	defer plug.Close()
+
+	if code, body = control(http.MethodPut, "/devices/sump/loads/3", `{watts: 100}`); code != http.StatusOK ||
+		sump.Loads[3].Watts != 100 {
+		t.Fatalf("PUT loads: %d %s", code, body)
+	}
+	var reading *kasalink.EMeterReading
+	if reading, err = plug.(*kasalink.KasaPowerPlug).EMeterReading(ctx, 3); err != nil {
+		t.Fatal(err)
+	}
+	if reading.Power < 99 || reading.Power > 101 {
+		t.Errorf("100W load draws %vW", reading.Power)
+	}
+
+	var refused = []struct {
+		method, path, body string
+		code               int
+	}{
+		{http.MethodPut, "/devices/sump/loads/three", `{watts: 100}`, http.StatusBadRequest},
+		{http.MethodPut, "/devices/sump/loads/0", `{type: wavemaker}`, http.StatusBadRequest},
+		{http.MethodPut, "/devices/sump/faults", `latency: [1, 2]`, http.StatusBadRequest},
+		{http.MethodPut, "/devices/nobody/faults", `{latency: 1s}`, http.StatusNotFound},
+		{http.MethodPost, "/devices", ``, http.StatusMethodNotAllowed},
+		{http.MethodPost, "/devices/sump/faults", ``, http.StatusMethodNotAllowed},
+		{http.MethodGet, "/lights", ``, http.StatusNotFound},
+	}
+	for _, tt := range refused {
+		if code, body = control(tt.method, tt.path, tt.body); code != tt.code {
+			t.Errorf("%s %s: got %d %s, want %d", tt.method, tt.path, code, body, tt.code)
+		}
+	}
+}
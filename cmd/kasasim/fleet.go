@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PaulSRock/kasalink"
+	"gopkg.in/yaml.v3"
+)
+
+// fleet is a house full of simulated devices, as read from a fleet file
+type fleet struct {
+	// Control is where the control API listens
+	Control string `json:"control"`
+	// Discovery is where to answer discovery for the whole fleet, if anywhere
+	Discovery string       `json:"discovery"`
+	Devices   []deviceSpec `json:"devices"`
+}
+
+// deviceSpec is one device in a fleet file, or Count of the same device
+type deviceSpec struct {
+	Name string `json:"name"`
+	// Profile is one of the profiles the Simulator comes with, or ProfileFile is a JSON profile of your own
+	Profile     string `json:"profile"`
+	ProfileFile string `json:"profile_file"`
+	// Address is where the device listens, 127.0.0.1:0 (a free port) by default. With a fixed port and a Count, each
+	// copy gets the next IP along instead, 127.0.0.2:9999, 127.0.0.3:9999 and so on.
+	Address string `json:"address"`
+	Count   int    `json:"count"`
+	// Loads are what's plugged into each outlet, in order
+	Loads  []loadSpec `json:"loads"`
+	Faults *faultSpec `json:"faults"`
+}
+
+// loadSpec is a kasalink.Load in a fleet file
+type loadSpec struct {
+	// Type is constant (the default), heater or pump
+	Type  string  `json:"type,omitempty"`
+	Watts float64 `json:"watts,omitempty"`
+	// Period and Duty are for heaters
+	Period duration `json:"period,omitempty"`
+	Duty   float64  `json:"duty,omitempty"`
+	// Surge and SurgeFor are for pumps
+	Surge    float64  `json:"surge,omitempty"`
+	SurgeFor duration `json:"surge_for,omitempty"`
+	// Jitter wobbles any load, 0.05 is 5%
+	Jitter float64 `json:"jitter,omitempty"`
+	// FailAfter has the load fail that long after it's set, drawing FailedWatts from then on
+	FailAfter   duration `json:"fail_after,omitempty"`
+	FailedWatts float64  `json:"failed_watts,omitempty"`
+}
+
+// faultSpec is kasalink.Faults in a fleet file, plus refusing connections
+type faultSpec struct {
+	Latency         duration                           `json:"latency,omitempty"`
+	Errors          map[string]kasalink.SimulatorError `json:"errors,omitempty"`
+	Garbage         bool                               `json:"garbage,omitempty"`
+	DropMidFrame    bool                               `json:"drop_mid_frame,omitempty"`
+	TruncatedHeader bool                               `json:"truncated_header,omitempty"`
+	OversizedHeader bool                               `json:"oversized_header,omitempty"`
+	// Refuse hangs up on new connections for that long
+	Refuse duration `json:"refuse,omitempty"`
+}
+
+// duration is a time.Duration written like "1m30s"
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("durations are strings like \"1m30s\", not %s", b)
+	}
+	var parsed, err = time.ParseDuration(s)
+	*d = duration(parsed)
+	return err
+}
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// readFleet reads a fleet file, YAML or JSON (JSON is YAML too)
+func readFleet(name string) (*fleet, error) {
+	var b, err = ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var f = &fleet{}
+	if err = decode(b, f); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	if len(f.Devices) == 0 {
+		return nil, fmt.Errorf("%s: no devices", name)
+	}
+	return f, nil
+}
+
+// decode reads YAML (or JSON) into v by way of its JSON tags, so there's only the one set of them
+func decode(b []byte, v interface{}) error {
+	var generic interface{}
+	if err := yaml.Unmarshal(b, &generic); err != nil {
+		return err
+	}
+	var asJSON, err = json.Marshal(generic)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(asJSON, v)
+}
+
+// profile is the SimulatorProfile the spec asks for
+func (spec deviceSpec) profile() (*kasalink.SimulatorProfile, error) {
+	if spec.ProfileFile == "" {
+		return kasalink.LoadSimulatorProfile(spec.Profile)
+	}
+	var f, err = os.Open(spec.ProfileFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return kasalink.ReadSimulatorProfile(f)
+}
+
+// addresses are where each of the spec's Count devices listen
+func (spec deviceSpec) addresses() ([]string, error) {
+	var address = spec.Address
+	if address == "" {
+		address = "127.0.0.1:0"
+	}
+	var count = spec.Count
+	if count < 1 {
+		count = 1
+	}
+	var host, port, err = net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	var addresses = []string{address}
+	if count == 1 {
+		return addresses, nil
+	}
+	var ip = net.ParseIP(host).To4()
+	if port != "0" && ip == nil {
+		return nil, fmt.Errorf("%d devices can't all listen on %s, use an IPv4 address to count up from", count,
+			address)
+	}
+	for i := 1; i < count; i++ {
+		if port == "0" {
+			addresses = append(addresses, address)
+			continue
+		}
+		var next = make(net.IP, len(ip))
+		copy(next, ip)
+		next[3] += byte(i)
+		if next[3] < ip[3] {
+			return nil, fmt.Errorf("%d devices from %s runs off the end of the subnet", count, address)
+		}
+		addresses = append(addresses, net.JoinHostPort(next.String(), port))
+	}
+	return addresses, nil
+}
+
+// names are what each of the spec's Count devices are called. Devices without a Name go by their profile and a
+// number, the first one free according to taken.
+func (spec deviceSpec) names(profile string, taken func(name string) bool) []string {
+	var count = spec.Count
+	if count < 1 {
+		count = 1
+	}
+	var names []string
+	for i, n := 1, 1; i <= count; i++ {
+		switch {
+		case spec.Name == "":
+			for taken(fmt.Sprintf("%s-%d", strings.ToLower(profile), n)) {
+				n++
+			}
+			names = append(names, fmt.Sprintf("%s-%d", strings.ToLower(profile), n))
+			n++
+		case count == 1:
+			names = append(names, spec.Name)
+		default:
+			names = append(names, spec.Name+"-"+strconv.Itoa(i))
+		}
+	}
+	return names
+}
+
+// load is the kasalink.Load the spec describes, starting now
+func (spec loadSpec) load(now time.Time) (kasalink.Load, error) {
+	var load kasalink.Load
+	switch strings.ToLower(spec.Type) {
+	case "", "constant":
+		load = kasalink.ConstantLoad(spec.Watts)
+	case "heater":
+		if spec.Duty < 0 || spec.Duty > 1 {
+			return nil, fmt.Errorf("heater duty has to be 0 to 1, not %v", spec.Duty)
+		}
+		load = kasalink.HeaterLoad{Power: spec.Watts, Period: time.Duration(spec.Period), Duty: spec.Duty}
+	case "pump":
+		load = kasalink.PumpLoad{Power: spec.Watts, Surge: spec.Surge, SurgeFor: time.Duration(spec.SurgeFor)}
+	default:
+		return nil, fmt.Errorf("no load type %q, there's constant, heater and pump", spec.Type)
+	}
+	if spec.Jitter > 0 {
+		load = kasalink.NoisyLoad{Load: load, Jitter: spec.Jitter}
+	}
+	if spec.FailAfter > 0 {
+		load = kasalink.FailingLoad{Load: load, At: now.Add(time.Duration(spec.FailAfter)),
+			After: kasalink.ConstantLoad(spec.FailedWatts)}
+	}
+	return load, nil
+}
+
+// apply sets s misbehaving the way the spec says
+func (spec faultSpec) apply(s *kasalink.Simulator) {
+	s.SetFaults(kasalink.Faults{
+		Latency:         time.Duration(spec.Latency),
+		Errors:          spec.Errors,
+		Garbage:         spec.Garbage,
+		DropMidFrame:    spec.DropMidFrame,
+		TruncatedHeader: spec.TruncatedHeader,
+		OversizedHeader: spec.OversizedHeader,
+	})
+	if spec.Refuse > 0 {
+		s.RefuseConnections(time.Duration(spec.Refuse))
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/PaulSRock/kasalink"
+)
+
+func TestDeviceSpec_addresses(t *testing.T) {
+	var tests = []struct {
+		name string
+		spec deviceSpec
+		want []string
+		bad  bool
+	}{
+		{"default", deviceSpec{}, []string{"127.0.0.1:0"}, false},
+		{"free ports", deviceSpec{Count: 3}, []string{"127.0.0.1:0", "127.0.0.1:0", "127.0.0.1:0"}, false},
+		{"counting up", deviceSpec{Address: "127.0.0.2:9999", Count: 3},
+			[]string{"127.0.0.2:9999", "127.0.0.3:9999", "127.0.0.4:9999"}, false},
+		{"up to the end", deviceSpec{Address: "10.0.0.253:9999", Count: 3},
+			[]string{"10.0.0.253:9999", "10.0.0.254:9999", "10.0.0.255:9999"}, false},
+		{"off the end", deviceSpec{Address: "10.0.0.254:9999", Count: 3}, nil, true},
+		{"one by name", deviceSpec{Address: "localhost:9999"}, []string{"localhost:9999"}, false},
+		{"many by name", deviceSpec{Address: "localhost:9999", Count: 2}, nil, true},
+		{"IPv6", deviceSpec{Address: "[::1]:9999", Count: 2}, nil, true},
+		{"no port", deviceSpec{Address: "127.0.0.2"}, nil, true},
+	}
+	for _, tt := range tests {
+		var got, err = tt.spec.addresses()
+		if (err != nil) != tt.bad {
+			t.Errorf("%s: got error %v", tt.name, err)
+			continue
+		}
+		if !tt.bad && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDeviceSpec_names(t *testing.T) {
+	var taken = map[string]bool{"hs110v2-1": true, "hs110v2-3": true}
+	var tests = []struct {
+		name string
+		spec deviceSpec
+		want []string
+	}{
+		{"one named", deviceSpec{Name: "sump"}, []string{"sump"}},
+		{"many named", deviceSpec{Name: "tank", Count: 2}, []string{"tank-1", "tank-2"}},
+		{"one unnamed", deviceSpec{}, []string{"hs110v2-2"}},
+		{"many unnamed", deviceSpec{Count: 3}, []string{"hs110v2-2", "hs110v2-4", "hs110v2-5"}},
+	}
+	for _, tt := range tests {
+		var got = tt.spec.names("HS110v2", func(name string) bool { return taken[name] })
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLoadSpec_load(t *testing.T) {
+	var now = time.Date(2024, time.June, 3, 12, 0, 0, 0, time.UTC)
+	var tests = []struct {
+		yaml string
+		want kasalink.Load
+		bad  bool
+	}{
+		{`{watts: 40}`, kasalink.ConstantLoad(40), false},
+		{`{type: Constant, watts: 40}`, kasalink.ConstantLoad(40), false},
+		{`{type: heater, watts: 300, period: 10m, duty: 0.4}`,
+			kasalink.HeaterLoad{Power: 300, Period: 10 * time.Minute, Duty: 0.4}, false},
+		{`{type: heater, watts: 300, period: 10m, duty: 1.5}`, nil, true},
+		{`{type: pump, watts: 40, surge: 120, surge_for: 2s}`,
+			kasalink.PumpLoad{Power: 40, Surge: 120, SurgeFor: 2 * time.Second}, false},
+		{`{watts: 40, jitter: 0.05}`, kasalink.NoisyLoad{Load: kasalink.ConstantLoad(40), Jitter: 0.05}, false},
+		{`{watts: 40, fail_after: 1h30m, failed_watts: 2}`, kasalink.FailingLoad{Load: kasalink.ConstantLoad(40),
+			At: now.Add(90 * time.Minute), After: kasalink.ConstantLoad(2)}, false},
+		{`{type: wavemaker, watts: 40}`, nil, true},
+	}
+	for _, tt := range tests {
+		var spec loadSpec
+		if err := decode([]byte(tt.yaml), &spec); err != nil {
+			t.Errorf("%s: %s", tt.yaml, err)
+			continue
+		}
+		var got, err = spec.load(now)
+		if (err != nil) != tt.bad {
+			t.Errorf("%s: got error %v", tt.yaml, err)
+			continue
+		}
+		if !tt.bad && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %#v, want %#v", tt.yaml, got, tt.want)
+		}
+	}
+}
+
+func TestDuration(t *testing.T) {
+	var tests = []struct {
+		yaml string
+		want time.Duration
+		bad  bool
+	}{
+		{`{latency: 250ms}`, 250 * time.Millisecond, false},
+		{`{latency: "1m30s"}`, 90 * time.Second, false},
+		{`{latency: 250}`, 0, true},
+		{`{latency: soon}`, 0, true},
+	}
+	for _, tt := range tests {
+		var spec faultSpec
+		var err = decode([]byte(tt.yaml), &spec)
+		if (err != nil) != tt.bad {
+			t.Errorf("%s: got error %v", tt.yaml, err)
+			continue
+		}
+		if !tt.bad && time.Duration(spec.Latency) != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.yaml, time.Duration(spec.Latency), tt.want)
+		}
+	}
+}
+
+func TestReadFleet(t *testing.T) {
+	var dir = t.TempDir()
+	var good, empty = filepath.Join(dir, "fleet.yaml"), filepath.Join(dir, "empty.yaml")
+	if err := ioutil.WriteFile(good, []byte(testFleet), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(empty, []byte("control: 127.0.0.1:0\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var f, err = readFleet(good)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Devices) != 2 || f.Devices[0].Name != "sump" || len(f.Devices[0].Loads) != 2 ||
+		time.Duration(f.Devices[0].Loads[0].SurgeFor) != 2*time.Second || f.Devices[1].Count != 2 ||
+		time.Duration(f.Devices[1].Faults.Latency) != 250*time.Millisecond {
+		t.Errorf("unexpected fleet %+v", f)
+	}
+	if _, err = readFleet(empty); err == nil {
+		t.Error("expected a fleet without devices to be refused")
+	}
+	if _, err = readFleet(filepath.Join(dir, "missing.yaml")); err == nil {
+		t.Error("expected a missing fleet file to be an error")
+	}
+}
+
+// testFleet is a small house: an HS300 with a pump and a heater on it, and two HS110s that are slow to answer
+const testFleet = `
+devices:
+  - name: sump
+    profile: HS300
+    loads:
+      - {type: pump, watts: 40, surge: 120, surge_for: 2s}
+      - {type: heater, watts: 300, period: 10m, duty: 0.4}
+  - profile: HS110v2
+    count: 2
+    faults: {latency: 250ms}
+`
@@ -0,0 +1,72 @@
+// kasasim runs a house full of simulated Kasa devices, described in a fleet file, for working against without real
+// hardware. A fleet file (YAML or JSON) looks like:
+//
+//	control: 127.0.0.1:8099
+//	discovery: 127.0.0.1:9999
+//	devices:
+//	  - name: sump
+//	    profile: HS300
+//	    loads:
+//	      - {type: pump, watts: 40, surge: 120, surge_for: 2s}
+//	      - {type: heater, watts: 300, period: 10m, duty: 0.4, jitter: 0.02}
+//	  - profile: HS110v2
+//	    address: 127.0.0.2:9999
+//	    count: 3
+//	    faults: {latency: 250ms}
+//
+// Once it's running, the control API (see house.ServeHTTP) flips faults and loads.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+var fleetFile = flag.String("fleet", "fleet.yaml", "Fleet file describing the devices to run")
+var control = flag.String("control", "", "Address for the control API, overrides the fleet file")
+
+// defaultControl is where the control API listens if nobody says
+const defaultControl = "127.0.0.1:8099"
+
+func main() {
+	flag.Parse()
+	var f, err = readFleet(*fleetFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *control != "" {
+		f.Control = *control
+	}
+	if f.Control == "" {
+		f.Control = defaultControl
+	}
+	var h *house
+	if h, err = startHouse(f); err != nil {
+		log.Fatal(err)
+	}
+	defer h.close()
+	for _, name := range h.order {
+		var d = h.devices[name]
+		log.Printf("%s: %s on %s", d.Name, d.Profile, d.Address)
+	}
+	if h.discovery != nil {
+		log.Printf("answering discovery on %s", h.discovery.Addr())
+	}
+
+	var server = &http.Server{Addr: f.Control, Handler: h}
+	go func() {
+		if err := server.ListenAndServe(); err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+	log.Printf("control API on http://%s/devices", f.Control)
+
+	var stop = make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+	_ = server.Close()
+}
@@ -0,0 +1,118 @@
+package kasalink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// DefaultCloudServer is the cloud server Kasa devices ship pointed at
+const DefaultCloudServer = "devs.tplinkcloud.com"
+
+// CloudStatus is the device's side of its cloud (cnCloud) configuration
+type CloudStatus struct {
+	Server   string `json:"server"`
+	Username string `json:"username"`
+	// Binded is whether the device belongs to a TP-Link cloud account, the name is TP-Link's
+	Binded bool `json:"binded"`
+	// CloudConnected is whether the device is connected to Server right now
+	CloudConnected bool   `json:"cloud_connected"`
+	FwDlPage       string `json:"fw_dl_page,omitempty"`
+}
+
+// FirmwareInfo is an entry in the firmware list the device gets from its cloud server
+type FirmwareInfo struct {
+	Type          int    `json:"fwType"`
+	Time          int64  `json:"fwTime"`
+	Version       string `json:"fwVer,omitempty"`
+	URL           string `json:"fwUrl"`
+	Location      int    `json:"fwLocation"`
+	ReleaseLog    string `json:"fwReleaseLog"`
+	ReleaseLogURL string `json:"fwReleaseLogUrl"`
+}
+
+// GetCloudStatus asks the device which cloud server it uses, who it's bound to, and if it's connected right now
+func (kpp *KasaPowerPlug) GetCloudStatus(ctx context.Context) (*CloudStatus, error) {
+	var response, err = kpp.cnCloud(ctx, getCloudInfo, "get_info")
+	if err != nil {
+		return nil, err
+	}
+	var info = response.GetInfo
+	return &CloudStatus{
+		Server:         info.Server,
+		Username:       info.Username,
+		Binded:         info.Binded == 1,
+		CloudConnected: info.CldConnection == 1,
+		FwDlPage:       info.FwDlPage,
+	}, nil
+}
+
+// CloudFirmwareList asks the device for the firmware its cloud server has on offer. The device has to be able to
+// reach its cloud server for this to work.
+func (kpp *KasaPowerPlug) CloudFirmwareList(ctx context.Context) ([]FirmwareInfo, error) {
+	var response, err = kpp.cnCloud(ctx, getFirmwareList, "get_intl_fw_list")
+	if err != nil {
+		return nil, err
+	}
+	return response.GetIntlFwList.FwList, nil
+}
+
+// SetCloudServer points the device at a different cloud server
+func (kpp *KasaPowerPlug) SetCloudServer(ctx context.Context, server string) error {
+	if server == "" {
+		return errors.New("a cloud server can't be blank")
+	}
+	var _, err = kpp.cnCloud(ctx, fmt.Sprintf(setCloudURLFormatString, jsonString(server)), "set_server_url")
+	return err
+}
+
+// BindCloud binds the device to a TP-Link cloud account, by way of whatever cloud server it's pointed at
+func (kpp *KasaPowerPlug) BindCloud(ctx context.Context, user, pass string) error {
+	if user == "" {
+		return errors.New("binding to the cloud needs a username")
+	}
+	var _, err = kpp.cnCloud(ctx, fmt.Sprintf(cloudConnectFormatString, jsonString(user), jsonString(pass)), "bind")
+	return err
+}
+
+// UnbindCloud removes the device from the cloud account it's bound to
+func (kpp *KasaPowerPlug) UnbindCloud(ctx context.Context) error {
+	var _, err = kpp.cnCloud(ctx, unbindDeviceFromCloud, "unbind")
+	return err
+}
+
+// cnCloud sends a single cnCloud method and makes sure the device answered it without complaint. Anything the
+// device refuses comes back as a *ResponseError.
+func (kpp *KasaPowerPlug) cnCloud(ctx context.Context, cmd, method string) (*cnCloudModule, error) {
+	var response, err = kpp.query(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+	if response.CnCloud == nil {
+		return nil, errNoAnswer("cnCloud", method)
+	}
+	var answer *thingWithErrCode
+	switch method {
+	case "get_info":
+		if response.CnCloud.GetInfo != nil {
+			answer = &response.CnCloud.GetInfo.thingWithErrCode
+		}
+	case "get_intl_fw_list":
+		if response.CnCloud.GetIntlFwList != nil {
+			answer = &response.CnCloud.GetIntlFwList.thingWithErrCode
+		}
+	case "set_server_url":
+		answer = response.CnCloud.SetServerURL
+	case "bind":
+		answer = response.CnCloud.Bind
+	case "unbind":
+		answer = response.CnCloud.Unbind
+	}
+	if answer == nil {
+		return nil, response.CnCloud.missing("cnCloud", method)
+	}
+	if err = answer.err("cnCloud", method); err != nil {
+		return nil, err
+	}
+	return response.CnCloud, nil
+}
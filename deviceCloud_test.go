@@ -0,0 +1,46 @@
+package kasalink
+
+import (
+	"context"
+	"testing"
+)
+
+func TestKasaPowerPlug_GetCloudStatus(t *testing.T) {
+	var (
+		kpp    *KasaPowerPlug
+		status *CloudStatus
+		fws    []FirmwareInfo
+		err    error
+	)
+	mockOrNot(&kpp, t)
+	status, err = kpp.GetCloudStatus(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("%+v", status)
+	fws, err = kpp.CloudFirmwareList(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("%+v", fws)
+	if useMock && (!status.Binded || !status.CloudConnected || len(fws) != 1) {
+		t.Fatalf("unexpected cloud status %+v, firmware %+v", status, fws)
+	}
+}
+
+func TestKasaPowerPlug_UnbindCloud(t *testing.T) {
+	if !useMock {
+		t.Skip("not unbinding a real plug from its account")
+	}
+	var kpp *KasaPowerPlug
+	mockOrNot(&kpp, t)
+	if err := kpp.SetCloudServer(context.Background(), "127.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := kpp.UnbindCloud(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := kpp.SetCloudServer(context.Background(), ""); err == nil {
+		t.Fatal("expected a blank server to be refused")
+	}
+}
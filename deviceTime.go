@@ -0,0 +1,95 @@
+package kasalink
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// DeviceTime asks the device what time it thinks it is. Kasa devices keep local wall clock time, so the answer comes
+// back in the Location matching the device's timezone index. If the index isn't one we know, time.Local is assumed.
+func (kpp *KasaPowerPlug) DeviceTime(ctx context.Context) (time.Time, error) {
+	var response, err = kpp.query(ctx, getDeviceTimeAndZone)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if response.Time == nil {
+		return time.Time{}, errNoAnswer("time", "get_time")
+	}
+	if response.Time.GetTime == nil {
+		return time.Time{}, response.Time.missing("time", "get_time")
+	}
+	if err = response.Time.GetTime.err("time", "get_time"); err != nil {
+		return time.Time{}, err
+	}
+	var loc = time.Local
+	if response.Time.GetTimezone != nil && response.Time.GetTimezone.ErrorCode == 0 {
+		if tzLoc, tzErr := TimezoneLocation(response.Time.GetTimezone.Index); tzErr == nil {
+			loc = tzLoc
+		}
+	}
+	var t = response.Time.GetTime
+	return time.Date(t.Year, time.Month(t.Month), t.Day, t.Hour, t.Minute, t.Second, 0, loc), nil
+}
+
+// DeviceTimezone gives you the device's index into TP-Link's timezone table, along with the matching Location
+func (kpp *KasaPowerPlug) DeviceTimezone(ctx context.Context) (index int, loc *time.Location, err error) {
+	var response *KasaResponse
+	if response, err = kpp.query(ctx, getDeviceTimeZone); err != nil {
+		return -1, nil, err
+	}
+	if response.Time == nil {
+		return -1, nil, errNoAnswer("time", "get_timezone")
+	}
+	if response.Time.GetTimezone == nil {
+		return -1, nil, response.Time.missing("time", "get_timezone")
+	}
+	if err = response.Time.GetTimezone.err("time", "get_timezone"); err != nil {
+		return -1, nil, err
+	}
+	index = response.Time.GetTimezone.Index
+	if loc, err = TimezoneLocation(index); err != nil {
+		return index, nil, err
+	}
+	return index, loc, nil
+}
+
+// SetTimezone moves the device to an IANA timezone (like "America/New_York") and sets its clock to the host's time
+// while it's at it. Because the device gets a real timezone index, it handles daylight saving on its own.
+func (kpp *KasaPowerPlug) SetTimezone(ctx context.Context, name string) error {
+	var index, err = TimezoneIndex(name)
+	if err != nil {
+		return err
+	}
+	var loc *time.Location
+	if loc, err = TimezoneLocation(index); err != nil {
+		return err
+	}
+	return kpp.setTimeAndZone(ctx, time.Now().In(loc), index)
+}
+
+// SetDeviceTime sets the device's clock to t, leaving its timezone alone
+func (kpp *KasaPowerPlug) SetDeviceTime(ctx context.Context, t time.Time) error {
+	var index, loc, err = kpp.DeviceTimezone(ctx)
+	if err != nil {
+		return err
+	}
+	return kpp.setTimeAndZone(ctx, t.In(loc), index)
+}
+
+// setTimeAndZone is the only way the time module lets you set the clock, time and timezone always go together. t
+// needs to already be in the Location for index.
+func (kpp *KasaPowerPlug) setTimeAndZone(ctx context.Context, t time.Time, index int) error {
+	var response, err = kpp.query(ctx, fmt.Sprintf(setDeviceTimeFormatString,
+		t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), index))
+	if err != nil {
+		return err
+	}
+	if response.Time == nil {
+		return errNoAnswer("time", "set_timezone")
+	}
+	if response.Time.SetTimezone == nil {
+		return response.Time.missing("time", "set_timezone")
+	}
+	return response.Time.SetTimezone.err("time", "set_timezone")
+}
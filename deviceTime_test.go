@@ -0,0 +1,49 @@
+package kasalink
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTimezoneIndex(t *testing.T) {
+	var tests = map[string]int{
+		"EST5EDT":          17,
+		"America/New_York": 17,
+		"Europe/Amsterdam": 40,
+		"Europe/Berlin":    40,
+		"Asia/Tokyo":       89,
+	}
+	for name, want := range tests {
+		var got, err = TimezoneIndex(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("TimezoneIndex(%q) = %d, want %d", name, got, want)
+		}
+	}
+	if _, err := TimezoneIndex("Not/AZone"); err == nil {
+		t.Error("expected an error for a made up zone")
+	}
+}
+
+func TestKasaPowerPlug_DeviceTime(t *testing.T) {
+	var (
+		kpp *KasaPowerPlug
+		dt  time.Time
+		err error
+	)
+	mockOrNot(&kpp, t)
+	dt, err = kpp.DeviceTime(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("Device Time: %s", dt)
+	if useMock {
+		var want = time.Date(2019, time.March, 10, 12, 30, 15, 0, dt.Location())
+		if !dt.Equal(want) || dt.Location().String() != "EST5EDT" {
+			t.Fatalf("got %s, want %s in EST5EDT", dt, want)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package kasalink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	dimmerModule        = "smartlife.iot.dimmer"
+	getDimmerParameters = `{"smartlife.iot.dimmer":{"get_dimmer_parameters":{}}}`
+	getDimmerBehavior   = `{"smartlife.iot.dimmer":{"get_default_behavior":{}}}`
+	maxDimmerFadeTime   = 10 * time.Second
+	maxDimmerTransition = 10 * time.Minute
+)
+
+// DimmerSettings are the dimmer's fade and ramp settings
+type DimmerSettings struct {
+	// FadeOn and FadeOff are how long the light takes to come on or go off from the paddle
+	FadeOn  time.Duration
+	FadeOff time.Duration
+	// GentleOn and GentleOff are how long the gentle on/off action takes
+	GentleOn  time.Duration
+	GentleOff time.Duration
+	// MinThreshold is the lowest brightness the dimmer will go to, for bulbs that flicker below it
+	MinThreshold int
+	RampRate     int
+}
+
+// DimmerAction is what the dimmer does when it's switched one of the ways in DimmerTrigger
+type DimmerAction string
+
+// The actions a dimmer can be set to do
+const (
+	DimmerLastStatus DimmerAction = "last_status"
+	DimmerInstant    DimmerAction = "instant_on_off"
+	DimmerGentle     DimmerAction = "gentle_on_off"
+	DimmerPreset     DimmerAction = "customize_preset"
+	DimmerNoAction   DimmerAction = "none"
+)
+
+// DimmerTrigger is a way the dimmer can be switched, each can be set to its own DimmerAction
+type DimmerTrigger string
+
+// The ways a dimmer can be switched
+const (
+	// DimmerHardOn is power coming back after it was cut, from the breaker or an outage
+	DimmerHardOn DimmerTrigger = "hard_on"
+	// DimmerSoftOn is being switched on, from the paddle or the app
+	DimmerSoftOn      DimmerTrigger = "soft_on"
+	DimmerLongPress   DimmerTrigger = "long_press"
+	DimmerDoubleClick DimmerTrigger = "double_click"
+)
+
+// DimmerBehavior is what the dimmer does for each DimmerTrigger
+type DimmerBehavior map[DimmerTrigger]DimmerAction
+
+// Dimmer is a Kasa dimmer switch, like the HS220. It's a KasaPowerPlug (on, off, alias and the rest work the same),
+// with brightness control on top.
+type Dimmer struct {
+	*KasaPowerPlug
+}
+
+// NewDimmer gives you a Dimmer that's already gotten its system info
+func NewDimmer(ctx context.Context, address string) (*Dimmer, error) {
+	var kpp = &KasaPowerPlug{
+		plugNetworkLocation: address,
+		timeout:             5 * time.Second,
+	}
+	kpp.Unsafe.kpp = kpp
+	if _, err := kpp.fetchSystemInfo(ctx); err != nil {
+		kpp.closer()
+		return nil, err
+	}
+	return &Dimmer{KasaPowerPlug: kpp}, nil
+}
+
+// Brightness asks the dimmer what brightness (1-100) it's set to. That's kept while it's off.
+func (d *Dimmer) Brightness(ctx context.Context) (int, error) {
+	var sysInfo, err = d.fetchSystemInfo(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return sysInfo.Brightness, nil
+}
+
+// SetBrightness sets the dimmer's brightness (1-100) straight away. It doesn't turn the dimmer on if it's off.
+func (d *Dimmer) SetBrightness(ctx context.Context, brightness int) error {
+	if err := checkDimmerBrightness(brightness); err != nil {
+		return err
+	}
+	return d.dimmer(ctx, "set_brightness", map[string]int{"brightness": brightness})
+}
+
+// TransitionTo fades the dimmer to brightness (1-100) over duration, turning it on if it's off. A brightness of 0
+// fades it off.
+func (d *Dimmer) TransitionTo(ctx context.Context, brightness int, duration time.Duration) error {
+	if brightness != 0 {
+		if err := checkDimmerBrightness(brightness); err != nil {
+			return err
+		}
+	}
+	if duration < 0 || duration > maxDimmerTransition {
+		return fmt.Errorf("transitions can take 0 to %s, not %s", maxDimmerTransition, duration)
+	}
+	return d.dimmer(ctx, "set_dimmer_transition", map[string]interface{}{"brightness": brightness,
+		"mode": string(DimmerGentle), "duration": int(duration / time.Millisecond)})
+}
+
+// Settings asks the dimmer for its fade and ramp settings
+func (d *Dimmer) Settings(ctx context.Context) (*DimmerSettings, error) {
+	var module, err = d.dimmerQuery(ctx, getDimmerParameters, "get_dimmer_parameters")
+	if err != nil {
+		return nil, err
+	}
+	var p = module.GetDimmerParameters
+	return &DimmerSettings{
+		FadeOn:       time.Duration(p.FadeOnTime) * time.Millisecond,
+		FadeOff:      time.Duration(p.FadeOffTime) * time.Millisecond,
+		GentleOn:     time.Duration(p.GentleOnTime) * time.Millisecond,
+		GentleOff:    time.Duration(p.GentleOffTime) * time.Millisecond,
+		MinThreshold: p.MinThreshold,
+		RampRate:     p.RampRate,
+	}, nil
+}
+
+// SetFadeOnTime sets how long the light takes to come on from the paddle, up to 10 seconds
+func (d *Dimmer) SetFadeOnTime(ctx context.Context, fade time.Duration) error {
+	return d.setDimmerTime(ctx, "set_fade_on_time", "fadeTime", fade)
+}
+
+// SetFadeOffTime sets how long the light takes to go off from the paddle, up to 10 seconds
+func (d *Dimmer) SetFadeOffTime(ctx context.Context, fade time.Duration) error {
+	return d.setDimmerTime(ctx, "set_fade_off_time", "fadeTime", fade)
+}
+
+// SetGentleOnTime sets how long the gentle on action takes, up to 10 minutes
+func (d *Dimmer) SetGentleOnTime(ctx context.Context, duration time.Duration) error {
+	return d.setDimmerTime(ctx, "set_gentle_on_time", "duration", duration)
+}
+
+// SetGentleOffTime sets how long the gentle off action takes, up to 10 minutes
+func (d *Dimmer) SetGentleOffTime(ctx context.Context, duration time.Duration) error {
+	return d.setDimmerTime(ctx, "set_gentle_off_time", "duration", duration)
+}
+
+// DefaultBehavior asks the dimmer what it does for each way it can be switched
+func (d *Dimmer) DefaultBehavior(ctx context.Context) (DimmerBehavior, error) {
+	var module, err = d.dimmerQuery(ctx, getDimmerBehavior, "get_default_behavior")
+	if err != nil {
+		return nil, err
+	}
+	var (
+		b        = module.GetDefaultBehavior
+		behavior = DimmerBehavior{}
+	)
+	for trigger, action := range map[DimmerTrigger]*dimmerAction{DimmerHardOn: b.HardOn, DimmerSoftOn: b.SoftOn,
+		DimmerLongPress: b.LongPress, DimmerDoubleClick: b.DoubleClick} {
+		if action != nil && action.Mode != "" {
+			behavior[trigger] = DimmerAction(action.Mode)
+		}
+	}
+	return behavior, nil
+}
+
+// SetDefaultBehavior sets what the dimmer does when it's switched the way trigger says
+func (d *Dimmer) SetDefaultBehavior(ctx context.Context, trigger DimmerTrigger, action DimmerAction) error {
+	var method string
+	switch trigger {
+	case DimmerHardOn:
+		method = "set_hard_on_behavior"
+	case DimmerSoftOn:
+		method = "set_soft_on_behavior"
+	case DimmerLongPress:
+		method = "set_long_press_behavior"
+	case DimmerDoubleClick:
+		method = "set_double_click_action"
+	default:
+		return fmt.Errorf("%q isn't a way a dimmer can be switched", trigger)
+	}
+	switch action {
+	case DimmerLastStatus, DimmerInstant, DimmerGentle, DimmerPreset, DimmerNoAction:
+	default:
+		return fmt.Errorf("%q isn't something a dimmer can do", action)
+	}
+	return d.dimmer(ctx, method, map[string]string{"mode": string(action)})
+}
+
+func checkDimmerBrightness(brightness int) error {
+	if brightness < 1 || brightness > MaxBrightness {
+		return fmt.Errorf("brightness has to be 1 to %d, not %d", MaxBrightness, brightness)
+	}
+	return nil
+}
+
+// setDimmerTime sets one of the dimmer's times, which it takes in milliseconds
+func (d *Dimmer) setDimmerTime(ctx context.Context, method, arg string, duration time.Duration) error {
+	var limit = maxDimmerTransition
+	if arg == "fadeTime" {
+		limit = maxDimmerFadeTime
+	}
+	if duration < 0 || duration > limit {
+		return fmt.Errorf("%s takes 0 to %s, not %s", method, limit, duration)
+	}
+	return d.dimmer(ctx, method, map[string]int{arg: int(duration / time.Millisecond)})
+}
+
+// dimmer sends a single dimmer method that only answers with an err_code, and checks it
+func (d *Dimmer) dimmer(ctx context.Context, method string, args interface{}) error {
+	var b, err = json.Marshal(args)
+	if err != nil {
+		return err
+	}
+	_, err = d.dimmerQuery(ctx, fmt.Sprintf(`{%q:{%q:%s}}`, dimmerModule, method, b), method)
+	return err
+}
+
+// dimmerQuery sends a single dimmer method and makes sure the dimmer answered it without complaint
+func (d *Dimmer) dimmerQuery(ctx context.Context, cmd, method string) (*dimmerModuleResponse, error) {
+	if err := d.require("dimmer", func(caps Capabilities) bool { return caps.Dimming }); err != nil {
+		return nil, err
+	}
+	var response, err = d.query(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+	if response.Dimmer == nil {
+		return nil, errNoAnswer(dimmerModule, method)
+	}
+	var answer *thingWithErrCode
+	switch method {
+	case "get_dimmer_parameters":
+		if response.Dimmer.GetDimmerParameters != nil {
+			answer = &response.Dimmer.GetDimmerParameters.thingWithErrCode
+		}
+	case "get_default_behavior":
+		if response.Dimmer.GetDefaultBehavior != nil {
+			answer = &response.Dimmer.GetDefaultBehavior.thingWithErrCode
+		}
+	case "set_brightness":
+		answer = response.Dimmer.SetBrightness
+	case "set_dimmer_transition":
+		answer = response.Dimmer.SetDimmerTransition
+	case "set_fade_on_time":
+		answer = response.Dimmer.SetFadeOnTime
+	case "set_fade_off_time":
+		answer = response.Dimmer.SetFadeOffTime
+	case "set_gentle_on_time":
+		answer = response.Dimmer.SetGentleOnTime
+	case "set_gentle_off_time":
+		answer = response.Dimmer.SetGentleOffTime
+	case "set_hard_on_behavior":
+		answer = response.Dimmer.SetHardOnBehavior
+	case "set_soft_on_behavior":
+		answer = response.Dimmer.SetSoftOnBehavior
+	case "set_long_press_behavior":
+		answer = response.Dimmer.SetLongPressBehavior
+	case "set_double_click_action":
+		answer = response.Dimmer.SetDoubleClickAction
+	}
+	if answer == nil {
+		return nil, response.Dimmer.missing(dimmerModule, method)
+	}
+	if err = answer.err(dimmerModule, method); err != nil {
+		return nil, err
+	}
+	return response.Dimmer, nil
+}
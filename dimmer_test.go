@@ -0,0 +1,86 @@
+package kasalink
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDimmer(t *testing.T) {
+	var md, err = NewMockDimmer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer md.Close()
+	var (
+		ctx    = context.Background()
+		device Device
+	)
+	if device, err = NewDevice(ctx, md.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	var d, ok = device.(*Dimmer)
+	if !ok {
+		t.Fatalf("expected a *Dimmer for an HS220, got %T", device)
+	}
+	defer d.Close()
+
+	if err = d.SetBrightness(ctx, 75); err != nil {
+		t.Fatal(err)
+	}
+	var brightness int
+	if brightness, err = d.Brightness(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if brightness != 75 {
+		t.Fatalf("expected brightness 75, got %d", brightness)
+	}
+	if err = d.SetBrightness(ctx, 101); err == nil {
+		t.Fatal("expected brightness 101 to be refused")
+	}
+	if err = d.TransitionTo(ctx, 30, 2*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if brightness, _ = d.Brightness(ctx); brightness != 30 {
+		t.Fatalf("expected brightness 30 after the transition, got %d", brightness)
+	}
+
+	if err = d.SetFadeOnTime(ctx, 2500*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err = d.SetGentleOffTime(ctx, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err = d.SetFadeOffTime(ctx, time.Minute); err == nil {
+		t.Fatal("expected a minute long fade to be refused")
+	}
+	var settings *DimmerSettings
+	if settings, err = d.Settings(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if settings.FadeOn != 2500*time.Millisecond || settings.GentleOff != time.Minute {
+		t.Fatalf("unexpected settings %+v", settings)
+	}
+
+	if err = d.SetDefaultBehavior(ctx, DimmerHardOn, DimmerInstant); err != nil {
+		t.Fatal(err)
+	}
+	var behavior DimmerBehavior
+	if behavior, err = d.DefaultBehavior(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if behavior[DimmerHardOn] != DimmerInstant || behavior[DimmerDoubleClick] != DimmerGentle {
+		t.Fatalf("unexpected behavior %+v", behavior)
+	}
+}
+
+func TestDimmer_notSupported(t *testing.T) {
+	var d = &Dimmer{KasaPowerPlug: &KasaPowerPlug{
+		plugNetworkLocation: "127.0.0.1:1",
+		SysInfo:             &SystemInfo{Model: "HS200(US)", MICType: "IOT.SMARTPLUGSWITCH", Feature: "TIM"},
+	}}
+	if err := d.SetBrightness(context.Background(), 50); !errors.Is(err, ErrNotSupported) {
+		t.Fatalf("expected ErrNotSupported for an HS200, got %v", err)
+	}
+}
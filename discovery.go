@@ -0,0 +1,90 @@
+package kasalink
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"time"
+)
+
+// DefaultDiscoveryAddress is where Discover sends its broadcast, Kasa devices listen for UDP on the same port they
+// take TCP commands on
+const DefaultDiscoveryAddress = "255.255.255.255:9999"
+
+// DiscoveredDevice is a device that answered a discovery broadcast
+type DiscoveredDevice struct {
+	// Address is where the answer came from, hand it to NewKasaPowerPlug to talk to the device
+	Address string
+	SysInfo *SystemInfo
+}
+
+// Discover sends get_sysinfo over UDP to address (DefaultDiscoveryAddress if empty, but a unicast address works too)
+// and collects every answer that comes back within wait, or until ctx is done, whichever is first.
+func Discover(ctx context.Context, address string, wait time.Duration) ([]DiscoveredDevice, error) {
+	if address == "" {
+		address = DefaultDiscoveryAddress
+	}
+	var dst, err = net.ResolveUDPAddr("udp4", address)
+	if err != nil {
+		return nil, err
+	}
+	var conn *net.UDPConn
+	if conn, err = net.ListenUDP("udp4", nil); err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var deadline = time.Now().Add(wait)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	if err = conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+	var stop = make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.SetDeadline(time.Unix(1, 0))
+		case <-stop:
+		}
+	}()
+
+	if _, err = conn.WriteToUDP(encryptDatagram(getSysInfo), dst); err != nil {
+		return nil, err
+	}
+
+	var (
+		found   []DiscoveredDevice
+		seen    = map[string]bool{}
+		buf     = make([]byte, 64*1024)
+		n       int
+		from    *net.UDPAddr
+		readErr error
+	)
+	for {
+		if n, from, readErr = conn.ReadFromUDP(buf); readErr != nil {
+			break
+		}
+		if seen[from.String()] {
+			continue
+		}
+		var response KasaResponse
+		if json.Unmarshal(decrypt(buf[:n]), &response) != nil || response.System == nil ||
+			response.System.GetSysInfo == nil {
+			// not a Kasa device, or a garbled answer, either way nothing to add
+			continue
+		}
+		seen[from.String()] = true
+		found = append(found, DiscoveredDevice{Address: from.String(), SysInfo: response.System.GetSysInfo})
+	}
+	if netErr, ok := readErr.(net.Error); ok && netErr.Timeout() {
+		// running out of time is how discovery ends, it's only a problem if ctx was cancelled on us
+		if ctx.Err() == context.Canceled {
+			return found, ctx.Err()
+		}
+		return found, nil
+	}
+	return found, readErr
+}
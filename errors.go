@@ -0,0 +1,40 @@
+package kasalink
+
+import "fmt"
+
+// ResponseError is what you get back when a Kasa device answers a command, but the answer carries a non-zero err_code
+type ResponseError struct {
+	Module  string
+	Method  string
+	Code    int
+	Message string
+}
+
+func (e *ResponseError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("%s.%s failed with err_code %d", e.Module, e.Method, e.Code)
+	}
+	return fmt.Sprintf("%s.%s failed with err_code %d: %s", e.Module, e.Method, e.Code, e.Message)
+}
+
+// err turns a non-zero err_code into a *ResponseError, or returns nil if the device was happy
+func (t thingWithErrCode) err(module, method string) error {
+	if t.ErrorCode == 0 {
+		return nil
+	}
+	return &ResponseError{Module: module, Method: method, Code: t.ErrorCode, Message: t.ErrorMessage}
+}
+
+// errNoAnswer is for when the device answered, but not the question we asked it
+func errNoAnswer(module, method string) error {
+	return fmt.Errorf("device did not answer %s.%s", module, method)
+}
+
+// missing is for a module that answered without the method we asked about, which is what devices do when they don't
+// support the module at all (the reason is in the module's err_code)
+func (t thingWithErrCode) missing(module, method string) error {
+	if err := t.err(module, method); err != nil {
+		return err
+	}
+	return errNoAnswer(module, method)
+}
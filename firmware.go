@@ -0,0 +1,273 @@
+package kasalink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrFirmwareMismatch means the firmware isn't meant for this model or hardware version, so it wasn't sent
+	ErrFirmwareMismatch = errors.New("firmware doesn't match the device")
+	// ErrFirmwareCurrent means the device is already running the firmware version you asked for
+	ErrFirmwareCurrent = errors.New("the device is already running that firmware")
+	// ErrFirmwareNotApplied means the device came back from flashing, but not running the new firmware
+	ErrFirmwareNotApplied = errors.New("the device isn't running the new firmware")
+	// ErrFirmwareDownload means the device gave up on downloading the firmware, or stopped getting anywhere with it
+	ErrFirmwareDownload = errors.New("the device didn't download the firmware")
+)
+
+// The statuses get_download_state reports, anything else is the download going wrong
+const (
+	downloadIdle       = 0
+	downloadInProgress = 1
+	downloadDone       = 2
+)
+
+// FirmwareUpdate is a firmware image and the device it's meant for
+type FirmwareUpdate struct {
+	URL string
+	// Model has to match the device's model exactly, region and all (like "HS300(US)")
+	Model string
+	// HardwareVersion has to match the device's hw_ver, if it's set
+	HardwareVersion string
+	// Version is the sw_ver the device should have afterwards. If it's blank, any change in sw_ver will do.
+	Version string
+}
+
+// FirmwareUpdateFromCloud turns an entry from the device's own CloudFirmwareList into a FirmwareUpdate. The fw_list
+// entries don't say what model or hardware they're for, so those are copied from the device's system info, which
+// means UpdateFirmware does no compatibility check for cloud images: you're trusting the cloud to only offer the
+// device firmware that's meant for it.
+func FirmwareUpdateFromCloud(sysInfo *SystemInfo, fw FirmwareInfo) FirmwareUpdate {
+	return FirmwareUpdate{
+		URL:             fw.URL,
+		Model:           sysInfo.Model,
+		HardwareVersion: sysInfo.HardwareVersion,
+		Version:         fw.Version,
+	}
+}
+
+// FirmwareStage is how far along UpdateFirmware is
+type FirmwareStage int
+
+// The stages of a firmware update, in the order they happen
+const (
+	FirmwareDownloading FirmwareStage = iota
+	FirmwareFlashing
+	FirmwareRebooting
+	FirmwareVerifying
+	FirmwareDone
+)
+
+func (fs FirmwareStage) String() string {
+	switch fs {
+	case FirmwareDownloading:
+		return "downloading"
+	case FirmwareFlashing:
+		return "flashing"
+	case FirmwareRebooting:
+		return "rebooting"
+	case FirmwareVerifying:
+		return "verifying"
+	case FirmwareDone:
+		return "done"
+	default:
+		return fmt.Sprintf("FirmwareStage(%d)", int(fs))
+	}
+}
+
+// FirmwareProgress is what UpdateFirmware tells your Progress callback. Percent only means something while
+// downloading.
+type FirmwareProgress struct {
+	Stage   FirmwareStage
+	Percent int
+}
+
+// FirmwareOptions tune how UpdateFirmware goes about things, the zero value is fine
+type FirmwareOptions struct {
+	// Progress, if set, gets called every time something changes
+	Progress func(FirmwareProgress)
+	// PollInterval is how often download progress gets checked, it defaults to a second
+	PollInterval time.Duration
+	// StallTimeout is how long the download can go without getting any further before it's given up on, it
+	// defaults to a minute
+	StallTimeout time.Duration
+	// RebootTimeout is how long the device gets to come back once it's had the flash and reboot time it asks for,
+	// it defaults to three minutes
+	RebootTimeout time.Duration
+}
+
+// UpdateFirmware puts new firmware on the device. It checks the firmware is meant for the device before anything
+// else (as far as the update's Model and HardwareVersion say, see FirmwareUpdateFromCloud), then has the device
+// download it, flashes it, waits for the device to come back, and makes sure it's running the new version. You get
+// back the device's system info from after the update.
+func (kpp *KasaPowerPlug) UpdateFirmware(ctx context.Context, update FirmwareUpdate,
+	opts FirmwareOptions) (*SystemInfo, error) {
+	if opts.PollInterval == 0 {
+		opts.PollInterval = time.Second
+	}
+	if opts.StallTimeout == 0 {
+		opts.StallTimeout = time.Minute
+	}
+	if opts.RebootTimeout == 0 {
+		opts.RebootTimeout = 3 * time.Minute
+	}
+	var progress = func(stage FirmwareStage, percent int) {
+		if kpp.log != nil {
+			kpp.log.Printf("Firmware update on %s: %s %d%%", kpp.deviceID, stage, percent)
+		}
+		if opts.Progress != nil {
+			opts.Progress(FirmwareProgress{Stage: stage, Percent: percent})
+		}
+	}
+
+	var before, err = kpp.fetchSystemInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err = update.compatibleWith(before); err != nil {
+		return nil, err
+	}
+
+	progress(FirmwareDownloading, 0)
+	if err = kpp.system(ctx, kpp.Unsafe.DownloadFirmaware(update.URL), "download_firmware"); err != nil {
+		return nil, err
+	}
+	var downloaded *downloadState
+	if downloaded, err = kpp.waitForDownload(ctx, opts.PollInterval, opts.StallTimeout, progress); err != nil {
+		return nil, err
+	}
+
+	progress(FirmwareFlashing, 100)
+	if err = kpp.system(ctx, kpp.Unsafe.FlashDownloadedFirmware(), "flash_firmware"); err != nil {
+		return nil, err
+	}
+
+	progress(FirmwareRebooting, 100)
+	var (
+		after   *SystemInfo
+		applied = func(sysInfo *SystemInfo) bool {
+			if update.Version != "" {
+				return sysInfo.SoftwareVersion == update.Version
+			}
+			return sysInfo.SoftwareVersion != before.SoftwareVersion
+		}
+		settle = time.Duration(downloaded.FlashTime+downloaded.RebootTime) * time.Second
+	)
+	if after, err = kpp.waitForReboot(ctx, settle, opts.RebootTimeout, opts.PollInterval, applied); err != nil {
+		return nil, err
+	}
+
+	progress(FirmwareVerifying, 100)
+	if !applied(after) {
+		return after, fmt.Errorf("%w: it went from %s to %s", ErrFirmwareNotApplied, before.SoftwareVersion,
+			after.SoftwareVersion)
+	}
+	progress(FirmwareDone, 100)
+	return after, nil
+}
+
+// compatibleWith makes sure the update is meant for the device and the device is in a state to take it
+func (update FirmwareUpdate) compatibleWith(sysInfo *SystemInfo) error {
+	switch {
+	case update.URL == "":
+		return errors.New("firmware update has no URL")
+	case update.Model == "":
+		return fmt.Errorf("%w: no model given for the firmware, refusing to guess", ErrFirmwareMismatch)
+	case update.Model != sysInfo.Model:
+		return fmt.Errorf("%w: firmware is for %s, device is a %s", ErrFirmwareMismatch, update.Model, sysInfo.Model)
+	case update.HardwareVersion != "" && update.HardwareVersion != sysInfo.HardwareVersion:
+		return fmt.Errorf("%w: firmware is for hardware %s, device is hardware %s", ErrFirmwareMismatch,
+			update.HardwareVersion, sysInfo.HardwareVersion)
+	case update.Version != "" && update.Version == sysInfo.SoftwareVersion:
+		return fmt.Errorf("%w: %s", ErrFirmwareCurrent, sysInfo.SoftwareVersion)
+	case sysInfo.Updating != 0:
+		return errors.New("the device is already in the middle of an update")
+	}
+	return nil
+}
+
+// waitForDownload polls the download state until the device has all of the firmware. The device going idle or
+// reporting an error status before then, or the download not getting any further for stallTimeout, is
+// ErrFirmwareDownload.
+func (kpp *KasaPowerPlug) waitForDownload(ctx context.Context, interval, stallTimeout time.Duration,
+	progress func(FirmwareStage, int)) (*downloadState, error) {
+	var (
+		lastRatio = -1
+		moved     = time.Now()
+	)
+	for {
+		var response, err = kpp.query(ctx, kpp.Unsafe.GetDownloadState())
+		if err != nil {
+			return nil, err
+		}
+		if response.System == nil {
+			return nil, errNoAnswer("system", "get_download_state")
+		}
+		if response.System.DownloadState == nil {
+			return nil, response.System.missing("system", "get_download_state")
+		}
+		var state = response.System.DownloadState
+		if err = state.err("system", "get_download_state"); err != nil {
+			return nil, err
+		}
+		switch {
+		case state.Status != downloadIdle && state.Status != downloadInProgress && state.Status != downloadDone:
+			return nil, fmt.Errorf("%w: download status %d at %d%%", ErrFirmwareDownload, state.Status, state.Ratio)
+		case state.Ratio >= 100 || state.Status == downloadDone:
+			progress(FirmwareDownloading, 100)
+			return state, nil
+		case state.Status == downloadIdle:
+			return nil, fmt.Errorf("%w: it went idle at %d%%", ErrFirmwareDownload, state.Ratio)
+		}
+		if state.Ratio != lastRatio {
+			lastRatio, moved = state.Ratio, time.Now()
+			progress(FirmwareDownloading, state.Ratio)
+		} else if time.Since(moved) >= stallTimeout {
+			return nil, fmt.Errorf("%w: stuck at %d%% for %s", ErrFirmwareDownload, state.Ratio, stallTimeout)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// waitForReboot hangs up on the device and waits for it to come back running the new firmware. A device keeps
+// answering with its old sw_ver while it's flashing, so until it's had settle (the flash and reboot time it asked
+// for) or has dropped off to reboot, answers that aren't applied don't count. After that it gets timeout to answer
+// with updating back at 0, and whatever it says then is what it's running.
+func (kpp *KasaPowerPlug) waitForReboot(ctx context.Context, settle, timeout, interval time.Duration,
+	applied func(*SystemInfo) bool) (*SystemInfo, error) {
+	kpp.closer()
+	kpp.tplinkClient = nil
+	var rebootCtx, cancel = context.WithTimeout(ctx, settle+timeout)
+	defer cancel()
+	var (
+		settled    = time.Now().Add(settle)
+		droppedOff bool
+	)
+	for {
+		var attemptCtx, cancelAttempt = context.WithTimeout(rebootCtx, exchangeTimeout)
+		var sysInfo, err = kpp.fetchSystemInfo(attemptCtx)
+		cancelAttempt()
+		switch {
+		case err != nil:
+			droppedOff = true
+		case sysInfo.Updating != 0:
+		case applied(sysInfo) || droppedOff || !time.Now().Before(settled):
+			return sysInfo, nil
+		}
+		select {
+		case <-rebootCtx.Done():
+			if err == nil {
+				err = errors.New("it's still updating")
+			}
+			return nil, fmt.Errorf("the device didn't come back after flashing: %w", err)
+		case <-time.After(interval):
+		}
+	}
+}
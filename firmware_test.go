@@ -0,0 +1,96 @@
+package kasalink
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestKasaPowerPlug_UpdateFirmware(t *testing.T) {
+	if !useMock {
+		t.Skip("not flashing a real plug from a test")
+	}
+	var mp, err = NewMockPlug()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mp.Close()
+	var kpp *KasaPowerPlug
+	if kpp, err = NewKasaPowerPlug(mp.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	var ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var wrongModel = FirmwareUpdate{URL: "http://example.com/hs100.bin", Model: "HS100(US)"}
+	if _, err = kpp.UpdateFirmware(ctx, wrongModel, FirmwareOptions{}); !errors.Is(err, ErrFirmwareMismatch) {
+		t.Fatalf("expected ErrFirmwareMismatch, got %v", err)
+	}
+
+	var fws []FirmwareInfo
+	if fws, err = kpp.CloudFirmwareList(ctx); err != nil {
+		t.Fatal(err)
+	}
+	var (
+		stages []FirmwareStage
+		after  *SystemInfo
+	)
+	after, err = kpp.UpdateFirmware(ctx, FirmwareUpdateFromCloud(kpp.SysInfo, fws[0]), FirmwareOptions{
+		PollInterval: time.Millisecond,
+		Progress: func(p FirmwareProgress) {
+			t.Logf("%s %d%%", p.Stage, p.Percent)
+			if len(stages) == 0 || stages[len(stages)-1] != p.Stage {
+				stages = append(stages, p.Stage)
+			}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.SoftwareVersion != mockFirmwareVersion {
+		t.Fatalf("expected %s after flashing, got %s", mockFirmwareVersion, after.SoftwareVersion)
+	}
+	if len(stages) != 5 || stages[4] != FirmwareDone {
+		t.Fatalf("expected every stage in order, got %v", stages)
+	}
+}
+
+func TestKasaPowerPlug_UpdateFirmwareBadDownload(t *testing.T) {
+	if !useMock {
+		t.Skip("not flashing a real plug from a test")
+	}
+	for _, tc := range []struct {
+		name            string
+		failAt, stallAt int
+	}{
+		{name: "failed", failAt: 80},
+		{name: "stalled", stallAt: 40},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var mp, err = NewMockPlug()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mp.Close()
+			mp.firmware.failAt, mp.firmware.stallAt = tc.failAt, tc.stallAt
+			var kpp *KasaPowerPlug
+			if kpp, err = NewKasaPowerPlug(mp.Addr()); err != nil {
+				t.Fatal(err)
+			}
+			var ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			var update = FirmwareUpdate{URL: "http://example.com/hs300.bin", Model: kpp.SysInfo.Model}
+			_, err = kpp.UpdateFirmware(ctx, update, FirmwareOptions{
+				PollInterval: time.Millisecond,
+				StallTimeout: 50 * time.Millisecond,
+			})
+			if !errors.Is(err, ErrFirmwareDownload) {
+				t.Fatalf("expected ErrFirmwareDownload, got %v", err)
+			}
+			if mp.firmware.flashed {
+				t.Error("flashed a download that didn't finish")
+			}
+		})
+	}
+}
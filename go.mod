@@ -1,6 +1,9 @@
 module github.com/PaulSRock/kasalink
 
+go 1.16
+
 require (
 	github.com/google/uuid v1.1.0
 	github.com/reef-pi/hal v0.0.0-20190129094001-59f71ac9bc12
+	gopkg.in/yaml.v3 v3.0.1
 )
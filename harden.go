@@ -0,0 +1,81 @@
+package kasalink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// NoCloudServer is where Harden points devices, nothing will ever answer them there
+const NoCloudServer = "127.0.0.1"
+
+// ErrNotHardened means the device said yes to everything Harden asked, but its cloud settings didn't stick
+var ErrNotHardened = errors.New("the device's cloud settings didn't change")
+
+// HardenResult is what Harden found on a device, and what it left behind. Keep it somewhere safe, Original is what
+// you'll need to hand RestoreCloud later.
+type HardenResult struct {
+	DeviceID string      `json:"device_id"`
+	Alias    string      `json:"alias"`
+	Address  string      `json:"address"`
+	Original CloudStatus `json:"original"`
+	Final    CloudStatus `json:"final"`
+}
+
+// Harden cuts the device off from the TP-Link cloud: it's unbound from its cloud account and pointed at
+// NoCloudServer so it stops phoning home. Everything else about the device keeps working on the LAN.
+func (kpp *KasaPowerPlug) Harden(ctx context.Context) (*HardenResult, error) {
+	return kpp.HardenTo(ctx, NoCloudServer)
+}
+
+// HardenTo is Harden, but you pick the server the device gets pointed at (a local one, or another dead address)
+func (kpp *KasaPowerPlug) HardenTo(ctx context.Context, server string) (*HardenResult, error) {
+	var sysInfo, err = kpp.fetchSystemInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		result = &HardenResult{
+			DeviceID: sysInfo.DeviceID,
+			Alias:    sysInfo.Alias,
+			Address:  kpp.plugNetworkLocation,
+		}
+		status *CloudStatus
+	)
+	if status, err = kpp.GetCloudStatus(ctx); err != nil {
+		return nil, err
+	}
+	result.Original = *status
+	if status.Binded {
+		if err = kpp.UnbindCloud(ctx); err != nil {
+			return result, err
+		}
+	}
+	if status.Server != server {
+		if err = kpp.SetCloudServer(ctx, server); err != nil {
+			return result, err
+		}
+	}
+	if status, err = kpp.GetCloudStatus(ctx); err != nil {
+		return result, err
+	}
+	result.Final = *status
+	if status.Binded || status.Server != server {
+		return result, fmt.Errorf("%w: %s is bound: %t, server: %s", ErrNotHardened, result.DeviceID, status.Binded,
+			status.Server)
+	}
+	if kpp.log != nil {
+		kpp.log.Printf("Hardened %s (%s), it was on %s and bound: %t", result.Alias, result.DeviceID,
+			result.Original.Server, result.Original.Binded)
+	}
+	return result, nil
+}
+
+// RestoreCloud puts the device back on the cloud server it had before Harden. It can't bind the device to its old
+// account again, that takes the account's password, so if original.Binded is set use BindCloud afterwards.
+func (kpp *KasaPowerPlug) RestoreCloud(ctx context.Context, original CloudStatus) error {
+	if original.Server == "" {
+		return errors.New("nothing to restore, the original cloud server is blank")
+	}
+	return kpp.SetCloudServer(ctx, original.Server)
+}
@@ -0,0 +1,54 @@
+package kasalink
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestKasaPowerPlug_Harden(t *testing.T) {
+	var s, err = NewSimulator(SimulatorConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var device Device
+	if device, err = NewDevice(ctx, s.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	defer device.Close()
+	var kpp = device.(*KasaPowerPlug)
+	if err = kpp.BindCloud(ctx, "reefer@example.com", "hunter2"); err != nil {
+		t.Fatal(err)
+	}
+	var result *HardenResult
+	if result, err = kpp.Harden(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !result.Original.Binded || result.Original.Server != DefaultCloudServer ||
+		result.Original.Username != "reefer@example.com" {
+		t.Errorf("original settings weren't recorded: %+v", result.Original)
+	}
+	var status *CloudStatus
+	if status, err = kpp.GetCloudStatus(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if status.Binded || status.Server != NoCloudServer || *status != result.Final {
+		t.Errorf("hardened device is %+v, Harden said %+v", status, result.Final)
+	}
+
+	if err = kpp.RestoreCloud(ctx, result.Original); err != nil {
+		t.Fatal(err)
+	}
+	if err = kpp.BindCloud(ctx, result.Original.Username, "hunter2"); err != nil {
+		t.Fatal(err)
+	}
+	if status, err = kpp.GetCloudStatus(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if *status != result.Original {
+		t.Errorf("restored device is %+v, it was %+v", status, result.Original)
+	}
+}
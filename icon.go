@@ -0,0 +1,91 @@
+package kasalink
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+
+	// icons come off the device as PNG or JPEG
+	_ "image/jpeg"
+)
+
+// MaxIconBytes is the biggest icon (before base64) SetDeviceIconData will send. The whole command has to fit in the
+// device's receive buffer, and the Kasa app's own icons are a fraction of this.
+const MaxIconBytes = 16 * 1024
+
+var (
+	// ErrNoIcon means the device (or outlet) doesn't have an icon set
+	ErrNoIcon = errors.New("no icon set")
+	// ErrIconTooLarge means the icon is bigger than MaxIconBytes
+	ErrIconTooLarge = fmt.Errorf("icon is bigger than %d bytes", MaxIconBytes)
+)
+
+// IconHash is the hash that goes along with an icon, an MD5 of the image file (not of the base64), in hex
+func IconHash(data []byte) string {
+	var sum = md5.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// DeviceIcon gets the icon for the device (or for one outlet on it, pass the child), along with its hash. You get
+// ErrNoIcon if there isn't one set.
+func (kpp *KasaPowerPlug) DeviceIcon(ctx context.Context, children ...int) (image.Image, string, error) {
+	var response, err = kpp.query(ctx, getDeviceIcon, children...)
+	if err != nil {
+		return nil, "", err
+	}
+	if response.System == nil {
+		return nil, "", errNoAnswer("system", "get_dev_icon")
+	}
+	if response.System.GetDevIcon == nil {
+		return nil, "", response.System.missing("system", "get_dev_icon")
+	}
+	var icon = response.System.GetDevIcon
+	if err = icon.err("system", "get_dev_icon"); err != nil {
+		return nil, "", err
+	}
+	if icon.Icon == "" {
+		return nil, icon.Hash, ErrNoIcon
+	}
+	var data []byte
+	if data, err = base64.StdEncoding.DecodeString(icon.Icon); err != nil {
+		return nil, icon.Hash, fmt.Errorf("icon isn't valid base64: %w", err)
+	}
+	var img image.Image
+	if img, _, err = image.Decode(bytes.NewReader(data)); err != nil {
+		return nil, icon.Hash, err
+	}
+	return img, icon.Hash, nil
+}
+
+// SetDeviceIconData sets the icon for the device (or for the given outlets) from a PNG or JPEG file's contents. The
+// base64 encoding and hash are taken care of.
+func (kpp *KasaPowerPlug) SetDeviceIconData(ctx context.Context, data []byte, children ...int) error {
+	if len(data) > MaxIconBytes {
+		return fmt.Errorf("%w: it's %d bytes", ErrIconTooLarge, len(data))
+	}
+	var _, format, err = image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("icon isn't an image: %w", err)
+	}
+	if format != "png" && format != "jpeg" {
+		return fmt.Errorf("icons have to be PNG or JPEG, not %s", format)
+	}
+	return kpp.system(ctx, fmt.Sprintf(setDeviceIconFormatString,
+		jsonString(base64.StdEncoding.EncodeToString(data)), jsonString(IconHash(data))), "set_dev_icon", children...)
+}
+
+// SetDeviceIconImage is SetDeviceIconData for an image you've got in memory, it goes over as a PNG. Keep it small,
+// a 64x64 icon is plenty.
+func (kpp *KasaPowerPlug) SetDeviceIconImage(ctx context.Context, img image.Image, children ...int) error {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return err
+	}
+	return kpp.SetDeviceIconData(ctx, buf.Bytes(), children...)
+}
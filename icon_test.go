@@ -0,0 +1,46 @@
+package kasalink
+
+import (
+	"context"
+	"errors"
+	"image"
+	"testing"
+)
+
+func TestKasaPowerPlug_DeviceIcon(t *testing.T) {
+	var (
+		kpp  *KasaPowerPlug
+		img  image.Image
+		hash string
+		err  error
+	)
+	mockOrNot(&kpp, t)
+	img, hash, err = kpp.DeviceIcon(context.Background(), 0)
+	if errors.Is(err, ErrNoIcon) {
+		t.Skip("no icon set on outlet 0")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("%v icon, hash %s", img.Bounds(), hash)
+	if useMock && (img.Bounds().Dx() != 4 || hash != "cfc3107d543e7f1c9c0bcb179fefa795") {
+		t.Fatalf("unexpected icon %v with hash %s", img.Bounds(), hash)
+	}
+}
+
+func TestKasaPowerPlug_SetDeviceIconData(t *testing.T) {
+	if !useMock {
+		t.Skip("not changing a real plug's icon from a test")
+	}
+	var kpp *KasaPowerPlug
+	mockOrNot(&kpp, t)
+	if err := kpp.SetDeviceIconImage(context.Background(), image.NewRGBA(image.Rect(0, 0, 64, 64)), 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := kpp.SetDeviceIconData(context.Background(), make([]byte, MaxIconBytes+1)); !errors.Is(err, ErrIconTooLarge) {
+		t.Fatalf("expected ErrIconTooLarge, got %v", err)
+	}
+	if err := kpp.SetDeviceIconData(context.Background(), []byte("not an image")); err == nil {
+		t.Fatal("expected garbage to be refused")
+	}
+}
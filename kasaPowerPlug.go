@@ -1,7 +1,9 @@
 package kasalink
 
 import (
+	"context"
 	"encoding/binary"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
@@ -20,6 +22,8 @@ type KasaPowerPlug struct {
 	SysInfo             *SystemInfo
 	log                 *log.Logger
 	debug               bool
+	// udp sends every command as a datagram instead of over TCP, see talkOverUDP
+	udp bool
 }
 
 // NewKasaPowerPlug gives you a new KasaPowerPlug struct that's already gotten it's system info, or an error
@@ -29,6 +33,7 @@ func NewKasaPowerPlug(plugAddress string) (kpp *KasaPowerPlug, err error) {
 		plugNetworkLocation: plugAddress,
 		timeout:             5 * time.Second,
 	}
+	kpp.Unsafe.kpp = kpp
 	kpp.SysInfo, err = kpp.GetSystemInfo()
 	if err != nil {
 		return nil, err
@@ -44,16 +49,31 @@ func (kpp *KasaPowerPlug) SetLogger(newLogger *log.Logger) {
 
 // TalkToPlug sends a command to the plug and returns a response json and error error
 func (kpp *KasaPowerPlug) talkToPlug(KasaCommand string) (response []byte, err error) {
+	return kpp.talkToPlugContext(context.Background(), KasaCommand)
+}
+
+// talkToPlugContext is talkToPlug, but it gives up as soon as ctx is done. If anything goes wrong mid conversation
+// the connection is dropped, so the next call starts over with a fresh one instead of reading half of an old answer.
+func (kpp *KasaPowerPlug) talkToPlugContext(ctx context.Context, KasaCommand string) (response []byte, err error) {
 	var (
-		bitsToSend []byte
-		bitsWeRead []byte
+		bitsToSend       []byte
+		bitsWeRead       []byte
+		deadline         time.Time
+		usingCtxDeadline bool
 	)
 
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	if kpp.udp {
+		return kpp.talkOverUDP(ctx, KasaCommand)
+	}
 	if kpp.tplinkClient == nil {
 		if kpp.timeout == 0 {
 			kpp.timeout = time.Duration(10) * time.Second
 		}
-		if kpp.tplinkClient, err = net.DialTimeout("tcp", kpp.plugNetworkLocation, kpp.timeout); err != nil {
+		var dialer = net.Dialer{Timeout: kpp.timeout}
+		if kpp.tplinkClient, err = dialer.DialContext(ctx, "tcp", kpp.plugNetworkLocation); err != nil {
 			return
 		}
 	}
@@ -63,9 +83,25 @@ func (kpp *KasaPowerPlug) talkToPlug(KasaCommand string) (response []byte, err e
 	// the tcp connection, and we end with a "use of closed network connection" error
 	//defer kpp.closer()
 
-	if err = kpp.tplinkClient.SetDeadline(time.Now().Add(5 * time.Second)); err != nil {
+	deadline, usingCtxDeadline = exchangeDeadline(ctx)
+	if err = kpp.tplinkClient.SetDeadline(deadline); err != nil {
 		return nil, err
 	}
+	var stopWatching = kpp.watchContext(ctx)
+	defer func() {
+		stopWatching()
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() && usingCtxDeadline {
+				// the connection deadline can beat ctx to noticing its own deadline by a hair
+				err = context.DeadlineExceeded
+			}
+			if ctx.Err() != nil {
+				err = ctx.Err()
+			}
+			kpp.closer()
+			kpp.tplinkClient = nil
+		}
+	}()
 
 	bitsToSend = encrypt(KasaCommand)
 	if _, err = kpp.tplinkClient.Write(bitsToSend); err != nil {
@@ -83,6 +119,130 @@ func (kpp *KasaPowerPlug) talkToPlug(KasaCommand string) (response []byte, err e
 	return bitsWeRead, nil
 }
 
+// talkOverUDP sends KasaCommand as a datagram and waits for the answer. There's no connection to keep, and no
+// telling if the command or its answer got lost, so the command goes out again every udpRetryInterval until an
+// answer comes back or the exchangeDeadline passes. Only send commands that are safe to repeat.
+func (kpp *KasaPowerPlug) talkOverUDP(ctx context.Context, KasaCommand string) ([]byte, error) {
+	var conn, err = net.Dial("udp", kpp.plugNetworkLocation)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var deadline, _ = exchangeDeadline(ctx)
+	var (
+		datagram = encryptDatagram(KasaCommand)
+		buf      = make([]byte, 64*1024)
+		n        int
+	)
+	for {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if _, err = conn.Write(datagram); err != nil {
+			return nil, err
+		}
+		var attemptDeadline = time.Now().Add(udpRetryInterval)
+		if attemptDeadline.After(deadline) {
+			attemptDeadline = deadline
+		}
+		if err = conn.SetReadDeadline(attemptDeadline); err != nil {
+			return nil, err
+		}
+		if n, err = conn.Read(buf); err == nil {
+			break
+		}
+		if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() {
+			return nil, err
+		}
+		if !time.Now().Before(deadline) {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, err
+		}
+	}
+	var bitsWeRead = decrypt(buf[:n])
+	if kpp.debug && kpp.log != nil {
+		kpp.log.Printf("Received:\n%s\n", bitsWeRead)
+	}
+	return bitsWeRead, nil
+}
+
+// exchangeTimeout is how long the device gets to answer a command, unless ctx runs out sooner
+const exchangeTimeout = 5 * time.Second
+
+// exchangeTimeoutKey is the context key for withExchangeTimeout
+type exchangeTimeoutKey struct{}
+
+// withExchangeTimeout gives commands sent with ctx d to answer instead of exchangeTimeout, for the few the device
+// takes longer than that over
+func withExchangeTimeout(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, exchangeTimeoutKey{}, d)
+}
+
+// exchangeDeadline is when the device has to have answered a command sent with ctx by: exchangeTimeout (or what
+// withExchangeTimeout says) from now, or ctx's deadline if that's sooner, in which case fromCtx is true
+func exchangeDeadline(ctx context.Context) (deadline time.Time, fromCtx bool) {
+	var timeout = exchangeTimeout
+	if d, ok := ctx.Value(exchangeTimeoutKey{}).(time.Duration); ok {
+		timeout = d
+	}
+	deadline = time.Now().Add(timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		return ctxDeadline, true
+	}
+	return deadline, false
+}
+
+// udpRetryInterval is how long talkOverUDP waits for an answer before sending the command again
+const udpRetryInterval = 500 * time.Millisecond
+
+// watchContext kicks any read or write blocked on the current connection loose once ctx is done. Call the returned
+// func to stop watching, it won't return until the watcher is gone.
+func (kpp *KasaPowerPlug) watchContext(ctx context.Context) (stop func()) {
+	if ctx.Done() == nil {
+		return func() {}
+	}
+	var (
+		conn   = kpp.tplinkClient
+		done   = make(chan struct{})
+		exited = make(chan struct{})
+	)
+	go func() {
+		defer close(exited)
+		select {
+		case <-ctx.Done():
+			_ = conn.SetDeadline(time.Unix(1, 0))
+		case <-done:
+		}
+	}()
+	return func() {
+		close(done)
+		<-exited
+	}
+}
+
+// query sends cmd to the plug (or to the given children of the plug) and decodes whatever comes back
+func (kpp *KasaPowerPlug) query(ctx context.Context, cmd string, children ...int) (*KasaResponse, error) {
+	var (
+		jsonBytes []byte
+		response  = &KasaResponse{}
+		err       error
+	)
+	if children != nil {
+		jsonBytes, err = kpp.tellChildContext(ctx, cmd, children...)
+	} else {
+		jsonBytes, err = kpp.talkToPlugContext(ctx, cmd)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(jsonBytes, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
 func (kpp *KasaPowerPlug) readResponse() ([]byte, error) {
 	var (
 		bodySize uint32
@@ -101,13 +261,52 @@ func (kpp *KasaPowerPlug) readResponse() ([]byte, error) {
 	return buf, nil
 }
 
+// system sends a single system method that only answers with an err_code (to the given children, if any), and
+// checks it
+func (kpp *KasaPowerPlug) system(ctx context.Context, cmd, method string, children ...int) error {
+	var response, err = kpp.query(ctx, cmd, children...)
+	if err != nil {
+		return err
+	}
+	if response.System == nil {
+		return errNoAnswer("system", method)
+	}
+	var answer *thingWithErrCode
+	switch method {
+	case "download_firmware":
+		answer = response.System.DownloadFw
+	case "flash_firmware":
+		answer = response.System.FlashFw
+	case "set_led_off":
+		answer = response.System.SetLED
+	case "set_dev_alias":
+		answer = response.System.SetDevAlias
+	case "set_dev_location":
+		answer = response.System.SetDevLocation
+	case "set_dev_icon":
+		answer = response.System.SetDevIcon
+	}
+	if answer == nil {
+		return response.System.missing("system", method)
+	}
+	return answer.err("system", method)
+}
+
 // tellChild is the JSON used to issue a command to individual sockets on a Kasa enabled device
 func (kpp *KasaPowerPlug) tellChild(cmd string, children ...int) ([]byte, error) {
+	return kpp.tellChildContext(context.Background(), cmd, children...)
+}
+
+// tellChildContext is tellChild, but it gives up as soon as ctx is done
+func (kpp *KasaPowerPlug) tellChildContext(ctx context.Context, cmd string, children ...int) ([]byte, error) {
 	var (
 		sb  strings.Builder
 		err error
 	)
 
+	if err = kpp.requireChildren(children); err != nil {
+		return nil, err
+	}
 	if _, err = sb.WriteString(`{"context":{"child_ids":[`); err != nil {
 		return nil, err
 	}
@@ -121,7 +320,7 @@ func (kpp *KasaPowerPlug) tellChild(cmd string, children ...int) ([]byte, error)
 	}
 	//log.Printf("Child Call: %s\n", sb.String())
 	//log.Printf("Child Call Trimmed: %s\n", trimJSONArray(sb.String()))
-	return kpp.talkToPlug(trimJSONArray(sb.String()))
+	return kpp.talkToPlugContext(ctx, trimJSONArray(sb.String()))
 }
 
 // Close tells the client to close any active connection it might have to the power strip/plug
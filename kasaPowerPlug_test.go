@@ -1 +1,42 @@
 package kasalink
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestExchangeDeadline(t *testing.T) {
+	// a long lived ctx doesn't stretch the time the device gets to answer
+	var ctx, cancel = context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	if deadline, fromCtx := exchangeDeadline(ctx); fromCtx || time.Until(deadline) > exchangeTimeout {
+		t.Errorf("an hour long ctx gave the device until %s", deadline)
+	}
+	if deadline, _ := exchangeDeadline(withExchangeTimeout(ctx, time.Minute)); time.Until(deadline) < 59*time.Second {
+		t.Errorf("a minute long exchange timeout gave the device until %s", deadline)
+	}
+	var short, cancelShort = context.WithTimeout(ctx, time.Second)
+	defer cancelShort()
+	if _, fromCtx := exchangeDeadline(short); !fromCtx {
+		t.Error("a ctx that's done sooner didn't win")
+	}
+
+	var s, err = NewSimulator(SimulatorConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	var kpp = &KasaPowerPlug{plugNetworkLocation: s.Addr()}
+	defer kpp.Close()
+	s.SetFaults(Faults{Latency: 300 * time.Millisecond})
+	var started = time.Now()
+	_, err = kpp.query(withExchangeTimeout(ctx, 100*time.Millisecond), getSysInfo)
+	if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() || time.Since(started) > time.Second {
+		t.Errorf("got %v after %s, not a timeout after 100ms", err, time.Since(started))
+	}
+	if _, err = kpp.query(ctx, getSysInfo); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,241 @@
+package kasalink
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+const (
+	lightStripModule     = "smartlife.iot.lightStrip"
+	lightingEffectModule = "smartlife.iot.lighting_effect"
+	getLightingEffect    = `{"smartlife.iot.lighting_effect":{"get_lighting_effect":{}}}`
+)
+
+// ErrUnknownEffect means the effect name isn't one of BuiltinEffects
+var ErrUnknownEffect = errors.New("not a built in effect")
+
+// LightingEffect is an animated effect for a light strip, filled in for its Type: a "sequence" (or no Type, like the
+// built in ones) steps through Sequence, a "random" picks colors from the ranges.
+type LightingEffect struct {
+	Name   string `json:"name"`
+	ID     string `json:"id,omitempty"`
+	Enable int    `json:"enable"`
+	// Custom is 1 for effects that were uploaded, 0 for built in ones
+	Custom     int    `json:"custom"`
+	Brightness int    `json:"brightness,omitempty"`
+	Type       string `json:"type,omitempty"`
+	// Segments are the zones the effect plays on
+	Segments          []int `json:"segments,omitempty"`
+	ExpansionStrategy int   `json:"expansion_strategy,omitempty"`
+	// Duration and Transition are in milliseconds
+	Duration    int `json:"duration,omitempty"`
+	Transition  int `json:"transition,omitempty"`
+	Direction   int `json:"direction,omitempty"`
+	Spread      int `json:"spread,omitempty"`
+	RepeatTimes int `json:"repeat_times,omitempty"`
+	// Sequence is [hue, saturation, brightness] steps, for sequence effects
+	Sequence [][]int `json:"sequence,omitempty"`
+	// HueRange, SaturationRange and BrightnessRange are [min, max], for random effects
+	HueRange        []int `json:"hue_range,omitempty"`
+	SaturationRange []int `json:"saturation_range,omitempty"`
+	BrightnessRange []int `json:"brightness_range,omitempty"`
+	TransitionRange []int `json:"transition_range,omitempty"`
+	Fadeoff         int   `json:"fadeoff,omitempty"`
+	RandomSeed      int   `json:"random_seed,omitempty"`
+	// InitStates and Backgrounds are [hue, saturation, brightness], for random effects
+	InitStates  [][]int `json:"init_states,omitempty"`
+	Backgrounds [][]int `json:"backgrounds,omitempty"`
+}
+
+// ZoneColor is a color for a run of zones on a light strip, Start to End inclusive
+type ZoneColor struct {
+	Start int
+	End   int
+	// Hue (0-360) and Saturation (0-100) only count while ColorTemp is 0
+	Hue        int
+	Saturation int
+	ColorTemp  int
+	Brightness int
+}
+
+// LightStrip is a Kasa light strip, like the KL430. Everything a Bulb does works on a strip too, on every zone at
+// once, with zone colors and animated effects on top.
+type LightStrip struct {
+	*Bulb
+}
+
+// NewLightStrip gives you a LightStrip that's already gotten its system info
+func NewLightStrip(ctx context.Context, address string) (*LightStrip, error) {
+	var b, err = NewBulb(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	return newLightStrip(b.kpp), nil
+}
+
+// newLightStrip takes over a KasaPowerPlug that's already talked to a light strip
+func newLightStrip(kpp *KasaPowerPlug) *LightStrip {
+	var ls = &LightStrip{Bulb: newBulb(kpp)}
+	ls.service, ls.setMethod = lightStripModule, "set_light_state"
+	return ls
+}
+
+// Zones is how many zones the strip has, going by its system info
+func (ls *LightStrip) Zones() (int, error) {
+	var sysInfo, err = ls.kpp.GetSystemInfo()
+	if err != nil {
+		return 0, err
+	}
+	return sysInfo.Length, nil
+}
+
+// SetZoneColors turns the strip on showing the given colors, zones that aren't in any of them are left alone
+func (ls *LightStrip) SetZoneColors(ctx context.Context, zones []ZoneColor, transition time.Duration) (*LightState,
+	error) {
+	var count, err = ls.Zones()
+	if err != nil {
+		return nil, err
+	}
+	if len(zones) == 0 {
+		return nil, errors.New("no zone colors to set")
+	}
+	var groups = make([][]int, 0, len(zones))
+	for _, zone := range zones {
+		switch {
+		case zone.Start < 0 || zone.End < zone.Start || (count > 0 && zone.End >= count):
+			return nil, fmt.Errorf("zones %d to %d aren't on a strip with %d zones", zone.Start, zone.End, count)
+		case zone.Hue < 0 || zone.Hue > MaxHue || zone.Saturation < 0 || zone.Saturation > MaxSaturation:
+			return nil, fmt.Errorf("hue %d saturation %d isn't a color", zone.Hue, zone.Saturation)
+		case zone.ColorTemp != 0 && (zone.ColorTemp < MinColorTemp || zone.ColorTemp > MaxColorTemp):
+			return nil, fmt.Errorf("color temperature has to be %d to %d kelvin, not %d", MinColorTemp,
+				MaxColorTemp, zone.ColorTemp)
+		case zone.Brightness < 0 || zone.Brightness > MaxBrightness:
+			return nil, fmt.Errorf("brightness has to be 0 to %d, not %d", MaxBrightness, zone.Brightness)
+		}
+		groups = append(groups, []int{zone.Start, zone.End, zone.Hue, zone.Saturation, zone.ColorTemp,
+			zone.Brightness})
+	}
+	return ls.transition(ctx, map[string]interface{}{"on_off": 1, "groups": groups}, transition)
+}
+
+// Effect asks the strip which effect it's set to, Enable says if it's playing
+func (ls *LightStrip) Effect(ctx context.Context) (*LightingEffect, error) {
+	var module, err = ls.lightingEffect(ctx, getLightingEffect, "get_lighting_effect")
+	if err != nil {
+		return nil, err
+	}
+	var effect = module.GetLightingEffect.LightingEffect
+	return &effect, nil
+}
+
+// Effects lists the names of the effects the strip can play: the BuiltinEffects, and the custom effect it was last
+// sent if that was one. The strip only keeps the custom effect it's been given most recently, so that's the only one
+// that shows up, and playing it again means uploading it again.
+func (ls *LightStrip) Effects(ctx context.Context) ([]string, error) {
+	var current, err = ls.Effect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var names = make([]string, 0, len(BuiltinEffects)+1)
+	for _, effect := range BuiltinEffects {
+		names = append(names, effect.Name)
+	}
+	if current.Custom == 1 && current.Name != "" {
+		names = append(names, current.Name)
+	}
+	return names, nil
+}
+
+// SetEffect starts one of the BuiltinEffects playing
+func (ls *LightStrip) SetEffect(ctx context.Context, name string) error {
+	var effect, known = builtinEffect(name)
+	if !known {
+		return fmt.Errorf("%w: %q", ErrUnknownEffect, name)
+	}
+	return ls.setLightingEffect(ctx, &effect)
+}
+
+// UploadEffect sends the strip a custom effect and starts it playing. An effect without an ID gets a new one, which
+// is left in effect.ID, and re-uploading with the same ID replaces the one on the strip.
+func (ls *LightStrip) UploadEffect(ctx context.Context, effect *LightingEffect) error {
+	switch {
+	case effect.Name == "":
+		return errors.New("custom effects need a name")
+	case effect.Type != "sequence" && effect.Type != "random":
+		return fmt.Errorf("custom effects are a sequence or random, not %q", effect.Type)
+	case effect.Type == "sequence" && len(effect.Sequence) == 0:
+		return errors.New("a sequence effect needs a sequence")
+	}
+	for _, step := range effect.Sequence {
+		if len(step) != 3 {
+			return fmt.Errorf("sequence steps are [hue, saturation, brightness], not %v", step)
+		}
+	}
+	if effect.ID == "" {
+		var id, err = newEffectID()
+		if err != nil {
+			return err
+		}
+		effect.ID = id
+	}
+	effect.Custom, effect.Enable = 1, 1
+	return ls.setLightingEffect(ctx, effect)
+}
+
+// effectIDLetters are what the Kasa app makes custom effect IDs out of
+const effectIDLetters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+// newEffectID makes up a 32 letter effect ID, the way the Kasa app does
+func newEffectID() (string, error) {
+	var id = make([]byte, 32)
+	for i := range id {
+		var n, err = rand.Int(rand.Reader, big.NewInt(int64(len(effectIDLetters))))
+		if err != nil {
+			return "", err
+		}
+		id[i] = effectIDLetters[n.Int64()]
+	}
+	return string(id), nil
+}
+
+func (ls *LightStrip) setLightingEffect(ctx context.Context, effect *LightingEffect) error {
+	var args, err = json.Marshal(effect)
+	if err != nil {
+		return err
+	}
+	_, err = ls.lightingEffect(ctx, fmt.Sprintf(`{%q:{"set_lighting_effect":%s}}`, lightingEffectModule, args),
+		"set_lighting_effect")
+	return err
+}
+
+// lightingEffect sends a single lighting effect method and makes sure the strip answered it without complaint
+func (ls *LightStrip) lightingEffect(ctx context.Context, cmd, method string) (*lightingEffectResponse, error) {
+	var response, err = ls.kpp.query(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+	if response.LightingEffect == nil {
+		return nil, errNoAnswer(lightingEffectModule, method)
+	}
+	var answer *thingWithErrCode
+	switch method {
+	case "get_lighting_effect":
+		if response.LightingEffect.GetLightingEffect != nil {
+			answer = &response.LightingEffect.GetLightingEffect.thingWithErrCode
+		}
+	case "set_lighting_effect":
+		answer = response.LightingEffect.SetLightingEffect
+	}
+	if answer == nil {
+		return nil, response.LightingEffect.missing(lightingEffectModule, method)
+	}
+	if err = answer.err(lightingEffectModule, method); err != nil {
+		return nil, err
+	}
+	return response.LightingEffect, nil
+}
@@ -0,0 +1,118 @@
+package kasalink
+
+// BuiltinEffects are the effects a KL430 comes with, by the names the Kasa app shows. The firmware needs the whole
+// definition sent with set_lighting_effect, not just the name, so these are what the Kasa app sends for each.
+var BuiltinEffects = []LightingEffect{
+	{
+		Name: "Aurora", ID: "xqUxDhbAhNLqulcuRMyPBmVGyTOyEMEu", Enable: 1, Brightness: 100, Segments: []int{0},
+		ExpansionStrategy: 1, Transition: 1500, Direction: 4, Spread: 7,
+		Sequence: [][]int{{120, 100, 100}, {240, 100, 100}, {260, 100, 100}, {280, 100, 100}},
+	},
+	{
+		Name: "Bubbling Cauldron", ID: "tIwTRQBqJpeNKbrtBMFCgkdPTbAQGfRP", Enable: 1, Brightness: 100,
+		Segments: []int{0}, ExpansionStrategy: 1, Transition: 200, Type: "random", HueRange: []int{100, 270},
+		SaturationRange: []int{80, 100}, BrightnessRange: []int{50, 100}, TransitionRange: []int{200, 2000},
+		InitStates: [][]int{{270, 100, 100}}, Fadeoff: 1000, RandomSeed: 24, Backgrounds: [][]int{{270, 40, 50}},
+	},
+	{
+		Name: "Candy Cane", ID: "HCOttllMkNffeHjEOLEgrFJjbzQHoxEJ", Enable: 1, Brightness: 100,
+		Segments: []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, ExpansionStrategy: 1, Duration: 700, Transition: 500,
+		Direction: 1, Spread: 1,
+		Sequence: [][]int{{0, 0, 100}, {0, 0, 100}, {360, 81, 100}, {0, 0, 100}, {0, 0, 100}, {360, 81, 100},
+			{360, 81, 100}, {0, 0, 100}, {0, 0, 100}, {360, 81, 100}, {360, 81, 100}, {360, 81, 100},
+			{360, 81, 100}, {0, 0, 100}, {0, 0, 100}, {360, 81, 100}},
+	},
+	{
+		Name: "Christmas", ID: "bwTatyinOUajKrDwzMmqxxJdnInQUgvM", Enable: 1, Brightness: 100, Segments: []int{0},
+		ExpansionStrategy: 1, Duration: 5000, Type: "random", HueRange: []int{136, 146},
+		SaturationRange: []int{90, 100}, BrightnessRange: []int{50, 100}, InitStates: [][]int{{136, 0, 100}},
+		Fadeoff: 2000, RandomSeed: 100,
+		Backgrounds: [][]int{{136, 98, 75}, {136, 0, 0}, {350, 0, 100}, {350, 97, 94}},
+	},
+	{
+		Name: "Flicker", ID: "bCTItKETDFfrKANolgldxfgOakaarARs", Enable: 1, Brightness: 100, Segments: []int{1},
+		ExpansionStrategy: 1, Type: "random", HueRange: []int{30, 40}, SaturationRange: []int{100, 100},
+		BrightnessRange: []int{50, 100}, TransitionRange: []int{375, 500}, InitStates: [][]int{{30, 81, 80}},
+	},
+	{
+		Name: "Grandma's Christmas Lights", ID: "bMTNYSnHkOeQBIUFzUhUZnnXVqadnLza", Enable: 1, Brightness: 100,
+		Segments: []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, ExpansionStrategy: 1, Duration: 5000, Transition: 100,
+		Direction: 1, Spread: 1,
+		Sequence: [][]int{{30, 100, 100}, {240, 100, 100}, {130, 100, 100}, {0, 100, 100}, {60, 100, 100},
+			{240, 100, 100}, {130, 100, 100}, {0, 100, 100}, {60, 100, 100}, {30, 100, 100}, {240, 100, 100},
+			{0, 100, 100}, {60, 100, 100}, {130, 100, 100}, {240, 100, 100}, {30, 100, 100}},
+	},
+	{
+		Name: "Hanukkah", ID: "CdLeIgiKcQrLKMINRPTMbylATulQewLD", Enable: 1, Brightness: 100, Segments: []int{1},
+		ExpansionStrategy: 1, Duration: 1500, Type: "random", HueRange: []int{200, 210},
+		SaturationRange: []int{0, 100}, BrightnessRange: []int{50, 100}, TransitionRange: []int{400, 1500},
+		InitStates: [][]int{{35, 81, 80}},
+	},
+	{
+		Name: "Haunted Mansion", ID: "oJnFHsVQzFUTeIOBAhMRfVeujmSauhjJ", Enable: 1, Brightness: 80,
+		Segments: []int{80}, ExpansionStrategy: 2, Type: "random", HueRange: []int{45, 45},
+		SaturationRange: []int{10, 10}, BrightnessRange: []int{0, 80}, TransitionRange: []int{50, 1500},
+		InitStates: [][]int{{45, 10, 100}}, Fadeoff: 200, RandomSeed: 1, Backgrounds: [][]int{{45, 10, 100}},
+	},
+	{
+		Name: "Icicle", ID: "joqVjlaTsgzmuQQBAlHRkkPAqkBUiqeb", Enable: 1, Brightness: 70, Segments: []int{0},
+		ExpansionStrategy: 1, Transition: 400, Direction: 4, Spread: 3,
+		Sequence: [][]int{{190, 100, 70}, {190, 100, 70}, {190, 30, 50}, {190, 100, 70}, {190, 100, 70}},
+	},
+	{
+		Name: "Lightning", ID: "ojqpUUxdGHoIugGPknrUcRoyJiItsjuE", Enable: 1, Brightness: 100,
+		Segments: []int{7, 6, 5, 4, 3, 2, 1, 0}, ExpansionStrategy: 1, Transition: 50, Type: "random",
+		HueRange: []int{240, 240}, SaturationRange: []int{10, 11}, BrightnessRange: []int{90, 100},
+		TransitionRange: []int{50, 200}, InitStates: [][]int{{240, 30, 100}}, Fadeoff: 150, RandomSeed: 600,
+		Backgrounds: [][]int{{200, 100, 100}, {200, 50, 10}, {210, 10, 50}, {240, 10, 0}},
+	},
+	{
+		Name: "Ocean", ID: "oJjUMosgEMrdumfPANKbkFmBcAdEQsPy", Enable: 1, Brightness: 30, Segments: []int{0},
+		ExpansionStrategy: 1, Transition: 2000, Direction: 3, Spread: 16,
+		Sequence: [][]int{{198, 84, 30}, {198, 70, 30}, {198, 10, 30}},
+	},
+	{
+		Name: "Rainbow", ID: "izRhLCQNcDzIKdpMPqSTtBMuAIoreAuT", Enable: 1, Brightness: 100, Segments: []int{0},
+		ExpansionStrategy: 1, Transition: 1500, Direction: 1, Spread: 12,
+		Sequence: [][]int{{0, 100, 100}, {100, 100, 100}, {200, 100, 100}, {300, 100, 100}},
+	},
+	{
+		Name: "Raindrop", ID: "QbDFwiSFmLzQenUOPnJrsGqyIVrJrRsl", Enable: 1, Brightness: 30, Segments: []int{0},
+		ExpansionStrategy: 1, Transition: 1000, Type: "random", HueRange: []int{200, 200},
+		SaturationRange: []int{10, 20}, BrightnessRange: []int{10, 30}, TransitionRange: []int{400, 1000},
+		InitStates: [][]int{{200, 40, 100}}, Fadeoff: 1000, RandomSeed: 24, Backgrounds: [][]int{{200, 40, 0}},
+	},
+	{
+		Name: "Spring", ID: "URdUpEdQbnOOechDBPMkKrwhSupLyypD", Enable: 1, Brightness: 100, Segments: []int{0},
+		ExpansionStrategy: 1, Duration: 600, Type: "random", HueRange: []int{0, 90},
+		SaturationRange: []int{30, 100}, BrightnessRange: []int{90, 100}, TransitionRange: []int{2000, 6000},
+		InitStates: [][]int{{80, 30, 100}}, Fadeoff: 1000, RandomSeed: 20, Backgrounds: [][]int{{130, 100, 40}},
+	},
+	{
+		Name: "Sunrise", ID: "TapOEGVhHdjXHsqTPnUQbBmELHMJIitr", Enable: 1, Brightness: 100, Segments: []int{0},
+		ExpansionStrategy: 2, Duration: 600, Transition: 60000, Direction: 1, Spread: 1, RepeatTimes: 1,
+		Sequence: [][]int{{30, 0, 100}, {30, 95, 100}, {30, 100, 100}},
+	},
+	{
+		Name: "Sunset", ID: "sHllaQxbTnvDFiFxmbZdfEHRLZFjYVPZ", Enable: 1, Brightness: 100, Segments: []int{0},
+		ExpansionStrategy: 2, Duration: 600, Transition: 60000, Direction: 1, Spread: 1, RepeatTimes: 1,
+		Sequence: [][]int{{30, 100, 100}, {30, 95, 100}, {30, 0, 100}},
+	},
+	{
+		Name: "Valentines", ID: "QglBhMShPHUAuxLqzNEefFrGiJwahOmz", Enable: 1, Brightness: 100, Segments: []int{0},
+		ExpansionStrategy: 1, Duration: 600, Transition: 2000, Type: "random", HueRange: []int{340, 340},
+		SaturationRange: []int{30, 40}, BrightnessRange: []int{90, 100}, TransitionRange: []int{2000, 3000},
+		InitStates: [][]int{{340, 30, 100}}, Fadeoff: 3000, RandomSeed: 100,
+		Backgrounds: [][]int{{340, 20, 50}, {20, 50, 50}, {0, 100, 50}},
+	},
+}
+
+// builtinEffect finds one of the BuiltinEffects by name
+func builtinEffect(name string) (LightingEffect, bool) {
+	for _, effect := range BuiltinEffects {
+		if effect.Name == name {
+			return effect, true
+		}
+	}
+	return LightingEffect{}, false
+}
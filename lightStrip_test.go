@@ -0,0 +1,85 @@
+package kasalink
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestLightStrip(t *testing.T) {
+	var mb, err = NewMockLightStrip()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mb.Close()
+	var (
+		ctx    = context.Background()
+		device Device
+		effect *LightingEffect
+	)
+	if device, err = NewDevice(ctx, mb.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	var ls, ok = device.(*LightStrip)
+	if !ok {
+		t.Fatalf("expected a *LightStrip for a KL430, got %T", device)
+	}
+	defer ls.Close()
+
+	if _, err = ls.SetZoneColors(ctx, []ZoneColor{
+		{Start: 0, End: 7, Hue: 220, Saturation: 100, Brightness: 5},
+		{Start: 8, End: 15, Hue: 200, Saturation: 60, Brightness: 3},
+	}, 0); err != nil {
+		t.Fatal(err)
+	}
+	mb.lock.Lock()
+	var zones = mb.zones
+	mb.lock.Unlock()
+	if len(zones) != 2 || zones[1][2] != 200 {
+		t.Fatalf("unexpected zones on the strip %v", zones)
+	}
+	if _, err = ls.SetZoneColors(ctx, []ZoneColor{{Start: 10, End: 16, Brightness: 50}}, 0); err == nil {
+		t.Fatal("expected zone 16 of a 16 zone strip to be refused")
+	}
+
+	if err = ls.SetEffect(ctx, "Ocean"); err != nil {
+		t.Fatal(err)
+	}
+	mb.lock.Lock()
+	var ocean = *mb.effect
+	mb.lock.Unlock()
+	if ocean.Name != "Ocean" || ocean.Enable != 1 || ocean.Custom != 0 || len(ocean.Sequence) != 3 {
+		t.Fatalf("the strip was sent %+v for Ocean", ocean)
+	}
+	if err = ls.SetEffect(ctx, "Reef Crest"); !errors.Is(err, ErrUnknownEffect) {
+		t.Fatalf("expected ErrUnknownEffect, got %v", err)
+	}
+	var storm = &LightingEffect{
+		Name:       "Storm",
+		Type:       "sequence",
+		Brightness: 80,
+		Segments:   []int{0},
+		Transition: 100,
+		Duration:   600,
+		Sequence:   [][]int{{220, 30, 5}, {0, 0, 100}, {220, 30, 5}, {220, 30, 5}},
+	}
+	if err = ls.UploadEffect(ctx, storm); err != nil {
+		t.Fatal(err)
+	}
+	if len(storm.ID) != 32 {
+		t.Fatalf("expected the effect to get a 32 letter ID, got %q", storm.ID)
+	}
+	if effect, err = ls.Effect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if effect.Name != "Storm" || effect.Custom != 1 || effect.Enable != 1 || len(effect.Sequence) != 4 {
+		t.Fatalf("unexpected effect on the strip %+v", effect)
+	}
+	var names []string
+	if names, err = ls.Effects(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != len(BuiltinEffects)+1 || names[0] != "Aurora" || names[len(names)-1] != "Storm" {
+		t.Fatalf("unexpected effect list %v", names)
+	}
+}
@@ -0,0 +1,112 @@
+package kasalink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// locationScale is what the device multiplies degrees by for longitude_i and latitude_i
+const locationScale = 10000
+
+// ErrNoSunrise means the sun doesn't rise or set that day, it's up (or down) all day at that latitude
+var ErrNoSunrise = errors.New("the sun doesn't rise or set that day")
+
+// Location is where a device is, in degrees. Devices use it for sunrise and sunset schedule rules.
+type Location struct {
+	Lat float64
+	Lon float64
+}
+
+// Validate makes sure the Location is somewhere on Earth
+func (l Location) Validate() error {
+	switch {
+	case math.IsNaN(l.Lat) || l.Lat < -90 || l.Lat > 90:
+		return fmt.Errorf("latitude has to be -90 to 90, not %v", l.Lat)
+	case math.IsNaN(l.Lon) || l.Lon < -180 || l.Lon > 180:
+		return fmt.Errorf("longitude has to be -180 to 180, not %v", l.Lon)
+	}
+	return nil
+}
+
+// IsZero is true for the zero Location, which is what a device that's never been told where it is reports
+func (l Location) IsZero() bool {
+	return l.Lat == 0 && l.Lon == 0
+}
+
+func (l Location) String() string {
+	return fmt.Sprintf("%.4f,%.4f", l.Lat, l.Lon)
+}
+
+// Location is the device's location out of its system info, scaled back to degrees
+func (si *SystemInfo) Location() Location {
+	if si.Latitude == 0 && si.Longitude == 0 {
+		return Location{Lat: si.LatitudeV1, Lon: si.LongitudeV1}
+	}
+	return Location{
+		Lat: float64(si.Latitude) / locationScale,
+		Lon: float64(si.Longitude) / locationScale,
+	}
+}
+
+// Location asks the device where it is
+func (kpp *KasaPowerPlug) Location(ctx context.Context) (Location, error) {
+	var sysInfo, err = kpp.fetchSystemInfo(ctx)
+	if err != nil {
+		return Location{}, err
+	}
+	return sysInfo.Location(), nil
+}
+
+// SetLocation tells the device where it is. The device only keeps four decimal places, about 11 meters.
+func (kpp *KasaPowerPlug) SetLocation(ctx context.Context, loc Location) error {
+	if err := loc.Validate(); err != nil {
+		return err
+	}
+	if err := kpp.system(ctx, fmt.Sprintf(latLongFormatString, loc.Lon, loc.Lat), "set_dev_location"); err != nil {
+		return err
+	}
+	if kpp.SysInfo != nil {
+		kpp.SysInfo.Latitude = int(math.Round(loc.Lat * locationScale))
+		kpp.SysInfo.Longitude = int(math.Round(loc.Lon * locationScale))
+	}
+	return nil
+}
+
+// SunTimes works out when the sun rises and sets at l on date's day (in date's time zone), to within a minute or
+// so. It's the NOAA sunrise equation, the same thing the device does for sunrise and sunset rules. If the sun
+// doesn't rise or set that day, you get ErrNoSunrise.
+func (l Location) SunTimes(date time.Time) (sunrise, sunset time.Time, err error) {
+	if err = l.Validate(); err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	var (
+		rad = math.Pi / 180
+		// noon UTC on the day, as days since J2000
+		day = time.Date(date.Year(), date.Month(), date.Day(), 12, 0, 0, 0, time.UTC)
+		n   = math.Floor(float64(day.Unix())/86400+2440587.5-2451545.0+0.0008) - l.Lon/360
+		// mean anomaly, equation of the center and ecliptic longitude
+		m      = math.Mod(357.5291+0.98560028*n, 360)
+		c      = 1.9148*math.Sin(m*rad) + 0.02*math.Sin(2*m*rad) + 0.0003*math.Sin(3*m*rad)
+		lambda = math.Mod(m+c+180+102.9372, 360)
+		// solar transit, as a julian date, and the sun's declination
+		transit = 2451545.0 + n + 0.0053*math.Sin(m*rad) - 0.0069*math.Sin(2*lambda*rad)
+		sinDec  = math.Sin(lambda*rad) * math.Sin(23.4397*rad)
+		cosDec  = math.Cos(math.Asin(sinDec))
+		// hour angle when the sun's center is 0.833° below the horizon, for refraction and the sun's radius
+		cosOmega = (math.Sin(-0.833*rad) - math.Sin(l.Lat*rad)*sinDec) / (math.Cos(l.Lat*rad) * cosDec)
+	)
+	if cosOmega < -1 || cosOmega > 1 {
+		return time.Time{}, time.Time{}, ErrNoSunrise
+	}
+	var omega = math.Acos(cosOmega) / rad
+	return julianToTime(transit-omega/360, date.Location()), julianToTime(transit+omega/360, date.Location()), nil
+}
+
+// julianToTime turns a julian date into a time in loc, to the second
+func julianToTime(jd float64, loc *time.Location) time.Time {
+	var unix = (jd - 2440587.5) * 86400
+	return time.Unix(int64(math.Round(unix)), 0).In(loc)
+}
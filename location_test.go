@@ -0,0 +1,94 @@
+package kasalink
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLocationValidate(t *testing.T) {
+	var tests = []struct {
+		loc  Location
+		good bool
+	}{
+		{Location{Lat: 39.1156, Lon: -77.5702}, true},
+		{Location{Lat: -90, Lon: 180}, true},
+		{Location{Lat: 90.5, Lon: 0}, false},
+		{Location{Lat: 0, Lon: -180.1}, false},
+		// the old argument order, longitude first
+		{Location{Lat: -77.5702, Lon: 39.1156}, true},
+		{Location{Lat: -177.5702, Lon: 39.1156}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.loc.Validate(); (err == nil) != tt.good {
+			t.Errorf("%s: got %v", tt.loc, err)
+		}
+	}
+}
+
+func TestSystemInfoLocation(t *testing.T) {
+	var sysInfo = SystemInfo{Latitude: 391156, Longitude: -775702}
+	if got, want := sysInfo.Location(), (Location{Lat: 39.1156, Lon: -77.5702}); got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
+
+func TestSunTimes(t *testing.T) {
+	var ny, err = time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	var tests = []struct {
+		name            string
+		loc             Location
+		date            time.Time
+		sunrise, sunset time.Time
+	}{
+		// what NOAA's solar calculator says, to the minute
+		{"Leesburg midsummer", Location{Lat: 39.1156, Lon: -77.5702}, time.Date(2024, 6, 20, 0, 0, 0, 0, ny),
+			time.Date(2024, 6, 20, 5, 45, 0, 0, ny), time.Date(2024, 6, 20, 20, 39, 0, 0, ny)},
+		{"Leesburg midwinter", Location{Lat: 39.1156, Lon: -77.5702}, time.Date(2024, 12, 21, 0, 0, 0, 0, ny),
+			time.Date(2024, 12, 21, 7, 25, 0, 0, ny), time.Date(2024, 12, 21, 16, 51, 0, 0, ny)},
+		{"Quito", Location{Lat: -0.1807, Lon: -78.4678}, time.Date(2024, 3, 20, 0, 0, 0, 0, time.UTC),
+			time.Date(2024, 3, 20, 11, 18, 0, 0, time.UTC), time.Date(2024, 3, 20, 23, 24, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		var sunrise, sunset, err = tt.loc.SunTimes(tt.date)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		for _, check := range []struct{ got, want time.Time }{{sunrise, tt.sunrise}, {sunset, tt.sunset}} {
+			if d := check.got.Sub(check.want); d < -2*time.Minute || d > 2*time.Minute {
+				t.Errorf("%s: got %s, want %s", tt.name, check.got, check.want)
+			}
+		}
+	}
+	if _, _, err = (Location{Lat: 69.6492, Lon: 18.9553}).SunTimes(time.Date(2024, 6, 21, 0, 0, 0, 0,
+		time.UTC)); !errors.Is(err, ErrNoSunrise) {
+		t.Errorf("midnight sun in Tromsø: got %v", err)
+	}
+}
+
+func TestSetLocation(t *testing.T) {
+	var (
+		kpp *KasaPowerPlug
+		ctx = context.Background()
+	)
+	mockOrNot(&kpp, t)
+	defer kpp.Close()
+	var loc, err = kpp.Location(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("Device is at %s", loc)
+	if err = kpp.SetLocation(ctx, Location{Lat: 91, Lon: 0}); err == nil {
+		t.Fatal("set a latitude past the pole")
+	}
+	if !useMock {
+		t.Skip("not moving a real device")
+	}
+	if err = kpp.SetLocation(ctx, loc); err != nil {
+		t.Fatal(err)
+	}
+}
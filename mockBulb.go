@@ -0,0 +1,179 @@
+package kasalink
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// MockBulb is for running unit tests against, it plays a KL130 well enough for Bulb: it keeps its light state and
+// presets, and answers over TCP and UDP on the same port like a real bulb does. NewMockLightStrip makes it play a
+// KL430 instead.
+type MockBulb struct {
+	*mockServer
+	lock sync.Mutex
+	// sysInfo, service and setMethod are what differ between a bulb and a strip
+	sysInfo   string
+	service   string
+	setMethod string
+	// state is the light state, while it's off the rest of it is what the bulb comes back on as
+	state   lightState
+	presets []LightPreset
+	// zones and effect are only for strips, groups as set_light_state takes them and the effect last set
+	zones  [][]int
+	effect *LightingEffect
+}
+
+// mockBulbSysInfo is the MockBulb's system info, without its light state and presets which get filled in as they are
+const mockBulbSysInfo = `{"sw_ver":"1.8.11 Build 191113 Rel.105336","hw_ver":"2.0","model":"KL130(US)","deviceId":"801211B7E8AF2B3A8C73B7A5A2C94EB71A5B3CF5","oemId":"0D41E14B7B3A9F8C35C6CBEF8A8B2E73","hwId":"111E35908497A05512E259BB76801E10","rssi":-52,"longitude_i":-775702,"latitude_i":391156,"alias":"Sump Light","mic_type":"IOT.SMARTBULB","dev_state":"normal","description":"Smart Wi-Fi LED Bulb with Color Changing","is_factory":false,"mac":"B0:4E:26:12:7C:A1","is_dimmable":1,"is_color":1,"is_variable_color_temp":1,"err_code":0}`
+
+// NewMockBulb gives you a MockBulb that's on, showing warm white at full brightness
+func NewMockBulb() (*MockBulb, error) {
+	var (
+		mb = &MockBulb{
+			sysInfo:   mockBulbSysInfo,
+			service:   lightingServiceModule,
+			setMethod: "transition_light_state",
+			state:     lightState{OnOff: 1, Mode: "normal", ColorTemp: 2700, Brightness: 100},
+			presets: []LightPreset{
+				{Index: 0, ColorTemp: 2700, Brightness: 50},
+				{Index: 1, Hue: 240, Saturation: 100, Brightness: 10},
+			},
+		}
+		err error
+	)
+	if mb.mockServer, err = startMockServer(mb.answer); err != nil {
+		return nil, err
+	}
+	return mb, nil
+}
+
+// mockLightStripSysInfo is the MockBulb's system info when it's playing a light strip
+const mockLightStripSysInfo = `{"sw_ver":"1.0.8 Build 210121 Rel.084339","hw_ver":"2.0","model":"KL430(US)","deviceId":"8012A3D5F1C7E9B1A3C5E7F9B1D3F5A7C9E1B3D5","oemId":"5C6FB3A8D1F7E0C2B4A69E8D7C5B3A1F","hwId":"0A1B2C3D4E5F60718293A4B5C6D7E8F9","rssi":-47,"longitude_i":-775702,"latitude_i":391156,"alias":"Tank Canopy","mic_type":"IOT.SMARTBULB","dev_state":"normal","description":"Kasa Smart Light Strip, Multicolor","is_factory":false,"mac":"1C:3B:F3:5A:7E:90","is_dimmable":1,"is_color":1,"is_variable_color_temp":1,"length":16,"err_code":0}`
+
+// NewMockLightStrip gives you a MockBulb playing a 16 zone KL430, on and showing warm white
+func NewMockLightStrip() (*MockBulb, error) {
+	var (
+		mb = &MockBulb{
+			sysInfo:   mockLightStripSysInfo,
+			service:   lightStripModule,
+			setMethod: "set_light_state",
+			state:     lightState{OnOff: 1, Mode: "normal", ColorTemp: 2700, Brightness: 100},
+			effect:    &LightingEffect{Name: "Aurora", ID: "xqUxDhbAhNLqulcuRMyPBmVGyTOyEMEu", Brightness: 100},
+		}
+		err error
+	)
+	if mb.mockServer, err = startMockServer(mb.answer); err != nil {
+		return nil, err
+	}
+	return mb, nil
+}
+
+// answer works out what the MockBulb says to a command
+func (mb *MockBulb) answer(clearBits []byte) string {
+	mb.lock.Lock()
+	defer mb.lock.Unlock()
+	return mockModules(clearBits, mb.method)
+}
+
+// method answers a single method, ok is false if the MockBulb doesn't have the module
+func (mb *MockBulb) method(module, method string, args json.RawMessage) (answer interface{}, ok bool) {
+	switch module {
+	case "system":
+		if method != "get_sysinfo" {
+			return mockNotSupported, true
+		}
+		var sysInfo map[string]interface{}
+		_ = json.Unmarshal([]byte(mb.sysInfo), &sysInfo)
+		sysInfo["light_state"] = mb.lightState()
+		sysInfo["preferred_state"] = mb.presets
+		if mb.effect != nil {
+			sysInfo["lighting_effect_state"] = mb.effect
+		}
+		return sysInfo, true
+	case mb.service:
+		switch method {
+		case "get_light_state":
+			return mb.lightState(), true
+		case mb.setMethod:
+			var change struct {
+				Groups     [][]int `json:"groups"`
+				OnOff      *int    `json:"on_off"`
+				Hue        *int    `json:"hue"`
+				Saturation *int    `json:"saturation"`
+				ColorTemp  *int    `json:"color_temp"`
+				Brightness *int    `json:"brightness"`
+			}
+			if err := json.Unmarshal(args, &change); err != nil {
+				return mockInvalidArgument, true
+			}
+			for field, value := range map[*int]*int{&mb.state.OnOff: change.OnOff, &mb.state.Hue: change.Hue,
+				&mb.state.Saturation: change.Saturation, &mb.state.ColorTemp: change.ColorTemp,
+				&mb.state.Brightness: change.Brightness} {
+				if value != nil {
+					*field = *value
+				}
+			}
+			if change.Groups != nil {
+				mb.zones = change.Groups
+			}
+			if mb.effect != nil {
+				// setting the light state stops any effect
+				mb.effect.Enable = 0
+			}
+			return mb.lightState(), true
+		case "set_preferred_state":
+			var preset LightPreset
+			if err := json.Unmarshal(args, &preset); err != nil || preset.Index < 0 ||
+				preset.Index >= len(mb.presets) {
+				return mockInvalidArgument, true
+			}
+			mb.presets[preset.Index] = preset
+			return preset, true
+		}
+		return mockNotSupported, true
+	case lightingEffectModule:
+		if mb.effect == nil {
+			return nil, false
+		}
+		switch method {
+		case "get_lighting_effect":
+			var effect = lightingEffectState{LightingEffect: *mb.effect}
+			return effect, true
+		case "set_lighting_effect":
+			var effect LightingEffect
+			// like the firmware, it wants the whole effect, not just a name
+			if err := json.Unmarshal(args, &effect); err != nil || effect.Name == "" ||
+				(effect.Type != "random" && len(effect.Sequence) == 0) {
+				return mockInvalidArgument, true
+			}
+			mb.effect = &effect
+			return map[string]interface{}{"err_code": 0}, true
+		}
+		return mockNotSupported, true
+	case bulbEnergyMeterModule:
+		if method != "get_realtime" {
+			return mockNotSupported, true
+		}
+		var power = 0
+		if mb.state.OnOff == 1 {
+			// a 10W bulb that draws a little more with color than white
+			power = mb.state.Brightness * 100
+			if mb.state.ColorTemp == 0 {
+				power += 500
+			}
+		}
+		return map[string]interface{}{"power_mw": power, "total_wh": 1337, "err_code": 0}, true
+	}
+	return nil, false
+}
+
+// lightState is the light state the way a bulb reports it, with everything but on_off tucked into dft_on_state
+// while it's off
+func (mb *MockBulb) lightState() lightState {
+	var state = mb.state
+	if state.OnOff == 0 {
+		var dft = state
+		return lightState{OnOff: 0, DftOnState: &dft}
+	}
+	return state
+}
@@ -0,0 +1,268 @@
+package kasalink
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// MockDimmer is for running unit tests against, it plays an HS220 well enough for Dimmer: it keeps its relay state,
+// brightness, fade times and behaviors, and answers over TCP and UDP on the same port. NewMockMotionSwitch makes it
+// play an ES20M instead.
+type MockDimmer struct {
+	*mockServer
+	lock       sync.Mutex
+	sysInfo    string
+	relayState int
+	brightness int
+	settings   *dimmerSettings
+	// pir, las, motion and ambient are only for motion switches
+	pir     *pirConfig
+	las     *lasDevice
+	motion  int
+	ambient int
+}
+
+// mockDimmerSysInfo is the MockDimmer's system info, without its relay state and brightness
+const mockDimmerSysInfo = `{"sw_ver":"1.5.8 Build 180815 Rel.135935","hw_ver":"1.0","model":"HS220(US)","deviceId":"80067AC4FDBD41C54C55896BFA28EAD71835D4A0","oemId":"FFF22CFF774A0B89F7624BFC6F50D5DE","hwId":"046DCF2B1D7A2D9F6D34B0D9C0A1F7E9","rssi":-41,"longitude_i":-775702,"latitude_i":391156,"alias":"Fish Room Lights","mic_type":"IOT.SMARTPLUGSWITCH","feature":"TIM","mac":"50:C7:BF:3C:4A:2B","updating":0,"led_off":0,"on_time":0,"active_mode":"none","dev_name":"Smart Wi-Fi Dimmer","err_code":0}`
+
+// NewMockDimmer gives you a MockDimmer that's off, set to half brightness
+func NewMockDimmer() (*MockDimmer, error) {
+	var (
+		md = &MockDimmer{
+			sysInfo:    mockDimmerSysInfo,
+			brightness: 50,
+			settings:   newDimmerSettings(),
+		}
+		err error
+	)
+	if md.mockServer, err = startMockServer(md.answer); err != nil {
+		return nil, err
+	}
+	return md, nil
+}
+
+// mockMotionSwitchSysInfo is the MockDimmer's system info when it's playing a motion switch
+const mockMotionSwitchSysInfo = `{"sw_ver":"1.0.11 Build 220125 Rel.102417","hw_ver":"1.0","model":"ES20M(US)","deviceId":"8006D5A4E1F2C3B4A5968778695A4B3C2D1E0F1A","oemId":"4A3B2C1D0E9F8A7B6C5D4E3F2A1B0C9D","hwId":"9F8E7D6C5B4A39281706F5E4D3C2B1A0","rssi":-44,"longitude_i":-775702,"latitude_i":391156,"alias":"Fish Room Door","mic_type":"IOT.SMARTPLUGSWITCH","feature":"TIM","mac":"3C:52:A1:7B:19:E4","updating":0,"led_off":0,"on_time":0,"active_mode":"none","dev_name":"Smart Wi-Fi Dimmer with Motion Sensor","err_code":0}`
+
+// NewMockMotionSwitch gives you a MockDimmer playing an ES20M, with no motion in a dim room
+func NewMockMotionSwitch() (*MockDimmer, error) {
+	var md, err = NewMockDimmer()
+	if err != nil {
+		return nil, err
+	}
+	md.sysInfo = mockMotionSwitchSysInfo
+	md.pir = &pirConfig{Enable: 1, Version: "1.0", TriggerIndex: int(MotionMid), ColdTime: 60000, MinADC: 0,
+		MaxADC: 4095, Array: []int{80, 50, 20}}
+	md.las = &lasDevice{HardwareID: "0", Enable: 1, DarkIndex: 0, MinADC: 0, MaxADC: 2450, LevelArray: []LightLevel{
+		{Name: "cloudy", ADC: 490, Value: 20},
+		{Name: "overcast", ADC: 294, Value: 12},
+		{Name: "dawn", ADC: 222, Value: 9},
+		{Name: "twilight", ADC: 222, Value: 9},
+		{Name: "total darkness", ADC: 111, Value: 4},
+		{Name: "custom", ADC: 2400, Value: 97},
+	}}
+	md.motion, md.ambient = 400, 9
+	return md, nil
+}
+
+// SetMotionReading is what the MockDimmer's motion sensor will read from now on
+func (md *MockDimmer) SetMotionReading(adc int) {
+	md.lock.Lock()
+	defer md.lock.Unlock()
+	md.motion = adc
+}
+
+// answer works out what the MockDimmer says to a command
+func (md *MockDimmer) answer(clearBits []byte) string {
+	md.lock.Lock()
+	defer md.lock.Unlock()
+	return mockModules(clearBits, md.method)
+}
+
+// method answers a single method, ok is false if the MockDimmer doesn't have the module
+func (md *MockDimmer) method(module, method string, args json.RawMessage) (answer interface{}, ok bool) {
+	var ack = map[string]interface{}{"err_code": 0}
+	var values map[string]json.RawMessage
+	_ = json.Unmarshal(args, &values)
+	var intArg = func(name string, min, max int) (int, bool) {
+		var v int
+		if err := json.Unmarshal(values[name], &v); err != nil || v < min || v > max {
+			return 0, false
+		}
+		return v, true
+	}
+	switch module {
+	case "system":
+		switch method {
+		case "get_sysinfo":
+			var sysInfo map[string]interface{}
+			_ = json.Unmarshal([]byte(md.sysInfo), &sysInfo)
+			sysInfo["relay_state"] = md.relayState
+			sysInfo["brightness"] = md.brightness
+			return sysInfo, true
+		case "set_relay_state":
+			var state, valid = intArg("state", 0, 1)
+			if !valid {
+				return mockInvalidArgument, true
+			}
+			md.relayState = state
+			return ack, true
+		}
+		return mockNotSupported, true
+	case dimmerModule:
+		switch method {
+		case "set_brightness":
+			var brightness, valid = intArg("brightness", 0, 100)
+			if !valid {
+				return mockInvalidArgument, true
+			}
+			md.brightness = brightness
+			return ack, true
+		case "set_dimmer_transition":
+			var brightness, valid = intArg("brightness", 0, 100)
+			if _, durationOK := intArg("duration", 0, 600000); !valid || !durationOK {
+				return mockInvalidArgument, true
+			}
+			if brightness == 0 {
+				md.relayState = 0
+			} else {
+				md.relayState, md.brightness = 1, brightness
+			}
+			return ack, true
+		}
+		if answer, ok = md.settings.answer(method, args); ok {
+			return answer, true
+		}
+		return mockNotSupported, true
+	case pirModule:
+		if md.pir == nil {
+			return nil, false
+		}
+		switch method {
+		case "get_config":
+			var config = *md.pir
+			return config, true
+		case "get_adc_value":
+			return sensorValue{Value: md.motion}, true
+		case "set_enable":
+			var enable, valid = intArg("enable", 0, 1)
+			if !valid {
+				return mockInvalidArgument, true
+			}
+			md.pir.Enable = enable
+			return ack, true
+		case "set_trigger_sens":
+			var index, valid = intArg("index", 0, len(md.pir.Array)-1)
+			if !valid {
+				return mockInvalidArgument, true
+			}
+			md.pir.TriggerIndex = index
+			return ack, true
+		case "set_cold_time":
+			var coldTime, valid = intArg("cold_time", 0, 3600000)
+			if !valid {
+				return mockInvalidArgument, true
+			}
+			md.pir.ColdTime = coldTime
+			return ack, true
+		}
+		return mockNotSupported, true
+	case lasModule:
+		if md.las == nil {
+			return nil, false
+		}
+		switch method {
+		case "get_config":
+			return map[string]interface{}{"version": "1.0", "devs": []lasDevice{*md.las}, "err_code": 0}, true
+		case "get_current_brt":
+			return sensorValue{Value: md.ambient}, true
+		case "set_enable":
+			var enable, valid = intArg("enable", 0, 1)
+			if !valid {
+				return mockInvalidArgument, true
+			}
+			md.las.Enable = enable
+			return ack, true
+		case "set_brt_level":
+			var index, validIndex = intArg("index", 0, len(md.las.LevelArray)-1)
+			var value, validValue = intArg("value", 0, 100)
+			if !validIndex || !validValue {
+				return mockInvalidArgument, true
+			}
+			md.las.LevelArray[index].Value = value
+			return ack, true
+		}
+		return mockNotSupported, true
+	}
+	return nil, false
+}
+
+// dimmerSettings are the fade times and default behaviors a dimmer keeps, for the MockDimmer and the Simulator
+type dimmerSettings struct {
+	params   dimmerParameters
+	behavior map[string]dimmerAction
+}
+
+// newDimmerSettings gives you the settings an HS220 comes out of the box with
+func newDimmerSettings() *dimmerSettings {
+	return &dimmerSettings{
+		params: dimmerParameters{MinThreshold: 11, FadeOnTime: 1000, FadeOffTime: 1000, GentleOnTime: 3000,
+			GentleOffTime: 10000, RampRate: 30, BulbType: 1},
+		behavior: map[string]dimmerAction{
+			"hard_on":      {Mode: string(DimmerLastStatus)},
+			"soft_on":      {Mode: string(DimmerLastStatus)},
+			"long_press":   {Mode: string(DimmerInstant)},
+			"double_click": {Mode: string(DimmerGentle)},
+		},
+	}
+}
+
+// dimmerBehaviorMethods are the methods that set a default behavior, and the trigger each one is for
+var dimmerBehaviorMethods = map[string]string{"set_hard_on_behavior": "hard_on",
+	"set_soft_on_behavior": "soft_on", "set_long_press_behavior": "long_press",
+	"set_double_click_action": "double_click"}
+
+// answer handles the dimmer methods that get and set the settings, ok is false for any other method
+func (ds *dimmerSettings) answer(method string, args json.RawMessage) (answer interface{}, ok bool) {
+	switch method {
+	case "get_dimmer_parameters":
+		var p = ds.params
+		return p, true
+	case "get_default_behavior":
+		var b = map[string]interface{}{"err_code": 0}
+		for trigger, action := range ds.behavior {
+			b[trigger] = action
+		}
+		return b, true
+	case "set_fade_on_time", "set_fade_off_time", "set_gentle_on_time", "set_gentle_off_time":
+		var (
+			field = map[string]*int{"set_fade_on_time": &ds.params.FadeOnTime,
+				"set_fade_off_time": &ds.params.FadeOffTime, "set_gentle_on_time": &ds.params.GentleOnTime,
+				"set_gentle_off_time": &ds.params.GentleOffTime}[method]
+			arg, max = "duration", int(maxDimmerTransition / time.Millisecond)
+			values   map[string]*int
+		)
+		if method == "set_fade_on_time" || method == "set_fade_off_time" {
+			arg, max = "fadeTime", int(maxDimmerFadeTime/time.Millisecond)
+		}
+		if json.Unmarshal(args, &values) != nil || values[arg] == nil || *values[arg] < 0 || *values[arg] > max {
+			return mockInvalidArgument, true
+		}
+		*field = *values[arg]
+		return map[string]interface{}{"err_code": 0}, true
+	case "set_hard_on_behavior", "set_soft_on_behavior", "set_long_press_behavior", "set_double_click_action":
+		var action dimmerAction
+		if err := json.Unmarshal(args, &action); err != nil {
+			return mockInvalidArgument, true
+		}
+		switch DimmerAction(action.Mode) {
+		case DimmerLastStatus, DimmerInstant, DimmerGentle, DimmerPreset, DimmerNoAction:
+		default:
+			return mockInvalidArgument, true
+		}
+		ds.behavior[dimmerBehaviorMethods[method]] = action
+		return map[string]interface{}{"err_code": 0}, true
+	}
+	return nil, false
+}
@@ -3,45 +3,57 @@ package kasalink
 import (
 	"bytes"
 	"encoding/binary"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"net"
+	"strings"
+	"sync"
 )
 
-// MockPlug is for running unit tests, it'll fake responses as if it's an actual plug (eventually)
+// MockPlug is for running unit tests, it'll fake responses as if it's an actual plug (eventually). It stays next to
+// the Simulator on purpose: it answers with the canned HS300 responses in mockResponses word for word, which the
+// tests that go through mockOrNot are written against (so they run unchanged against a real plug with
+// -useMock=false), and it hangs up after flashing firmware or joining Wi-Fi like a real plug does, where the
+// Simulator's server only ever hangs up as one of its Faults. Tests that need the device to remember what it's told
+// want a Simulator.
 type MockPlug struct {
 	net.Conn
 	ln       net.Listener
 	lastSent string
+	firmware *mockFirmware
+	emeter   *mockEMeter
 }
 
-// NewMockPlug gives you a new MockPlug with a running TCP Server instance to handle request. As written, a MockPlug
-// will only handle a single command and exit.
+// NewMockPlug gives you a new MockPlug with a running TCP Server instance to handle request. The MockPlug keeps
+// answering commands, on as many connections as you like, until you Close it. It'll also play along with a firmware
+// update, see mockFirmware, and to being calibrated, see mockEMeter.
 func NewMockPlug() (mp MockPlug, err error) {
+	mp.firmware = &mockFirmware{}
+	mp.emeter = &mockEMeter{gains: map[string]EMeterGains{}}
 
 	mp.ln, err = net.Listen("tcp", "127.0.0.1:0")
 	if err != nil {
 		return
 	}
+	go mp.serve()
 	mp.Conn, err = net.Dial("tcp", mp.ln.Addr().String())
 	if err != nil {
 		return
 	}
-	go func() {
-		defer func() {
-			err = mp.ln.Close()
-			if err != nil {
-				log.Println("Error trying to close out new mock plug listener:", err)
-			}
-		}()
-		myConn, err := mp.ln.Accept()
+	return
+}
+
+func (m MockPlug) serve() {
+	for {
+		myConn, err := m.ln.Accept()
 		if err != nil {
 			return
 		}
-		mp.ConnectionHandler(myConn)
-	}()
-	return
+		go m.ConnectionHandler(myConn)
+	}
 }
 
 // DialMe returns a connection to the MockPlug's internal server so you can send it requests and receive answers (eventually)
@@ -49,23 +61,71 @@ func (m *MockPlug) DialMe() (net.Conn, error) {
 	return net.Dial("tcp", m.ln.Addr().String())
 }
 
-// ConnectionHandler handles the connection when something connects to the MockPlug and sends a command.
-// If it doesn't send a supported command (and I've only actually implemented a few), bad things may occur.
-func (m *MockPlug) ConnectionHandler(myConnection net.Conn) {
+// Addr is the address the MockPlug's server listens on, hand it to NewKasaPowerPlug like you would a real plug's
+func (m *MockPlug) Addr() string {
+	return m.ln.Addr().String()
+}
 
-	var bodySize uint32
-	err := binary.Read(myConnection, binary.BigEndian, &bodySize)
-	if err != nil {
-		return
+// Close closes the MockPlug's own connection and shuts down its server
+func (m MockPlug) Close() error {
+	if err := m.ln.Close(); err != nil {
+		log.Println("Error trying to close out mock plug listener:", err)
 	}
-	var buf = make([]byte, bodySize)
+	return m.Conn.Close()
+}
 
-	_, err = io.ReadAtLeast(myConnection, buf, int(bodySize))
-	if err != nil {
-		return
+// ConnectionHandler handles the connection when something connects to the MockPlug and sends commands, until the
+// other side hangs up. If it doesn't send a supported command (and I've only actually implemented a few), bad things
+// may occur.
+func (m *MockPlug) ConnectionHandler(myConnection net.Conn) {
+	defer myConnection.Close()
+	for {
+		var bodySize uint32
+		err := binary.Read(myConnection, binary.BigEndian, &bodySize)
+		if err != nil {
+			return
+		}
+		var buf = make([]byte, bodySize)
+
+		_, err = io.ReadAtLeast(myConnection, buf, int(bodySize))
+		if err != nil {
+			return
+		}
+		var clearBits = decrypt(buf)
+		if response, reboot, ok := m.firmware.answer(clearBits); ok {
+			if _, err = myConnection.Write(encrypt(response)); err != nil || reboot {
+				return
+			}
+			continue
+		}
+		if response, ok := mockStats(clearBits); ok {
+			if _, err = myConnection.Write(encrypt(response)); err != nil {
+				return
+			}
+			continue
+		}
+		if response, ok := m.emeter.answer(clearBits); ok {
+			if _, err = myConnection.Write(encrypt(response)); err != nil {
+				return
+			}
+			continue
+		}
+		_, err = myConnection.Write(encrypt(mockAnswer(clearBits)))
+		if err != nil {
+			return
+		}
+		if bytes.Contains(clearBits, []byte(`"set_stainfo"`)) {
+			// a real plug drops off the network to go join the new one
+			_ = m.ln.Close()
+			return
+		}
 	}
+}
+
+// mockAnswer works out what the MockPlug says to a command. Commands it has a canned answer for get that, anything
+// that only sets things is told it worked, and everything else gets an error.
+func mockAnswer(clearBits []byte) string {
 	var indexString string
-	var clearBits = decrypt(buf)
 	log.Printf("Got the following: %s", clearBits)
 	if bytes.Contains(clearBits, []byte(`"context":{"child_ids":["`)) {
 		indexString = fmt.Sprintf("{%s", clearBits[bytes.Index(clearBits, []byte(`"]},`))+4:])
@@ -73,25 +133,218 @@ func (m *MockPlug) ConnectionHandler(myConnection net.Conn) {
 		indexString = string(clearBits)
 	}
 	//log.Println("indexString:", indexString)
-	var cmdMap = map[string]string{
-		getSysInfo:           `{"system": {"get_sysinfo": {"sw_ver":"1.0.6 Build 180627 Rel.081000", "hw_ver":"1.0", "model":"HS300(US)", "deviceId":"8006E92180ADBEA7B3E4820027152BE21ACC7D77", "oemId":"5C9E6254BEBAED63B2B6102966D24C17", "hwId":"34C41AA028022D0CCEA5E678E8547C54", "rssi":-35, "longitude_i":-775702, "latitude_i":391156, "alias":"TP-LINK_Power Strip_14A9", "mic_type":"IOT.SMARTPLUGSWITCH", "feature":"TIM:ENE", "mac":"B0:BE:76:80:14:A9", "updating":0, "led_off":0, "children":[ {"id":"8006E92180ADBEA7B3E4820027152BE21ACC7D7700", "state":1, "alias":"Top Tank Light", "on_time":394931, "next_action":{"type":-1} }, {"id":"8006E92180ADBEA7B3E4820027152BE21ACC7D7701", "state":1, "alias":"Top Tank Heater", "on_time":1200805, "next_action":{"type":-1} }, {"id":"8006E92180ADBEA7B3E4820027152BE21ACC7D7702", "state":1, "alias":"Top Tank Filter", "on_time":50621, "next_action":{"type":-1} }, {"id":"8006E92180ADBEA7B3E4820027152BE21ACC7D7703", "state":1, "alias":"Top Tank Powerhead", "on_time":385855, "next_action":{"type":-1} }, {"id":"8006E92180ADBEA7B3E4820027152BE21ACC7D7704", "state":1, "alias":"Air Pump", "on_time":1200806, "next_action":{"type":-1} }, {"id":"8006E92180ADBEA7B3E4820027152BE21ACC7D7705", "state":1, "alias":"Plug 6", "on_time":1289431, "next_action":{"type":-1} }], "child_num":6, "err_code":0 } }}`,
-		turnOffLED:           `{"system":{"error":0}}`,
-		turnOnLED:            `{"system":{"error":0}}`,
-		getCurrentAndVoltage: `{"emeter":{"get_realtime":{"voltage_mv":121122,"current_ma":34,"power_mw":2079,"total_wh":3376,"err_code":0}}}`,
-		turnOn:               `{"system":{"set_relay_state":{"err_code":0}}}`,
-		turnOff:              `{"system":{"set_relay_state":{"err_code":0}}}`,
-	}
-	response, ok := cmdMap[indexString]
-	if ok {
-		_, err = myConnection.Write(encrypt(response))
-		if err != nil {
-			return
+	if response, ok := mockResponses[indexString]; ok {
+		return response
+	}
+	if response, ok := mockSetterAnswer(indexString); ok {
+		return response
+	}
+	return `{"system":{"error":1}}`
+}
+
+// mockSetterAnswer answers err_code 0 to commands made up of nothing but set_ methods
+func mockSetterAnswer(cmd string) (string, bool) {
+	var (
+		modules  map[string]map[string]json.RawMessage
+		response = map[string]map[string]json.RawMessage{}
+	)
+	if err := json.Unmarshal([]byte(cmd), &modules); err != nil || len(modules) == 0 {
+		return "", false
+	}
+	for module, methods := range modules {
+		response[module] = map[string]json.RawMessage{}
+		for method := range methods {
+			if !strings.HasPrefix(method, "set_") {
+				return "", false
+			}
+			response[module][method] = json.RawMessage(`{"err_code":0}`)
 		}
-	} else {
-		_, err = myConnection.Write(encrypt(`{"system":{"error":1}}`))
-		if err != nil {
-			return
+	}
+	var b, err = json.Marshal(response)
+	if err != nil {
+		return "", false
+	}
+	return string(b), true
+}
+
+// mockFirmwareVersion is what the MockPlug runs once it's been flashed, it's the version its cloud firmware list offers
+const mockFirmwareVersion = "1.0.12 Build 190708 Rel.093725"
+
+// mockFlashingPolls is how many times a flashed MockPlug still answers get_sysinfo with its old sw_ver, like a real
+// plug does while it's flashing
+const mockFlashingPolls = 3
+
+// mockFirmware plays out a firmware update: a download takes a few polls of get_download_state to finish, and
+// flashing hangs up (the plug "reboots") and, after mockFlashingPolls, leaves the plug reporting mockFirmwareVersion
+// from then on. A download can be made to fail at failAt percent, or to stop getting anywhere at stallAt.
+type mockFirmware struct {
+	sync.Mutex
+	ratio         int
+	flashed       bool
+	flashingPolls int
+	failAt        int
+	stallAt       int
+}
+
+// answer handles the firmware commands, and get_sysinfo once the plug has been flashed. ok is false for any other
+// command, and reboot is true when the connection should drop after the answer goes out.
+func (f *mockFirmware) answer(clearBits []byte) (response string, reboot bool, ok bool) {
+	if f == nil {
+		return "", false, false
+	}
+	f.Lock()
+	defer f.Unlock()
+	switch {
+	case bytes.Contains(clearBits, []byte(`"download_firmware"`)):
+		f.ratio = 0
+		return `{"system":{"download_firmware":{"err_code":0}}}`, false, true
+	case bytes.Contains(clearBits, []byte(`"get_download_state"`)):
+		var status = 1
+		if f.ratio < 100 && (f.stallAt == 0 || f.ratio < f.stallAt) {
+			f.ratio += 40
 		}
+		switch {
+		case f.ratio > 100:
+			f.ratio = 100
+		case f.stallAt != 0 && f.ratio > f.stallAt:
+			f.ratio = f.stallAt
+		}
+		switch {
+		case f.failAt != 0 && f.ratio >= f.failAt:
+			status = 3
+		case f.ratio == 100:
+			status = 2
+		}
+		return fmt.Sprintf(`{"system":{"get_download_state":{"status":%d,"ratio":%d,"reboot_time":10,"flash_time":40,"err_code":0}}}`,
+			status, f.ratio), false, true
+	case bytes.Contains(clearBits, []byte(`"flash_firmware"`)):
+		if f.ratio < 100 {
+			return `{"system":{"flash_firmware":{"err_code":-3,"err_msg":"no firmware downloaded"}}}`, false, true
+		}
+		f.flashed = true
+		return `{"system":{"flash_firmware":{"err_code":0}}}`, true, true
+	case f.flashed && string(clearBits) == getSysInfo:
+		if f.flashingPolls < mockFlashingPolls {
+			f.flashingPolls++
+			return mockResponses[getSysInfo], false, true
+		}
+		return strings.Replace(mockResponses[getSysInfo], "1.0.6 Build 180627 Rel.081000", mockFirmwareVersion, 1),
+			false, true
 	}
-	return
+	return "", false, false
+}
+
+// The MockPlug's outlets all see the same load, mockEMeterVoltage millivolts and mockEMeterCurrent milliamps, and read
+// it right with mockEMeterGains. They start out on gains that read about 3% high on voltage and 4% high on current,
+// like a real HS300 can.
+const (
+	mockEMeterVoltage = 117600
+	mockEMeterCurrent = 1250
+)
+
+var (
+	mockEMeterGains   = EMeterGains{VGain: 13462, IGain: 16835}
+	mockEMeterDefault = EMeterGains{VGain: 13865, IGain: 17508}
+)
+
+// mockEMeter keeps each outlet's energy meter gains, by child ID ("" is the plug itself), and reads the load
+// through them
+type mockEMeter struct {
+	sync.Mutex
+	gains map[string]EMeterGains
+}
+
+// answer handles get_realtime, get_vgain_igain and set_vgain_igain, ok is false for any other command
+func (e *mockEMeter) answer(clearBits []byte) (response string, ok bool) {
+	if e == nil {
+		return "", false
+	}
+	var cmd struct {
+		Context *struct {
+			ChildIDs []string `json:"child_ids"`
+		} `json:"context"`
+		EMeter map[string]json.RawMessage `json:"emeter"`
+	}
+	if err := json.Unmarshal(clearBits, &cmd); err != nil || len(cmd.EMeter) != 1 {
+		return "", false
+	}
+	var child string
+	if cmd.Context != nil && len(cmd.Context.ChildIDs) == 1 {
+		child = cmd.Context.ChildIDs[0]
+	}
+	e.Lock()
+	defer e.Unlock()
+	var gains, known = e.gains[child]
+	if !known {
+		gains = mockEMeterDefault
+	}
+	for method, args := range cmd.EMeter {
+		switch method {
+		case "get_realtime":
+			var (
+				voltage = int(math.Round(float64(mockEMeterVoltage*gains.VGain) / float64(mockEMeterGains.VGain)))
+				current = int(math.Round(float64(mockEMeterCurrent*gains.IGain) / float64(mockEMeterGains.IGain)))
+			)
+			return fmt.Sprintf(`{"emeter":{"get_realtime":{"voltage_mv":%d,"current_ma":%d,"power_mw":%d,"total_wh":3376,"err_code":0}}}`,
+				voltage, current, voltage*current/1000), true
+		case "get_vgain_igain":
+			return fmt.Sprintf(`{"emeter":{"get_vgain_igain":{"vgain":%d,"igain":%d,"err_code":0}}}`, gains.VGain,
+				gains.IGain), true
+		case "set_vgain_igain":
+			if err := json.Unmarshal(args, &gains); err != nil || gains.VGain <= 0 || gains.IGain <= 0 {
+				return `{"emeter":{"set_vgain_igain":{"err_code":-3,"err_msg":"invalid argument"}}}`, true
+			}
+			e.gains[child] = gains
+			return `{"emeter":{"set_vgain_igain":{"err_code":0}}}`, true
+		}
+	}
+	return "", false
+}
+
+// mockStats answers get_daystat and get_monthstat from the emeter and schedule modules, ok is false for any other
+// command. Every outlet reports the same three days of whatever month is asked for, and January and February of
+// whatever year.
+func mockStats(clearBits []byte) (response string, ok bool) {
+	var cmd map[string]json.RawMessage
+	if err := json.Unmarshal(clearBits, &cmd); err != nil {
+		return "", false
+	}
+	for _, module := range []string{"emeter", "schedule"} {
+		var methods map[string]struct {
+			Year  int `json:"year"`
+			Month int `json:"month"`
+		}
+		if cmd[module] == nil || json.Unmarshal(cmd[module], &methods) != nil || len(methods) != 1 {
+			continue
+		}
+		var unit = "time"
+		if module == "emeter" {
+			unit = "energy_wh"
+		}
+		if args, ok := methods["get_daystat"]; ok {
+			return fmt.Sprintf(`{%q:{"get_daystat":{"day_list":[{"year":%[2]d,"month":%[3]d,"day":1,%[4]q:90},{"year":%[2]d,"month":%[3]d,"day":2,%[4]q:480},{"year":%[2]d,"month":%[3]d,"day":3,%[4]q:1440}],"err_code":0}}}`,
+				module, args.Year, args.Month, unit), true
+		}
+		if args, ok := methods["get_monthstat"]; ok {
+			return fmt.Sprintf(`{%q:{"get_monthstat":{"month_list":[{"year":%[2]d,"month":1,%[3]q:14400},{"year":%[2]d,"month":2,%[3]q:12960}],"err_code":0}}}`,
+				module, args.Year, unit), true
+		}
+	}
+	return "", false
+}
+
+var mockResponses = map[string]string{
+	getSysInfo:            `{"system": {"get_sysinfo": {"sw_ver":"1.0.6 Build 180627 Rel.081000", "hw_ver":"1.0", "model":"HS300(US)", "deviceId":"8006E92180ADBEA7B3E4820027152BE21ACC7D77", "oemId":"5C9E6254BEBAED63B2B6102966D24C17", "hwId":"34C41AA028022D0CCEA5E678E8547C54", "rssi":-35, "longitude_i":-775702, "latitude_i":391156, "alias":"TP-LINK_Power Strip_14A9", "mic_type":"IOT.SMARTPLUGSWITCH", "feature":"TIM:ENE", "mac":"B0:BE:76:80:14:A9", "updating":0, "led_off":0, "children":[ {"id":"8006E92180ADBEA7B3E4820027152BE21ACC7D7700", "state":1, "alias":"Top Tank Light", "on_time":394931, "next_action":{"type":-1} }, {"id":"8006E92180ADBEA7B3E4820027152BE21ACC7D7701", "state":1, "alias":"Top Tank Heater", "on_time":1200805, "next_action":{"type":-1} }, {"id":"8006E92180ADBEA7B3E4820027152BE21ACC7D7702", "state":1, "alias":"Top Tank Filter", "on_time":50621, "next_action":{"type":-1} }, {"id":"8006E92180ADBEA7B3E4820027152BE21ACC7D7703", "state":1, "alias":"Top Tank Powerhead", "on_time":385855, "next_action":{"type":-1} }, {"id":"8006E92180ADBEA7B3E4820027152BE21ACC7D7704", "state":1, "alias":"Air Pump", "on_time":1200806, "next_action":{"type":-1} }, {"id":"8006E92180ADBEA7B3E4820027152BE21ACC7D7705", "state":1, "alias":"Plug 6", "on_time":1289431, "next_action":{"type":-1} }], "child_num":6, "err_code":0 } }}`,
+	turnOffLED:            `{"system":{"error":0}}`,
+	turnOnLED:             `{"system":{"error":0}}`,
+	getCurrentAndVoltage:  `{"emeter":{"get_realtime":{"voltage_mv":121122,"current_ma":34,"power_mw":2079,"total_wh":3376,"err_code":0}}}`,
+	turnOn:                `{"system":{"set_relay_state":{"err_code":0}}}`,
+	turnOff:               `{"system":{"set_relay_state":{"err_code":0}}}`,
+	getDeviceTimeAndZone:  `{"time":{"get_time":{"year":2019,"month":3,"mday":10,"hour":12,"min":30,"sec":15,"err_code":0},"get_timezone":{"index":17,"err_code":0}}}`,
+	getDeviceTimeZone:     `{"time":{"get_timezone":{"index":17,"err_code":0}}}`,
+	getDeviceIcon:         `{"system":{"get_dev_icon":{"icon":"iVBORw0KGgoAAAANSUhEUgAAAAQAAAAECAIAAAAmkwkpAAAAQUlEQVR4nAA0AMv/BABmzAAAAAAAAAAAAAIAAAAAAAAAAAAAAAACAAAAAAAAAAAAAAAAAgAAAAAAAAAAAAAAAAMAPJgBPR/awdMAAAAASUVORK5CYII=","hash":"cfc3107d543e7f1c9c0bcb179fefa795","err_code":0}}}`,
+	getCloudInfo:          `{"cnCloud":{"get_info":{"username":"reefer@example.com","server":"n-devs.tplinkcloud.com","binded":1,"cld_connection":1,"illegalType":0,"stopConnect":0,"tcspStatus":1,"fwDlPage":"","tcspInfo":"","fwNotifyType":0,"err_code":0}}}`,
+	getFirmwareList:       `{"cnCloud":{"get_intl_fw_list":{"fw_list":[{"fwType":2,"fwTime":1562745600000,"fwVer":"1.0.12 Build 190708 Rel.093725","fwUrl":"http://download.tplinkcloud.com/firmware/HS300_US_1.0.12_Build_190708_Rel.093725.bin","fwLocation":0,"fwReleaseLog":"Stability improvements","fwReleaseLogUrl":"undefined yet"}],"err_code":0}}}`,
+	unbindDeviceFromCloud: `{"cnCloud":{"unbind":{"err_code":0}}}`,
+	scanForAccessPoints:   `{"netif":{"get_scaninfo":{"ap_list":[{"ssid":"ReefNet","key_type":3,"rssi":-48},{"ssid":"Guest","key_type":0,"rssi":-71}],"err_code":0}}}`,
 }
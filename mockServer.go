@@ -0,0 +1,210 @@
+package kasalink
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// mockServer is what the mock devices have in common: it answers commands over TCP and UDP on the same port, like a
+// real device does, and leaves what to say to answer
+type mockServer struct {
+	ln     net.Listener
+	lnOnce sync.Once
+	lnErr  error
+	udp    net.PacketConn
+	answer func(clearBits []byte) string
+	// datagrams counts the UDP requests answered, for faults
+	datagrams int32
+	// faultLock guards faults and refuseUntil, which get changed while the server's answering
+	faultLock   sync.Mutex
+	faults      func(conn, request int) Faults
+	refuseUntil time.Time
+}
+
+// startMockServer starts answering on a free port on localhost
+func startMockServer(answer func(clearBits []byte) string) (*mockServer, error) {
+	var (
+		ms  = &mockServer{answer: answer}
+		err error
+	)
+	// the UDP port has to match the TCP one, and the first free TCP port might not be free for UDP
+	for tries := 0; tries < 10; tries++ {
+		if ms.ln, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+			return nil, err
+		}
+		if ms.udp, err = net.ListenPacket("udp", ms.ln.Addr().String()); err == nil {
+			break
+		}
+		_ = ms.ln.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+	go ms.serveTCP()
+	go ms.serveUDP()
+	return ms, nil
+}
+
+// listenMockServer starts answering on address, TCP and UDP both
+func listenMockServer(address string, answer func(clearBits []byte) string) (*mockServer, error) {
+	var (
+		ms  = &mockServer{answer: answer}
+		err error
+	)
+	if ms.ln, err = net.Listen("tcp", address); err != nil {
+		return nil, err
+	}
+	if ms.udp, err = net.ListenPacket("udp", ms.ln.Addr().String()); err != nil {
+		_ = ms.ln.Close()
+		return nil, err
+	}
+	go ms.serveTCP()
+	go ms.serveUDP()
+	return ms, nil
+}
+
+// Addr is the address (TCP and UDP) the mock device answers on
+func (ms *mockServer) Addr() string {
+	return ms.ln.Addr().String()
+}
+
+// Close shuts the mock device down
+func (ms *mockServer) Close() error {
+	if err := ms.udp.Close(); err != nil {
+		log.Println("Error trying to close out mock device UDP:", err)
+	}
+	return ms.leave()
+}
+
+// leave stops taking TCP connections, like the device went off to join another network. Connections already made
+// carry on, and UDP keeps answering.
+func (ms *mockServer) leave() error {
+	ms.lnOnce.Do(func() {
+		ms.lnErr = ms.ln.Close()
+	})
+	return ms.lnErr
+}
+
+// setFaults has script pick the Faults for every answer from now on, nil for none
+func (ms *mockServer) setFaults(script func(conn, request int) Faults) {
+	ms.faultLock.Lock()
+	defer ms.faultLock.Unlock()
+	ms.faults = script
+}
+
+// faultsFor is how to misbehave answering request on conn
+func (ms *mockServer) faultsFor(conn, request int) Faults {
+	ms.faultLock.Lock()
+	var script = ms.faults
+	ms.faultLock.Unlock()
+	if script == nil {
+		return Faults{}
+	}
+	return script(conn, request)
+}
+
+// refuse hangs up on new TCP connections until until
+func (ms *mockServer) refuse(until time.Time) {
+	ms.faultLock.Lock()
+	defer ms.faultLock.Unlock()
+	ms.refuseUntil = until
+}
+
+func (ms *mockServer) refusing() bool {
+	ms.faultLock.Lock()
+	defer ms.faultLock.Unlock()
+	return time.Now().Before(ms.refuseUntil)
+}
+
+func (ms *mockServer) serveTCP() {
+	for conns := 1; ; conns++ {
+		var conn, err = ms.ln.Accept()
+		if err != nil {
+			return
+		}
+		if ms.refusing() {
+			// a reset rather than a polite close, as near as we can get to refusing once it's accepted
+			if tcp, ok := conn.(*net.TCPConn); ok {
+				_ = tcp.SetLinger(0)
+			}
+			_ = conn.Close()
+			continue
+		}
+		go ms.serveConn(conn, conns)
+	}
+}
+
+func (ms *mockServer) serveConn(conn net.Conn, id int) {
+	defer conn.Close()
+	for request := 1; ; request++ {
+		var bodySize uint32
+		if err := binary.Read(conn, binary.BigEndian, &bodySize); err != nil {
+			return
+		}
+		var buf = make([]byte, bodySize)
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			return
+		}
+		var faults = ms.faultsFor(id, request)
+		if !faults.send(conn, faults.apply(ms.answer(decrypt(buf)))) {
+			return
+		}
+	}
+}
+
+func (ms *mockServer) serveUDP() {
+	var buf = make([]byte, 64*1024)
+	for {
+		var n, from, err = ms.udp.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if err = ms.answerDatagram(decrypt(buf[:n]), from); err != nil {
+			return
+		}
+	}
+}
+
+// answerDatagram answers a UDP request from the server's own UDP address, so the answer says who it's from
+func (ms *mockServer) answerDatagram(clearBits []byte, to net.Addr) error {
+	var faults = ms.faultsFor(0, int(atomic.AddInt32(&ms.datagrams, 1)))
+	var _, err = ms.udp.WriteTo(faults.datagram(faults.apply(ms.answer(clearBits))), to)
+	return err
+}
+
+var (
+	// mockNotSupported is what a device says to a method it doesn't have, in a module it does
+	mockNotSupported = map[string]interface{}{"err_code": -2, "err_msg": "member not support"}
+	// mockInvalidArgument is what a device says to a method it has, with arguments it doesn't like
+	mockInvalidArgument = map[string]interface{}{"err_code": -3, "err_msg": "invalid argument"}
+)
+
+// mockModules answers a command module by module, method by method, with whatever method says. Modules method
+// doesn't know (ok is false) get the err_code a real device gives.
+func mockModules(clearBits []byte,
+	method func(module, method string, args json.RawMessage) (answer interface{}, ok bool)) string {
+	var modules map[string]map[string]json.RawMessage
+	if err := json.Unmarshal(clearBits, &modules); err != nil {
+		return `{"err_code":-1,"err_msg":"module not support"}`
+	}
+	var response = map[string]map[string]interface{}{}
+	for module, methods := range modules {
+		response[module] = map[string]interface{}{}
+		for name, args := range methods {
+			var answer, ok = method(module, name, args)
+			if !ok {
+				response[module] = map[string]interface{}{"err_code": -1, "err_msg": "module not support"}
+				break
+			}
+			response[module][name] = answer
+		}
+	}
+	var b, _ = json.Marshal(response)
+	return string(b)
+}
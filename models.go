@@ -0,0 +1,218 @@
+package kasalink
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// DeviceKind is the broad sort of device a model is, which decides the type NewDevice gives you for it
+type DeviceKind int
+
+// The kinds of Kasa device
+const (
+	KindPlug DeviceKind = iota
+	KindStrip
+	KindDimmer
+	KindBulb
+	KindLightStrip
+	KindMotionSwitch
+)
+
+func (dk DeviceKind) String() string {
+	switch dk {
+	case KindPlug:
+		return "plug"
+	case KindStrip:
+		return "strip"
+	case KindDimmer:
+		return "dimmer"
+	case KindBulb:
+		return "bulb"
+	case KindLightStrip:
+		return "light strip"
+	case KindMotionSwitch:
+		return "motion switch"
+	default:
+		return fmt.Sprintf("DeviceKind(%d)", int(dk))
+	}
+}
+
+// Protocol is how a device wants to be talked to
+type Protocol int
+
+const (
+	// ProtocolLegacy is the XOR autokey cipher on port 9999, which is all kasalink speaks
+	ProtocolLegacy Protocol = iota
+	// ProtocolKLAP is the authenticated HTTP protocol newer firmware moved to, kasalink can't talk to it yet
+	ProtocolKLAP
+)
+
+func (p Protocol) String() string {
+	if p == ProtocolKLAP {
+		return "KLAP"
+	}
+	return "legacy"
+}
+
+// Quirk is something a model does differently from the HS300 everything here was first written against
+type Quirk uint
+
+const (
+	// QuirkEmeterUnitsV1 is the hardware 1.x HS110 reporting realtime energy as floats in volts, amps, watts and
+	// kilowatt hours, instead of ints in milli-units and watt hours
+	QuirkEmeterUnitsV1 Quirk = 1 << iota
+)
+
+// Model is what we know about a Kasa model, that the device won't tell you itself
+type Model struct {
+	// Name is the model without its region, like "HS300"
+	Name     string
+	Kind     DeviceKind
+	Children int
+	// EnergyMeter is whether the model has an energy meter, even if its sysinfo feature doesn't say so
+	EnergyMeter bool
+	// Dimmable is whether a switch has brightness control, which a dimmer always does but a motion switch might not
+	Dimmable bool
+	Protocol Protocol
+	// KLAPHardware are hardware versions of an otherwise legacy model that only speak KLAP
+	KLAPHardware []string
+	Quirks       Quirk
+}
+
+// models is every model kasalink knows about, by name without region
+var models = map[string]Model{
+	"HS100":   {Name: "HS100", Kind: KindPlug, KLAPHardware: []string{"4.1"}},
+	"HS103":   {Name: "HS103", Kind: KindPlug},
+	"HS105":   {Name: "HS105", Kind: KindPlug},
+	"HS107":   {Name: "HS107", Kind: KindStrip, Children: 2},
+	"HS110":   {Name: "HS110", Kind: KindPlug, EnergyMeter: true, Quirks: QuirkEmeterUnitsV1},
+	"HS200":   {Name: "HS200", Kind: KindPlug},
+	"HS210":   {Name: "HS210", Kind: KindPlug},
+	"HS220":   {Name: "HS220", Kind: KindDimmer, Dimmable: true},
+	"HS300":   {Name: "HS300", Kind: KindStrip, Children: 6, EnergyMeter: true},
+	"KP115":   {Name: "KP115", Kind: KindPlug, EnergyMeter: true},
+	"KP125":   {Name: "KP125", Kind: KindPlug, EnergyMeter: true},
+	"KP125M":  {Name: "KP125M", Kind: KindPlug, EnergyMeter: true, Protocol: ProtocolKLAP},
+	"KP303":   {Name: "KP303", Kind: KindStrip, Children: 3},
+	"KP400":   {Name: "KP400", Kind: KindStrip, Children: 2},
+	"EP10":    {Name: "EP10", Kind: KindPlug},
+	"ES20M":   {Name: "ES20M", Kind: KindMotionSwitch, Dimmable: true},
+	"KS200M":  {Name: "KS200M", Kind: KindMotionSwitch},
+	"KL50":    {Name: "KL50", Kind: KindBulb, EnergyMeter: true},
+	"KL60":    {Name: "KL60", Kind: KindBulb, EnergyMeter: true},
+	"KL110":   {Name: "KL110", Kind: KindBulb, EnergyMeter: true},
+	"KL120":   {Name: "KL120", Kind: KindBulb, EnergyMeter: true},
+	"KL125":   {Name: "KL125", Kind: KindBulb, EnergyMeter: true},
+	"KL130":   {Name: "KL130", Kind: KindBulb, EnergyMeter: true},
+	"KL135":   {Name: "KL135", Kind: KindBulb, EnergyMeter: true},
+	"KL400L5": {Name: "KL400L5", Kind: KindLightStrip, EnergyMeter: true},
+	"KL420L5": {Name: "KL420L5", Kind: KindLightStrip, EnergyMeter: true},
+	"KL430":   {Name: "KL430", Kind: KindLightStrip, EnergyMeter: true},
+}
+
+// LookupModel finds a model in the registry. The region ("HS300(US)") is ignored, so is case.
+func LookupModel(model string) (Model, bool) {
+	if i := strings.IndexByte(model, '('); i >= 0 {
+		model = model[:i]
+	}
+	var m, ok = models[strings.ToUpper(strings.TrimSpace(model))]
+	return m, ok
+}
+
+// ModelOf finds the model for a device from its system info, with Protocol worked out for its hardware version
+func ModelOf(sysInfo *SystemInfo) (Model, bool) {
+	var m, ok = LookupModel(sysInfo.Model)
+	if !ok {
+		return m, false
+	}
+	for _, hw := range m.KLAPHardware {
+		if hw == sysInfo.HardwareVersion {
+			m.Protocol = ProtocolKLAP
+		}
+	}
+	if m.Quirks&QuirkEmeterUnitsV1 != 0 && !strings.HasPrefix(sysInfo.HardwareVersion, "1.") {
+		// hardware 2 and later report milli-units like everything else
+		m.Quirks &^= QuirkEmeterUnitsV1
+	}
+	return m, true
+}
+
+// quirks is the quirks of the device, if we know what it is
+func (kpp *KasaPowerPlug) quirks() Quirk {
+	if kpp.SysInfo == nil {
+		return 0
+	}
+	var m, _ = ModelOf(kpp.SysInfo)
+	return m.Quirks
+}
+
+// fromV1Units fills in the milli-unit fields from the float ones a hardware 1.x HS110 sends
+func (rt *realtimeEnergyMeter) fromV1Units() {
+	rt.Voltage = int(math.Round(rt.VoltageV * 1000))
+	rt.Current = int(math.Round(rt.CurrentA * 1000))
+	rt.Power = int(math.Round(rt.PowerW * 1000))
+	rt.TotalWatts = int(math.Round(rt.TotalKWh * 1000))
+}
+
+// Device is what every kind of Kasa device NewDevice can hand you has in common
+type Device interface {
+	GetSystemInfo() (*SystemInfo, error)
+	Capabilities() (Capabilities, error)
+	Close() error
+}
+
+// NewDevice asks the device at address what it is, and gives you the right type to talk to it with: a
+// *KasaPowerPlug for plugs and strips, a *Dimmer for dimmers, a *Bulb for bulbs, a *LightStrip for light strips and
+// a *MotionSwitch for motion switches. Models that aren't in the registry get their kind guessed from their system
+// info. Devices we can't talk to yet get you ErrNotSupported.
+func NewDevice(ctx context.Context, address string) (Device, error) {
+	var kpp = &KasaPowerPlug{
+		plugNetworkLocation: address,
+		timeout:             5 * time.Second,
+	}
+	kpp.Unsafe.kpp = kpp
+	var sysInfo, err = kpp.fetchSystemInfo(ctx)
+	if err != nil {
+		kpp.closer()
+		return nil, err
+	}
+	var m, known = ModelOf(sysInfo)
+	if !known {
+		var caps = CapabilitiesOf(sysInfo)
+		switch {
+		case sysInfo.MICType == "IOT.SMARTBULB" && sysInfo.Length > 0:
+			m.Kind = KindLightStrip
+		case sysInfo.MICType == "IOT.SMARTBULB":
+			m.Kind = KindBulb
+		case caps.Children > 0:
+			m.Kind = KindStrip
+		case caps.Dimming:
+			m.Kind = KindDimmer
+		default:
+			m.Kind = KindPlug
+		}
+	}
+	if m.Protocol == ProtocolKLAP {
+		kpp.closer()
+		return nil, fmt.Errorf("%w: %s hardware %s speaks KLAP", ErrNotSupported, sysInfo.Model,
+			sysInfo.HardwareVersion)
+	}
+	switch m.Kind {
+	case KindPlug, KindStrip:
+		return kpp, nil
+	case KindDimmer:
+		return &Dimmer{KasaPowerPlug: kpp}, nil
+	case KindBulb:
+		return newBulb(kpp), nil
+	case KindLightStrip:
+		return newLightStrip(kpp), nil
+	case KindMotionSwitch:
+		return &MotionSwitch{Dimmer: &Dimmer{KasaPowerPlug: kpp}}, nil
+	default:
+		kpp.closer()
+		return nil, fmt.Errorf("%w: %s is a %s", ErrNotSupported, sysInfo.Model, m.Kind)
+	}
+}
@@ -0,0 +1,122 @@
+package kasalink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestModelOf(t *testing.T) {
+	var m, ok = LookupModel("hs300(US)")
+	if !ok || m.Kind != KindStrip || m.Children != 6 || !m.EnergyMeter {
+		t.Fatalf("unexpected HS300 entry %+v (found: %t)", m, ok)
+	}
+	if _, ok = LookupModel("XX999(US)"); ok {
+		t.Fatal("made up model found in the registry")
+	}
+	if m, _ = ModelOf(&SystemInfo{Model: "HS110(UK)", HardwareVersion: "1.0"}); m.Quirks&QuirkEmeterUnitsV1 == 0 {
+		t.Fatal("hardware 1.0 HS110 should report emeter in V1 units")
+	}
+	if m, _ = ModelOf(&SystemInfo{Model: "HS110(UK)", HardwareVersion: "2.0"}); m.Quirks&QuirkEmeterUnitsV1 != 0 {
+		t.Fatal("hardware 2.0 HS110 shouldn't report emeter in V1 units")
+	}
+	if m, _ = ModelOf(&SystemInfo{Model: "HS100(UK)", HardwareVersion: "4.1"}); m.Protocol != ProtocolKLAP {
+		t.Fatalf("hardware 4.1 HS100 should be KLAP, not %s", m.Protocol)
+	}
+	if !CapabilitiesOf(&SystemInfo{Model: "KP115(US)", Feature: "TIM"}).EnergyMeter {
+		t.Fatal("KP115 should have an energy meter whatever its feature says")
+	}
+}
+
+func TestRealtimeEnergyMeter_fromV1Units(t *testing.T) {
+	var rt = realtimeEnergyMeter{VoltageV: 121.122, CurrentA: 0.034, PowerW: 2.079, TotalKWh: 3.376}
+	rt.fromV1Units()
+	if rt.Voltage != 121122 || rt.Current != 34 || rt.Power != 2079 || rt.TotalWatts != 3376 {
+		t.Fatalf("unexpected conversion %+v", rt)
+	}
+}
+
+// testDevice is what TestNewDevice needs from the mocks and the Simulator
+type testDevice interface {
+	Addr() string
+	Close() error
+}
+
+// simulating plays one of the Simulator's profiles for TestNewDevice
+func simulating(model string) func() (testDevice, error) {
+	return func() (testDevice, error) {
+		var profile, err = LoadSimulatorProfile(model)
+		if err != nil {
+			return nil, err
+		}
+		return NewSimulator(SimulatorConfig{Profile: profile})
+	}
+}
+
+func TestNewDevice(t *testing.T) {
+	var ctx = context.Background()
+	var tests = []struct {
+		name  string
+		serve func() (testDevice, error)
+		check func(Device) error
+	}{
+		{"HS300", func() (testDevice, error) {
+			var mp, err = NewMockPlug()
+			return &mp, err
+		}, func(device Device) error {
+			if _, ok := device.(*KasaPowerPlug); !ok {
+				return fmt.Errorf("expected a *KasaPowerPlug, got %T", device)
+			}
+			if caps, err := device.Capabilities(); err != nil || caps.Children != 6 {
+				return fmt.Errorf("expected 6 children, got %+v (%v)", caps, err)
+			}
+			return nil
+		}},
+		{"HS220", simulating("HS220"), func(device Device) error {
+			var d, ok = device.(*Dimmer)
+			if !ok {
+				return fmt.Errorf("expected a *Dimmer, got %T", device)
+			}
+			return d.SetBrightness(ctx, 60)
+		}},
+		{"KL130", simulating("KL130"), func(device Device) error {
+			if _, ok := device.(*Bulb); !ok {
+				return fmt.Errorf("expected a *Bulb, got %T", device)
+			}
+			return nil
+		}},
+		{"ES20M", func() (testDevice, error) { return NewMockMotionSwitch() }, func(device Device) error {
+			var ms, ok = device.(*MotionSwitch)
+			if !ok {
+				return fmt.Errorf("expected a *MotionSwitch, got %T", device)
+			}
+			if err := ms.SetBrightness(ctx, 60); err != nil {
+				return err
+			}
+			if brightness, err := ms.Brightness(ctx); err != nil || brightness != 60 {
+				return fmt.Errorf("brightness is %d after setting it to 60 (%v)", brightness, err)
+			}
+			return nil
+		}},
+	}
+	for _, tt := range tests {
+		var mock, err = tt.serve()
+		if err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+		var device Device
+		if device, err = NewDevice(ctx, mock.Addr()); err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+		} else {
+			if err = tt.check(device); err != nil {
+				t.Errorf("%s: %s", tt.name, err)
+			}
+			_ = device.Close()
+		}
+		_ = mock.Close()
+	}
+	if _, err := NewDevice(ctx, "127.0.0.1:1"); err == nil || errors.Is(err, ErrNotSupported) {
+		t.Fatalf("expected a connection error, got %v", err)
+	}
+}
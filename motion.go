@@ -0,0 +1,334 @@
+package kasalink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	pirModule         = "smartlife.iot.PIR"
+	lasModule         = "smartlife.iot.LAS"
+	getPIRConfig      = `{"smartlife.iot.PIR":{"get_config":{}}}`
+	getPIRADCValue    = `{"smartlife.iot.PIR":{"get_adc_value":{}}}`
+	getLASConfig      = `{"smartlife.iot.LAS":{"get_config":{}}}`
+	getLASBrightness  = `{"smartlife.iot.LAS":{"get_current_brt":{}}}`
+	maxMotionTimeout  = time.Hour
+	defaultMotionPoll = time.Second
+)
+
+// MotionSensitivity is how far away the motion sensor notices things
+type MotionSensitivity int
+
+// The sensitivities the Kasa app offers, they index into MotionConfig.Thresholds
+const (
+	MotionFar MotionSensitivity = iota
+	MotionMid
+	MotionNear
+)
+
+func (ms MotionSensitivity) String() string {
+	switch ms {
+	case MotionFar:
+		return "far"
+	case MotionMid:
+		return "mid"
+	case MotionNear:
+		return "near"
+	default:
+		return fmt.Sprintf("MotionSensitivity(%d)", int(ms))
+	}
+}
+
+// MotionConfig is the motion sensor's (PIR module's) settings
+type MotionConfig struct {
+	Enabled     bool
+	Sensitivity MotionSensitivity
+	// Thresholds are the percent of the sensor's range a reading has to pass to count as motion, one for each
+	// MotionSensitivity
+	Thresholds []int
+	// Timeout is how long after the last motion the switch turns the light off
+	Timeout time.Duration
+	MinADC  int
+	MaxADC  int
+}
+
+// threshold is the percent a reading has to pass to be motion, at the configured sensitivity
+func (mc *MotionConfig) threshold() int {
+	if int(mc.Sensitivity) < 0 || int(mc.Sensitivity) >= len(mc.Thresholds) {
+		return 50
+	}
+	return mc.Thresholds[mc.Sensitivity]
+}
+
+// percent turns a raw reading into a percent of the sensor's range
+func (mc *MotionConfig) percent(adc int) float64 {
+	if mc.MaxADC <= mc.MinADC {
+		return 0
+	}
+	return float64(adc-mc.MinADC) * 100 / float64(mc.MaxADC-mc.MinADC)
+}
+
+// LightLevel is one of the ambient light sensor's named lux thresholds, like "cloudy" or "dark"
+type LightLevel struct {
+	Name  string `json:"name"`
+	ADC   int    `json:"adc"`
+	Value int    `json:"value"`
+}
+
+// LightSensorConfig is the ambient light sensor's (LAS module's) settings
+type LightSensorConfig struct {
+	Enabled bool
+	// Levels are the lux thresholds to pick from, DarkIndex is the one below which the switch responds to motion
+	Levels    []LightLevel
+	DarkIndex int
+	MinADC    int
+	MaxADC    int
+}
+
+// MotionEvent is a change MotionSwitch.WatchMotion noticed. If Err is set, the poll at Time failed and the rest is
+// the last good reading.
+type MotionEvent struct {
+	Time   time.Time
+	Motion bool
+	// Percent is how far into the sensor's range the reading was
+	Percent float64
+	Err     error
+}
+
+// MotionSwitch is a Kasa switch with a motion sensor and an ambient light sensor, like the ES20M or KS200M. It's a
+// Dimmer, the dimmer controls only work on models that dim.
+type MotionSwitch struct {
+	*Dimmer
+}
+
+// NewMotionSwitch gives you a MotionSwitch that's already gotten its system info
+func NewMotionSwitch(ctx context.Context, address string) (*MotionSwitch, error) {
+	var d, err = NewDimmer(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	return &MotionSwitch{Dimmer: d}, nil
+}
+
+// MotionConfig asks the switch for its motion sensor settings
+func (ms *MotionSwitch) MotionConfig(ctx context.Context) (*MotionConfig, error) {
+	var response, err = ms.sensor(ctx, getPIRConfig, pirModule, "get_config")
+	if err != nil {
+		return nil, err
+	}
+	var c = response.PIR.GetConfig
+	return &MotionConfig{
+		Enabled:     c.Enable == 1,
+		Sensitivity: MotionSensitivity(c.TriggerIndex),
+		Thresholds:  c.Array,
+		Timeout:     time.Duration(c.ColdTime) * time.Millisecond,
+		MinADC:      c.MinADC,
+		MaxADC:      c.MaxADC,
+	}, nil
+}
+
+// SetMotionEnabled turns the motion sensor on or off
+func (ms *MotionSwitch) SetMotionEnabled(ctx context.Context, enabled bool) error {
+	return ms.setSensor(ctx, pirModule, "set_enable", map[string]int{"enable": boolToInt(enabled)})
+}
+
+// SetMotionSensitivity sets how far away the motion sensor notices things
+func (ms *MotionSwitch) SetMotionSensitivity(ctx context.Context, sensitivity MotionSensitivity) error {
+	if sensitivity < MotionFar || sensitivity > MotionNear {
+		return fmt.Errorf("%s isn't a motion sensitivity", sensitivity)
+	}
+	return ms.setSensor(ctx, pirModule, "set_trigger_sens", map[string]int{"index": int(sensitivity)})
+}
+
+// SetMotionTimeout sets how long after the last motion the switch turns the light off, up to an hour
+func (ms *MotionSwitch) SetMotionTimeout(ctx context.Context, timeout time.Duration) error {
+	if timeout < time.Second || timeout > maxMotionTimeout {
+		return fmt.Errorf("motion timeouts are a second to %s, not %s", maxMotionTimeout, timeout)
+	}
+	return ms.setSensor(ctx, pirModule, "set_cold_time", map[string]int{"cold_time": int(timeout / time.Millisecond)})
+}
+
+// MotionReading asks the motion sensor for its raw reading right now
+func (ms *MotionSwitch) MotionReading(ctx context.Context) (int, error) {
+	var response, err = ms.sensor(ctx, getPIRADCValue, pirModule, "get_adc_value")
+	if err != nil {
+		return 0, err
+	}
+	return response.PIR.GetADCValue.Value, nil
+}
+
+// LightSensorConfig asks the switch for its ambient light sensor settings
+func (ms *MotionSwitch) LightSensorConfig(ctx context.Context) (*LightSensorConfig, error) {
+	var response, err = ms.sensor(ctx, getLASConfig, lasModule, "get_config")
+	if err != nil {
+		return nil, err
+	}
+	var c = response.LAS.GetConfig
+	if len(c.Devs) == 0 {
+		return nil, fmt.Errorf("%s.get_config didn't list a sensor", lasModule)
+	}
+	var dev = c.Devs[0]
+	return &LightSensorConfig{
+		Enabled:   dev.Enable == 1,
+		Levels:    dev.LevelArray,
+		DarkIndex: dev.DarkIndex,
+		MinADC:    dev.MinADC,
+		MaxADC:    dev.MaxADC,
+	}, nil
+}
+
+// SetLightSensorEnabled turns the ambient light sensor on or off. With it off, the switch responds to motion no
+// matter how bright it is.
+func (ms *MotionSwitch) SetLightSensorEnabled(ctx context.Context, enabled bool) error {
+	return ms.setSensor(ctx, lasModule, "set_enable", map[string]int{"enable": boolToInt(enabled)})
+}
+
+// SetLuxThreshold changes the value of the light level at index
+func (ms *MotionSwitch) SetLuxThreshold(ctx context.Context, index, value int) error {
+	if index < 0 || value < 0 {
+		return fmt.Errorf("light level %d can't be set to %d", index, value)
+	}
+	return ms.setSensor(ctx, lasModule, "set_brt_level", map[string]int{"index": index, "value": value})
+}
+
+// AmbientLight asks the ambient light sensor how bright it is right now
+func (ms *MotionSwitch) AmbientLight(ctx context.Context) (int, error) {
+	var response, err = ms.sensor(ctx, getLASBrightness, lasModule, "get_current_brt")
+	if err != nil {
+		return 0, err
+	}
+	return response.LAS.GetCurrentBrt.Value, nil
+}
+
+// WatchMotion polls the motion sensor every interval (a second if it's zero) until ctx is done, and sends a
+// MotionEvent whenever motion starts or stops, and whenever a poll fails. The channel is closed when it's done.
+// The sensitivity and range are read once up front, so changes to them after that aren't noticed.
+func (ms *MotionSwitch) WatchMotion(ctx context.Context, interval time.Duration) (<-chan MotionEvent, error) {
+	if interval <= 0 {
+		interval = defaultMotionPoll
+	}
+	var config, err = ms.MotionConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var events = make(chan MotionEvent)
+	go func() {
+		defer close(events)
+		var (
+			ticker = time.NewTicker(interval)
+			last   MotionEvent
+			first  = true
+		)
+		defer ticker.Stop()
+		for {
+			var adc, err = ms.MotionReading(ctx)
+			var event = MotionEvent{Time: time.Now(), Motion: last.Motion, Percent: last.Percent, Err: err}
+			if err == nil {
+				event.Percent = config.percent(adc)
+				event.Motion = event.Percent > float64(config.threshold())
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil || first || event.Motion != last.Motion {
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if err == nil {
+				last, first = event, false
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return events, nil
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// setSensor sends a single PIR or LAS method that only answers with an err_code, and checks it
+func (ms *MotionSwitch) setSensor(ctx context.Context, module, method string, args interface{}) error {
+	var b, err = json.Marshal(args)
+	if err != nil {
+		return err
+	}
+	_, err = ms.sensor(ctx, fmt.Sprintf(`{%q:{%q:%s}}`, module, method, b), module, method)
+	return err
+}
+
+// sensor sends a single PIR or LAS method and makes sure the switch answered it without complaint
+func (ms *MotionSwitch) sensor(ctx context.Context, cmd, module, method string) (*KasaResponse, error) {
+	if err := ms.require("motion sensor", func(caps Capabilities) bool { return caps.Motion }); err != nil {
+		return nil, err
+	}
+	var response, err = ms.query(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		answer *thingWithErrCode
+		parent *thingWithErrCode
+	)
+	switch module {
+	case pirModule:
+		if response.PIR == nil {
+			return nil, errNoAnswer(module, method)
+		}
+		parent = &response.PIR.thingWithErrCode
+		switch method {
+		case "get_config":
+			if response.PIR.GetConfig != nil {
+				answer = &response.PIR.GetConfig.thingWithErrCode
+			}
+		case "get_adc_value":
+			if response.PIR.GetADCValue != nil {
+				answer = &response.PIR.GetADCValue.thingWithErrCode
+			}
+		case "set_enable":
+			answer = response.PIR.SetEnable
+		case "set_trigger_sens":
+			answer = response.PIR.SetTriggerSens
+		case "set_cold_time":
+			answer = response.PIR.SetColdTime
+		}
+	case lasModule:
+		if response.LAS == nil {
+			return nil, errNoAnswer(module, method)
+		}
+		parent = &response.LAS.thingWithErrCode
+		switch method {
+		case "get_config":
+			if response.LAS.GetConfig != nil {
+				answer = &response.LAS.GetConfig.thingWithErrCode
+			}
+		case "get_current_brt":
+			if response.LAS.GetCurrentBrt != nil {
+				answer = &response.LAS.GetCurrentBrt.thingWithErrCode
+			}
+		case "set_enable":
+			answer = response.LAS.SetEnable
+		case "set_brt_level":
+			answer = response.LAS.SetBrtLevel
+		}
+	}
+	if answer == nil {
+		return nil, parent.missing(module, method)
+	}
+	if err = answer.err(module, method); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
@@ -0,0 +1,101 @@
+package kasalink
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMotionSwitch(t *testing.T) {
+	var md, err = NewMockMotionSwitch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer md.Close()
+	var (
+		ctx    = context.Background()
+		device Device
+	)
+	if device, err = NewDevice(ctx, md.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	var ms, ok = device.(*MotionSwitch)
+	if !ok {
+		t.Fatalf("expected a *MotionSwitch for an ES20M, got %T", device)
+	}
+	defer ms.Close()
+
+	if err = ms.SetMotionSensitivity(ctx, MotionNear); err != nil {
+		t.Fatal(err)
+	}
+	if err = ms.SetMotionTimeout(ctx, 5*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	var config *MotionConfig
+	if config, err = ms.MotionConfig(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !config.Enabled || config.Sensitivity != MotionNear || config.Timeout != 5*time.Minute ||
+		config.threshold() != 20 {
+		t.Fatalf("unexpected motion config %+v", config)
+	}
+
+	if err = ms.SetLuxThreshold(ctx, 5, 40); err != nil {
+		t.Fatal(err)
+	}
+	if err = ms.SetLightSensorEnabled(ctx, false); err != nil {
+		t.Fatal(err)
+	}
+	var las *LightSensorConfig
+	if las, err = ms.LightSensorConfig(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if las.Enabled || len(las.Levels) != 6 || las.Levels[5].Value != 40 {
+		t.Fatalf("unexpected light sensor config %+v", las)
+	}
+	var ambient int
+	if ambient, err = ms.AmbientLight(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("ambient light is %d", ambient)
+
+	// an ES20M is a dimmer as well as a motion sensor
+	if err = ms.SetBrightness(ctx, 35); err != nil {
+		t.Fatal(err)
+	}
+	var brightness int
+	if brightness, err = ms.Brightness(ctx); err != nil || brightness != 35 {
+		t.Fatalf("brightness is %d after setting it to 35: %v", brightness, err)
+	}
+	if err = ms.SetFadeOnTime(ctx, 2*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	var settings *DimmerSettings
+	if settings, err = ms.Settings(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if settings.FadeOn != 2*time.Second {
+		t.Fatalf("unexpected dimmer settings %+v", settings)
+	}
+
+	var watchCtx, cancel = context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	var events <-chan MotionEvent
+	if events, err = ms.WatchMotion(watchCtx, 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if event := <-events; event.Err != nil || event.Motion {
+		t.Fatalf("expected no motion to start with, got %+v", event)
+	}
+	md.SetMotionReading(3000)
+	if event := <-events; event.Err != nil || !event.Motion {
+		t.Fatalf("expected motion, got %+v", event)
+	}
+	md.SetMotionReading(100)
+	if event := <-events; event.Err != nil || event.Motion {
+		t.Fatalf("expected motion to stop, got %+v", event)
+	}
+	cancel()
+	for range events {
+	}
+}
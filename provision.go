@@ -0,0 +1,112 @@
+package kasalink
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// DefaultSetupAddress is where a factory fresh (or factory reset) device answers, on the open network it puts up
+// for setup. Join that network first.
+const DefaultSetupAddress = "192.168.0.1:9999"
+
+// ProvisionConfig is everything Provision needs to take a factory fresh device and put it on your network
+type ProvisionConfig struct {
+	// SetupAddress defaults to DefaultSetupAddress
+	SetupAddress string
+	// Alias, Timezone (an IANA zone name) and CloudServer are only set when they aren't empty
+	Alias       string
+	Timezone    string
+	CloudServer string
+	// Location is only set when it isn't the zero Location
+	Location Location
+	SSID     string
+	Password string
+	// KeyType is the security on SSID, it goes to JoinWiFi as it is, so set KeyTypeAuto to have the device find out
+	KeyType KeyType
+	// DiscoveryAddress is where to look for the device once it's joined, it defaults to DefaultDiscoveryAddress
+	DiscoveryAddress string
+	// DiscoveryTimeout is how long the device gets to show up on the LAN, it defaults to two minutes
+	DiscoveryTimeout time.Duration
+}
+
+// Provision sets up a factory fresh device and sends it off to join your Wi-Fi, then waits until it turns up on
+// your LAN. It never binds the device to a TP-Link cloud account. You have to be on the device's setup network to
+// start with, and Provision needs your host to end up on SSID (or at least able to hear from it) to finish.
+func Provision(ctx context.Context, cfg ProvisionConfig) (*DiscoveredDevice, error) {
+	if cfg.SetupAddress == "" {
+		cfg.SetupAddress = DefaultSetupAddress
+	}
+	var kpp = &KasaPowerPlug{
+		plugNetworkLocation: cfg.SetupAddress,
+		timeout:             5 * time.Second,
+	}
+	defer kpp.closer()
+	return kpp.provision(ctx, cfg)
+}
+
+func (kpp *KasaPowerPlug) provision(ctx context.Context, cfg ProvisionConfig) (*DiscoveredDevice, error) {
+	if cfg.SSID == "" {
+		return nil, fmt.Errorf("provisioning needs an SSID to join")
+	}
+	// a bad location would otherwise only turn up after the alias and timezone were already changed
+	if err := cfg.Location.Validate(); err != nil {
+		return nil, err
+	}
+	var sysInfo, err = kpp.fetchSystemInfo(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("talking to the device at %s: %w", kpp.plugNetworkLocation, err)
+	}
+	if cfg.Alias != "" {
+		if err = kpp.SetAlias(ctx, cfg.Alias); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Timezone != "" {
+		if err = kpp.SetTimezone(ctx, cfg.Timezone); err != nil {
+			return nil, err
+		}
+	}
+	if !cfg.Location.IsZero() {
+		if err = kpp.SetLocation(ctx, cfg.Location); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.CloudServer != "" {
+		if err = kpp.SetCloudServer(ctx, cfg.CloudServer); err != nil {
+			return nil, err
+		}
+	}
+	if err = kpp.JoinWiFi(ctx, cfg.SSID, cfg.Password, cfg.KeyType); err != nil {
+		return nil, err
+	}
+	return findOnLAN(ctx, sysInfo.DeviceID, cfg.DiscoveryAddress, cfg.DiscoveryTimeout)
+}
+
+// findOnLAN keeps running discovery until the device with deviceID answers, or timeout runs out
+func findOnLAN(ctx context.Context, deviceID, address string, timeout time.Duration) (*DiscoveredDevice, error) {
+	if timeout == 0 {
+		timeout = 2 * time.Minute
+	}
+	var ctx2, cancel = context.WithTimeout(ctx, timeout)
+	defer cancel()
+	for {
+		var found, err = Discover(ctx2, address, 3*time.Second)
+		for i := range found {
+			if found[i].SysInfo.DeviceID == deviceID {
+				return &found[i], nil
+			}
+		}
+		if ctx2.Err() != nil {
+			return nil, fmt.Errorf("device %s joined the network but never showed up on the LAN: %w", deviceID,
+				ctx2.Err())
+		}
+		if err != nil {
+			// most likely our host is still finding its way back onto the LAN, so wait and try again
+			select {
+			case <-ctx2.Done():
+			case <-time.After(time.Second):
+			}
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package kasalink
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestProvision(t *testing.T) {
+	var s, err = NewSimulator(SimulatorConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	var dr *DiscoveryResponder
+	if dr, err = NewDiscoveryResponder("", s); err != nil {
+		t.Fatal(err)
+	}
+	defer dr.Close()
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var found *DiscoveredDevice
+	found, err = Provision(ctx, ProvisionConfig{
+		SetupAddress:     s.Addr(),
+		Alias:            "Sump Pump",
+		Timezone:         "America/Chicago",
+		Location:         Location{Lat: 39.1156, Lon: -77.5702},
+		CloudServer:      "127.0.0.1",
+		SSID:             "ReefNet",
+		Password:         "hunter2",
+		KeyType:          KeyTypeAuto,
+		DiscoveryAddress: dr.Addr(),
+		DiscoveryTimeout: 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.SysInfo.Alias != "Sump Pump" {
+		t.Errorf("found %s at %s", found.SysInfo.Alias, found.Address)
+	}
+	if wifi := s.WiFi(); wifi.SSID != "ReefNet" || wifi.KeyType != KeyTypeWPA2 {
+		t.Errorf("device joined %+v", wifi)
+	}
+
+	// the device has left the setup network, so ask the Simulator itself what it was left with
+	var state KasaResponse
+	var answer = s.answer([]byte(`{"system":{"get_sysinfo":{}},"cnCloud":{"get_info":{}},"time":{"get_timezone":{}}}`))
+	if err = json.Unmarshal([]byte(answer), &state); err != nil {
+		t.Fatal(err)
+	}
+	if state.System == nil || state.System.GetSysInfo == nil || state.CnCloud == nil || state.CnCloud.GetInfo == nil ||
+		state.Time == nil || state.Time.GetTimezone == nil {
+		t.Fatalf("Simulator answered %s", answer)
+	}
+	var sysInfo = state.System.GetSysInfo
+	if sysInfo.Alias != "Sump Pump" || sysInfo.Location() != (Location{Lat: 39.1156, Lon: -77.5702}) {
+		t.Errorf("device was left as %s at %+v", sysInfo.Alias, sysInfo.Location())
+	}
+	if cloud := state.CnCloud.GetInfo; cloud.Server != "127.0.0.1" || cloud.Binded != 0 {
+		t.Errorf("device was left on %s, bound: %d", cloud.Server, cloud.Binded)
+	}
+	if want, _ := TimezoneIndex("America/Chicago"); state.Time.GetTimezone.Index != want {
+		t.Errorf("device was left on timezone %d, not %d", state.Time.GetTimezone.Index, want)
+	}
+}
@@ -0,0 +1,234 @@
+package kasalink
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Recording is one request to a device and its answer, decrypted. A Recorder writes them out as JSON lines and a
+// Replayer plays them back.
+type Recording struct {
+	Time time.Time `json:"time"`
+	// Device is the address the request went to
+	Device   string          `json:"device"`
+	Request  json.RawMessage `json:"request"`
+	Response json.RawMessage `json:"response"`
+}
+
+// Recorder sits between clients and real devices and writes down everything they say to each other, one Recording
+// per line. Point a client at the address Proxy gives you instead of the device's, it can't tell the difference.
+// It only proxies TCP.
+type Recorder struct {
+	lock      sync.Mutex
+	enc       *json.Encoder
+	listeners []net.Listener
+}
+
+// NewRecorder gives you a Recorder that writes its recordings to w
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{enc: json.NewEncoder(w)}
+}
+
+// Proxy starts passing connections on listen (a free port on localhost if it's empty) through to device, recording
+// as it goes, and gives you the address it's listening on
+func (r *Recorder) Proxy(listen, device string) (string, error) {
+	if listen == "" {
+		listen = "127.0.0.1:0"
+	}
+	var ln, err = net.Listen("tcp", listen)
+	if err != nil {
+		return "", err
+	}
+	r.lock.Lock()
+	r.listeners = append(r.listeners, ln)
+	r.lock.Unlock()
+	go func() {
+		for {
+			var client, err = ln.Accept()
+			if err != nil {
+				return
+			}
+			go r.relay(client, device)
+		}
+	}()
+	return ln.Addr().String(), nil
+}
+
+// Close stops every Proxy, connections already made carry on until either end hangs up
+func (r *Recorder) Close() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	var errs []error
+	for _, ln := range r.listeners {
+		if err := ln.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	r.listeners = nil
+	if len(errs) > 0 {
+		return fmt.Errorf("closing %d recorder proxies: %v", len(errs), errs)
+	}
+	return nil
+}
+
+// relay passes requests from client to device and answers back, one at a time, until one of them hangs up. Each
+// answer is written down before the client gets it.
+func (r *Recorder) relay(client net.Conn, device string) {
+	defer client.Close()
+	var conn, err = net.DialTimeout("tcp", device, 5*time.Second)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	for {
+		var request, response []byte
+		if request, err = readFrame(client); err != nil {
+			return
+		}
+		var sent = time.Now()
+		if _, err = conn.Write(request); err != nil {
+			return
+		}
+		if response, err = readFrame(conn); err != nil {
+			return
+		}
+		// decrypt works in place, and the answer still has to go to the client
+		r.record(Recording{Time: sent, Device: device, Request: recordable(decrypt(request[4:])),
+			Response: recordable(decrypt(append([]byte(nil), response[4:]...)))})
+		if _, err = client.Write(response); err != nil {
+			return
+		}
+	}
+}
+
+func (r *Recorder) record(rec Recording) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	// a recording that can't be written is a shame, but not a reason to cut off the client
+	_ = r.enc.Encode(rec)
+}
+
+// readFrame reads one length prefixed frame, header and all, still encrypted
+func readFrame(src io.Reader) ([]byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(src, header[:]); err != nil {
+		return nil, err
+	}
+	var frame = make([]byte, 4+binary.BigEndian.Uint32(header[:]))
+	copy(frame, header[:])
+	if _, err := io.ReadFull(src, frame[4:]); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+// recordable is clearBits as it goes in a Recording: as is if it's JSON, like it should be, as a JSON string if not
+func recordable(clearBits []byte) json.RawMessage {
+	if json.Valid(clearBits) {
+		return clearBits
+	}
+	var quoted, _ = json.Marshal(string(clearBits))
+	return quoted
+}
+
+// ReadRecordings reads the JSON lines a Recorder wrote
+func ReadRecordings(r io.Reader) ([]Recording, error) {
+	var (
+		recordings []Recording
+		scanner    = bufio.NewScanner(r)
+	)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var rec Recording
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("recording line %d: %w", line, err)
+		}
+		recordings = append(recordings, rec)
+	}
+	return recordings, scanner.Err()
+}
+
+// replayNotRecorded is the err_code answer a Replayer gives to a request it has no recording of
+var replayNotRecorded = SimulatorError{Code: -1, Message: "no recording of that request"}
+
+// Replayer is a pretend device that answers with Recordings: a request gets the recorded answer to the same request,
+// the same JSON down to key order and spacing not mattering. A request recorded more than once gets its answers in
+// the order they were recorded, and then the last one over again. Like the Simulator, it answers TCP and UDP.
+type Replayer struct {
+	*mockServer
+	lock    sync.Mutex
+	answers map[string][]json.RawMessage
+	misses  []string
+}
+
+// NewReplayer starts a Replayer answering with recordings on address, a free port on localhost if it's empty.
+// Recordings of more than one device should be split up by Device first, one Replayer each.
+func NewReplayer(address string, recordings []Recording) (*Replayer, error) {
+	var rp = &Replayer{answers: map[string][]json.RawMessage{}}
+	for _, rec := range recordings {
+		var key, err = normalizeRequest(rec.Request)
+		if err != nil {
+			return nil, fmt.Errorf("recording from %s: %w", rec.Time.Format(time.RFC3339), err)
+		}
+		rp.answers[key] = append(rp.answers[key], rec.Response)
+	}
+	var err error
+	if address == "" {
+		rp.mockServer, err = startMockServer(rp.answer)
+	} else {
+		rp.mockServer, err = listenMockServer(address, rp.answer)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rp, nil
+}
+
+// Misses are the requests the Replayer had no recording of, normalized, in the order they came in
+func (rp *Replayer) Misses() []string {
+	rp.lock.Lock()
+	defer rp.lock.Unlock()
+	return append([]string(nil), rp.misses...)
+}
+
+func (rp *Replayer) answer(clearBits []byte) string {
+	var key, _ = normalizeRequest(recordable(clearBits))
+	rp.lock.Lock()
+	defer rp.lock.Unlock()
+	var answers = rp.answers[key]
+	if len(answers) == 0 {
+		rp.misses = append(rp.misses, key)
+		var b, _ = json.Marshal(replayNotRecorded)
+		return string(b)
+	}
+	if len(answers) > 1 {
+		rp.answers[key] = answers[1:]
+	}
+	var response = answers[0]
+	// a response that was recorded as a string wasn't JSON to begin with, send it the way it came
+	var garbled string
+	if json.Unmarshal(response, &garbled) == nil {
+		return garbled
+	}
+	return string(response)
+}
+
+// normalizeRequest is request re-encoded so the same request always comes out the same, whatever order its keys
+// were in and however it was spaced
+func normalizeRequest(request []byte) (string, error) {
+	var v interface{}
+	if err := json.Unmarshal(request, &v); err != nil {
+		return "", err
+	}
+	var b, err = json.Marshal(v)
+	return string(b), err
+}
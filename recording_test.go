@@ -0,0 +1,107 @@
+package kasalink
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	var s, err = NewSimulator(SimulatorConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	var (
+		log      bytes.Buffer
+		recorder = NewRecorder(&log)
+		proxy    string
+	)
+	if proxy, err = recorder.Proxy("", s.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	defer recorder.Close()
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var device Device
+	if device, err = NewDevice(ctx, proxy); err != nil {
+		t.Fatal(err)
+	}
+	var kpp = device.(*KasaPowerPlug)
+	if err = kpp.SetAlias(ctx, "Return pump", 2); err != nil {
+		t.Fatal(err)
+	}
+	var recorded *EMeterReading
+	if recorded, err = kpp.EMeterReading(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	_ = device.Close()
+
+	var recordings []Recording
+	if recordings, err = ReadRecordings(&log); err != nil {
+		t.Fatal(err)
+	}
+	if len(recordings) != 3 {
+		t.Fatalf("recorded %d exchanges: %+v", len(recordings), recordings)
+	}
+	for _, rec := range recordings {
+		if rec.Device != s.Addr() || rec.Time.IsZero() {
+			t.Errorf("recorded %+v", rec)
+		}
+	}
+	if !strings.Contains(string(recordings[1].Request), `"Return pump"`) ||
+		!strings.Contains(string(recordings[2].Response), `"current_ma"`) {
+		t.Errorf("recorded %s and %s", recordings[1].Request, recordings[2].Response)
+	}
+
+	// the same conversation with nobody home gets the same answers
+	_ = s.Close()
+	var rp *Replayer
+	if rp, err = NewReplayer("", recordings); err != nil {
+		t.Fatal(err)
+	}
+	defer rp.Close()
+	if device, err = NewDevice(ctx, rp.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	defer device.Close()
+	kpp = device.(*KasaPowerPlug)
+	if len(kpp.SysInfo.Children) != 6 {
+		t.Errorf("replayed an HS300 with %d outlets", len(kpp.SysInfo.Children))
+	}
+	if err = kpp.SetAlias(ctx, "Return pump", 2); err != nil {
+		t.Fatal(err)
+	}
+	var replayed *EMeterReading
+	if replayed, err = kpp.EMeterReading(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if *replayed != *recorded {
+		t.Errorf("replayed %+v, recorded %+v", replayed, recorded)
+	}
+	if len(rp.Misses()) != 0 {
+		t.Errorf("missed %v", rp.Misses())
+	}
+	if err = kpp.SetAlias(ctx, "Skimmer", 2); err == nil {
+		t.Error("replayed something that wasn't recorded")
+	}
+	if misses := rp.Misses(); len(misses) != 1 || !strings.Contains(misses[0], `"Skimmer"`) {
+		t.Errorf("missed %v", misses)
+	}
+}
+
+func TestNormalizeRequest(t *testing.T) {
+	var a, err = normalizeRequest([]byte(`{"system":{"set_dev_alias":{"alias":"a"}},"context":{"child_ids":["01"]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b string
+	if b, err = normalizeRequest([]byte(`{ "context": {"child_ids": ["01"]}, "system": {"set_dev_alias": {"alias": "a"}} }`)); err != nil {
+		t.Fatal(err)
+	}
+	if a != b {
+		t.Errorf("%s isn't %s", a, b)
+	}
+}
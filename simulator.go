@@ -0,0 +1,918 @@
+package kasalink
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Simulator is a virtual Kasa device for integration tests. Unlike MockPlug it actually keeps state: relays, the
+// LED, aliases, location, timezone, cloud and Wi-Fi settings, dimmer settings, schedule, countdown and away rules and
+// energy meter gains all stick, and get_sysinfo reflects them. It takes as many connections as you like, over TCP and
+// UDP, and understands the child context wrapper. What device it plays is up to its SimulatorProfile, and it can be
+// made to misbehave with Faults.
+type Simulator struct {
+	*mockServer
+	lock    sync.Mutex
+	profile *SimulatorProfile
+	modules map[string]bool
+	// sysInfo is the device's system info, less what the Simulator keeps track of itself
+	sysInfo  map[string]interface{}
+	ledOff   bool
+	location Location
+	timezone int
+	// clockOffset is how far the device's clock has been set from now, by set_timezone
+	clockOffset time.Duration
+	cloud       simCloud
+	// accessPoints are the networks the device can see, wifi the one it was last told to join
+	accessPoints []AccessPoint
+	wifi         AccessPoint
+	// device is the device's own state, children its outlets (if it has any)
+	device   *simOutlet
+	children []*simOutlet
+	// brightness and dimmerSettings are for dimmers, light for bulbs
+	brightness     int
+	dimmerSettings *dimmerSettings
+	light          *lightState
+	now            func() time.Time
+}
+
+// SimulatorConfig is how to set up a Simulator
+type SimulatorConfig struct {
+	// Address is where the Simulator listens, TCP and UDP. It defaults to a free port on localhost.
+	Address string
+	// Profile is the device to play, it defaults to the HS300 from SimulatorProfiles
+	Profile *SimulatorProfile
+	// Clock is where the Simulator gets the time, for its device clock, on times and energy use. It defaults to
+	// time.Now, a ManualClock's Now lets a test move time along itself.
+	Clock func() time.Time
+	// AccessPoints are the Wi-Fi networks the device sees when it scans, it defaults to simAccessPoints
+	AccessPoints []AccessPoint
+}
+
+// simOutlet is the state of one outlet, or of the device itself
+type simOutlet struct {
+	id    string
+	alias string
+	state int
+	// onSince is when the relay last turned on
+	onSince time.Time
+	// schedule, countDown and antiTheft are the rules in each of those modules
+	schedule, countDown, antiTheft simRules
+	// load is what's plugged in, what its energy meter reads (through gains) while it's on
+	load  Load
+	gains EMeterGains
+	// totalWh and days are what it's used since the stats were erased, updated to lastUpdate
+	totalWh    float64
+	days       map[simDay]*simUsage
+	lastUpdate time.Time
+}
+
+// simRules are the rules in one of the rule modules (schedule, count_down and anti_theft all work the same way)
+type simRules struct {
+	list []map[string]interface{}
+	// enabled is set_overall_enable
+	enabled bool
+}
+
+// simCloud is the device's cnCloud settings. Nothing's out there to connect to, so it never says it's connected.
+type simCloud struct {
+	server   string
+	username string
+	binded   bool
+}
+
+// simDay is a day on the device's clock
+type simDay struct {
+	year  int
+	month time.Month
+	day   int
+}
+
+// simUsage is what an outlet used over a day
+type simUsage struct {
+	energyWh float64
+	onTime   time.Duration
+}
+
+// simUsageStep is how finely the Simulator works out energy use, loads that change faster than this get sampled
+const simUsageStep = time.Minute
+
+const (
+	// simVoltage is the voltage every Simulator outlet sees, in millivolts
+	simVoltage = 120000
+	// simErrNoChild is what a strip says to a child_id it doesn't have
+	simErrNoChild = -14
+	// simDefaultProfile is who the Simulator plays if you don't say
+	simDefaultProfile = "HS300"
+	// simDefaultTimezone is the timezone a Simulator starts out in, EST5EDT
+	simDefaultTimezone = 17
+)
+
+// simAccessPoints are the networks a Simulator sees if you don't say
+var simAccessPoints = []AccessPoint{
+	{SSID: "ReefNet", KeyType: KeyTypeWPA2, RSSI: -48},
+	{SSID: "Guest", KeyType: KeyTypeNone, RSSI: -71},
+}
+
+// simNominalGains are the gains a simulated energy meter reads right with
+var simNominalGains = EMeterGains{VGain: 13462, IGain: 16835}
+
+// NewSimulator starts a Simulator
+func NewSimulator(cfg SimulatorConfig) (*Simulator, error) {
+	var (
+		s   = &Simulator{now: time.Now, timezone: simDefaultTimezone, cloud: simCloud{server: DefaultCloudServer}}
+		err error
+	)
+	if cfg.Clock != nil {
+		s.now = cfg.Clock
+	}
+	s.accessPoints = cfg.AccessPoints
+	if s.accessPoints == nil {
+		s.accessPoints = simAccessPoints
+	}
+	if cfg.Profile == nil {
+		if cfg.Profile, err = LoadSimulatorProfile(simDefaultProfile); err != nil {
+			return nil, err
+		}
+	}
+	if err = s.load(cfg.Profile); err != nil {
+		return nil, err
+	}
+	if cfg.Address == "" {
+		s.mockServer, err = startMockServer(s.answer)
+	} else {
+		s.mockServer, err = listenMockServer(cfg.Address, s.answer)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Profile is the profile the Simulator was started with
+func (s *Simulator) Profile() *SimulatorProfile {
+	return s.profile
+}
+
+// WiFi is the network the device was last told to join, with the key type it was told to use. The SSID is blank if
+// it hasn't been told to join one.
+func (s *Simulator) WiFi() AccessPoint {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.wifi
+}
+
+// Outlets is how many outlets the device has, 0 if it's a single plug (or a bulb, or a switch)
+func (s *Simulator) Outlets() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.children)
+}
+
+// SetLoad changes what's plugged into an outlet, or into the device itself for child -1
+func (s *Simulator) SetLoad(child int, load Load) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var o, err = s.outlet(child)
+	if err != nil {
+		return err
+	}
+	s.advance(s.now())
+	o.load = load
+	return nil
+}
+
+// outlet is the outlet child, or the device itself for -1
+func (s *Simulator) outlet(child int) (*simOutlet, error) {
+	switch {
+	case child == -1:
+		return s.device, nil
+	case child < 0 || child >= len(s.children):
+		return nil, fmt.Errorf("%s has %d outlets, there's no %d", s.profile.Name, len(s.children), child)
+	}
+	return s.children[child], nil
+}
+
+// load sets the Simulator up to play profile
+func (s *Simulator) load(profile *SimulatorProfile) error {
+	var (
+		info    map[string]interface{}
+		sysInfo SystemInfo
+	)
+	if err := json.Unmarshal(profile.SysInfo, &info); err != nil {
+		return fmt.Errorf("profile %q: %w", profile.Name, err)
+	}
+	if err := json.Unmarshal(profile.SysInfo, &sysInfo); err != nil {
+		return fmt.Errorf("profile %q: %w", profile.Name, err)
+	}
+	var now = s.now()
+	s.profile, s.sysInfo = profile, info
+	s.modules = map[string]bool{}
+	for _, module := range profile.Modules {
+		s.modules[module] = true
+	}
+	s.ledOff, s.location, s.brightness = sysInfo.LEDOff == 1, sysInfo.Location(), sysInfo.Brightness
+	s.dimmerSettings = newDimmerSettings()
+	s.device = newSimOutlet(sysInfo.DeviceID, sysInfo.Alias, sysInfo.RelayState, now)
+	s.children = nil
+	for i, child := range sysInfo.Children {
+		var o = newSimOutlet(child.ID, child.Alias, child.State, now)
+		if i < len(profile.Loads) {
+			o.load = ConstantLoad(profile.Loads[i])
+		}
+		s.children = append(s.children, o)
+	}
+	if len(s.children) == 0 && len(profile.Loads) > 0 {
+		s.device.load = ConstantLoad(profile.Loads[0])
+	}
+	if sysInfo.LightState != nil {
+		var state = *sysInfo.LightState
+		if state.OnOff == 0 && state.DftOnState != nil {
+			state = *state.DftOnState
+			state.OnOff = 0
+		}
+		state.DftOnState = nil
+		s.light = &state
+	}
+	for _, field := range []string{"alias", "led_off", "latitude_i", "longitude_i", "latitude", "longitude",
+		"relay_state", "on_time", "children", "child_num", "brightness", "light_state", "err_code"} {
+		delete(s.sysInfo, field)
+	}
+	return nil
+}
+
+func newSimOutlet(id, alias string, state int, now time.Time) *simOutlet {
+	return &simOutlet{id: id, alias: alias, state: state, onSince: now, gains: simNominalGains,
+		schedule: simRules{enabled: true}, countDown: simRules{enabled: true}, antiTheft: simRules{enabled: true},
+		days: map[simDay]*simUsage{}, lastUpdate: now}
+}
+
+// advance brings every outlet's energy use and on time up to now
+func (s *Simulator) advance(now time.Time) {
+	var loc = s.zone()
+	for _, o := range append([]*simOutlet{s.device}, s.children...) {
+		for t := o.lastUpdate; t.Before(now); {
+			var next = t.Add(simUsageStep)
+			if next.After(now) {
+				next = now
+			}
+			var (
+				watts    = s.power(o, t)
+				y, m, d  = t.Add(s.clockOffset).In(loc).Date()
+				day      = simDay{y, m, d}
+				usage    = o.days[day]
+				interval = next.Sub(t)
+			)
+			if usage == nil {
+				usage = &simUsage{}
+				o.days[day] = usage
+			}
+			if s.isOn(o) {
+				usage.onTime += interval
+			}
+			usage.energyWh += watts * interval.Hours()
+			o.totalWh += watts * interval.Hours()
+			t = next
+		}
+		if now.After(o.lastUpdate) {
+			o.lastUpdate = now
+		}
+	}
+}
+
+// isOn is if the outlet's on, for a bulb if its light is
+func (s *Simulator) isOn(o *simOutlet) bool {
+	if s.light != nil && o == s.device {
+		return s.light.OnOff == 1
+	}
+	return o.state == 1
+}
+
+// power is what the outlet draws at now, in watts. Bulbs and dimmers draw their load scaled by their brightness.
+func (s *Simulator) power(o *simOutlet, now time.Time) float64 {
+	if o.load == nil || !s.isOn(o) {
+		return 0
+	}
+	var watts = o.load.Watts(now, o.onSince)
+	switch {
+	case s.light != nil && o == s.device:
+		watts *= float64(s.light.Brightness) / MaxBrightness
+	case s.modules[dimmerModule] && o == s.device:
+		watts *= float64(s.brightness) / MaxBrightness
+	}
+	return watts
+}
+
+// deviceNow is the time on the device's clock
+func (s *Simulator) deviceNow() time.Time {
+	return s.now().Add(s.clockOffset).In(s.zone())
+}
+
+// zone is the device's timezone, what it counts days in
+func (s *Simulator) zone() *time.Location {
+	if loc, err := TimezoneLocation(s.timezone); err == nil {
+		return loc
+	}
+	return time.UTC
+}
+
+// answer works out what the Simulator says to a command
+func (s *Simulator) answer(clearBits []byte) string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var modules map[string]json.RawMessage
+	if err := json.Unmarshal(clearBits, &modules); err != nil {
+		var b, _ = json.Marshal(s.profile.UnsupportedModule)
+		return string(b)
+	}
+	s.advance(s.now())
+	var targets, badChild = s.targets(modules["context"])
+	delete(modules, "context")
+	var response = map[string]interface{}{}
+	for module, raw := range modules {
+		var methods map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &methods); err != nil || !s.modules[module] {
+			response[module] = s.profile.UnsupportedModule
+			continue
+		}
+		var answers = map[string]interface{}{}
+		for method, args := range methods {
+			if badChild != "" {
+				answers[method] = SimulatorError{Code: simErrNoChild, Message: fmt.Sprintf("entry %s not exist",
+					badChild)}
+				continue
+			}
+			answers[method] = s.method(module, method, args, targets)
+		}
+		response[module] = answers
+	}
+	var b, _ = json.Marshal(response)
+	return string(b)
+}
+
+// targets works out which outlets a child context is for, nil for none. badChild is a child ID that isn't one of
+// the device's.
+func (s *Simulator) targets(context json.RawMessage) (targets []*simOutlet, badChild string) {
+	if context == nil {
+		return nil, ""
+	}
+	var ctx struct {
+		ChildIDs []string `json:"child_ids"`
+	}
+	if err := json.Unmarshal(context, &ctx); err != nil {
+		return nil, "?"
+	}
+	for _, id := range ctx.ChildIDs {
+		var found *simOutlet
+		for _, child := range s.children {
+			// the Kasa app sends the full ID, some clients just the two digit index
+			if child.id == id || (len(id) == 2 && strings.HasSuffix(child.id, id)) {
+				found = child
+			}
+		}
+		if found == nil {
+			return nil, id
+		}
+		targets = append(targets, found)
+	}
+	return targets, ""
+}
+
+// method answers a single method in a module the profile has. Bulbs keep the same things as plugs under longer
+// module names.
+func (s *Simulator) method(module, method string, args json.RawMessage, targets []*simOutlet) interface{} {
+	switch module {
+	case "system":
+		return s.system(method, args, targets)
+	case "schedule", "smartlife.iot.common.schedule":
+		return s.schedule(method, args, targets)
+	case "count_down":
+		return s.rules(&s.target(targets).countDown, method, args)
+	case "anti_theft":
+		return s.rules(&s.target(targets).antiTheft, method, args)
+	case "netif":
+		return s.netif(method, args)
+	case "emeter":
+		return s.emeter(method, args, targets)
+	case bulbEnergyMeterModule:
+		return s.bulbEMeter(method)
+	case "time", "smartlife.iot.common.timesetting":
+		return s.time(method, args)
+	case "cnCloud", "smartlife.iot.common.cloud":
+		return s.cnCloud(method, args)
+	case dimmerModule:
+		return s.dimmer(method, args)
+	case lightingServiceModule:
+		return s.lightingService(method, args)
+	}
+	return s.profile.UnsupportedMethod
+}
+
+var simOK = map[string]interface{}{"err_code": 0}
+
+func (s *Simulator) system(method string, args json.RawMessage, targets []*simOutlet) interface{} {
+	switch method {
+	case "get_sysinfo":
+		return s.getSysInfo()
+	case "set_relay_state":
+		if s.light != nil {
+			break
+		}
+		var a struct {
+			State *int `json:"state"`
+		}
+		if json.Unmarshal(args, &a) != nil || a.State == nil || (*a.State != 0 && *a.State != 1) {
+			return mockInvalidArgument
+		}
+		if targets == nil {
+			// without a context, a strip switches every outlet
+			targets = append([]*simOutlet{s.device}, s.children...)
+		}
+		for _, o := range targets {
+			o.setState(*a.State, s.now())
+		}
+		return simOK
+	case "set_led_off":
+		var a struct {
+			Off *int `json:"off"`
+		}
+		if json.Unmarshal(args, &a) != nil || a.Off == nil {
+			return mockInvalidArgument
+		}
+		s.ledOff = *a.Off == 1
+		return simOK
+	case "set_dev_alias":
+		var a struct {
+			Alias *string `json:"alias"`
+		}
+		if json.Unmarshal(args, &a) != nil || a.Alias == nil || len(*a.Alias) > 31 {
+			return mockInvalidArgument
+		}
+		if targets == nil {
+			s.device.alias = *a.Alias
+		}
+		for _, o := range targets {
+			o.alias = *a.Alias
+		}
+		return simOK
+	case "set_dev_location":
+		var a struct {
+			Longitude *float64 `json:"longitude"`
+			Latitude  *float64 `json:"latitude"`
+		}
+		if json.Unmarshal(args, &a) != nil || a.Longitude == nil || a.Latitude == nil {
+			return mockInvalidArgument
+		}
+		var loc = Location{Lat: *a.Latitude, Lon: *a.Longitude}
+		if loc.Validate() != nil {
+			return mockInvalidArgument
+		}
+		s.location = loc
+		return simOK
+	case "reboot":
+		return simOK
+	}
+	return s.profile.UnsupportedMethod
+}
+
+// setState switches the outlet's relay
+func (o *simOutlet) setState(state int, now time.Time) {
+	if o.state == 0 && state == 1 {
+		o.onSince = now
+	}
+	o.state = state
+}
+
+// getSysInfo puts the system info together from what the Simulator's been told, in the profile's schema
+func (s *Simulator) getSysInfo() map[string]interface{} {
+	var info = map[string]interface{}{}
+	for field, value := range s.sysInfo {
+		info[field] = value
+	}
+	info["alias"] = s.device.alias
+	if s.profile.Schema == SchemaV1 {
+		info["latitude"], info["longitude"] = s.location.Lat, s.location.Lon
+	} else {
+		info["latitude_i"] = int(math.Round(s.location.Lat * locationScale))
+		info["longitude_i"] = int(math.Round(s.location.Lon * locationScale))
+	}
+	switch {
+	case s.light != nil:
+		info["light_state"] = s.lightState()
+	case len(s.children) == 0:
+		info["led_off"] = boolToInt(s.ledOff)
+		info["relay_state"] = s.device.state
+		info["on_time"] = s.device.onTime(s.now())
+	default:
+		info["led_off"] = boolToInt(s.ledOff)
+		var children = make([]map[string]interface{}, 0, len(s.children))
+		for _, child := range s.children {
+			children = append(children, map[string]interface{}{"id": child.id, "alias": child.alias,
+				"state": child.state, "on_time": child.onTime(s.now()), "next_action": map[string]int{"type": -1}})
+		}
+		info["children"] = children
+		info["child_num"] = len(s.children)
+	}
+	if s.modules[dimmerModule] {
+		info["brightness"] = s.brightness
+	}
+	info["err_code"] = 0
+	return info
+}
+
+// onTime is how many seconds the relay's been on, 0 if it's off
+func (o *simOutlet) onTime(now time.Time) int {
+	if o.state == 0 {
+		return 0
+	}
+	return int(now.Sub(o.onSince) / time.Second)
+}
+
+// schedule keeps rules per outlet, or on the device itself without a context, and the runtime stats
+func (s *Simulator) schedule(method string, args json.RawMessage, targets []*simOutlet) interface{} {
+	var o = s.target(targets)
+	switch method {
+	case "get_next_action":
+		return map[string]interface{}{"type": -1, "err_code": 0}
+	case "get_daystat", "get_monthstat":
+		return s.stats(o, method, args, func(u *simUsage) bool { return u.onTime > 0 },
+			func(u *simUsage) (string, interface{}) {
+				return "time", int(u.onTime / time.Minute)
+			})
+	case "erase_runtime_stat":
+		for _, usage := range o.days {
+			usage.onTime = 0
+		}
+		return simOK
+	}
+	return s.rules(&o.schedule, method, args)
+}
+
+// target is the outlet a rule module command is for, the device itself without a context
+func (s *Simulator) target(targets []*simOutlet) *simOutlet {
+	if len(targets) > 0 {
+		return targets[0]
+	}
+	return s.device
+}
+
+// rules answers the methods every rule module has. The Simulator only keeps rules, it never acts on them.
+func (s *Simulator) rules(rules *simRules, method string, args json.RawMessage) interface{} {
+	switch method {
+	case "get_rules":
+		var list = make([]map[string]interface{}, len(rules.list))
+		copy(list, rules.list)
+		return map[string]interface{}{"rule_list": list, "enable": boolToInt(rules.enabled), "version": 2,
+			"err_code": 0}
+	case "add_rule", "edit_rule":
+		var rule map[string]interface{}
+		if json.Unmarshal(args, &rule) != nil || rule == nil {
+			return mockInvalidArgument
+		}
+		if method == "add_rule" {
+			var id = make([]byte, 16)
+			if _, err := rand.Read(id); err != nil {
+				return mockInvalidArgument
+			}
+			rule["id"] = strings.ToUpper(hex.EncodeToString(id))
+			rules.list = append(rules.list, rule)
+			return map[string]interface{}{"id": rule["id"], "err_code": 0}
+		}
+		for i, existing := range rules.list {
+			if existing["id"] == rule["id"] {
+				rules.list[i] = rule
+				return simOK
+			}
+		}
+		return mockInvalidArgument
+	case "delete_rule":
+		var a struct {
+			ID string `json:"id"`
+		}
+		if json.Unmarshal(args, &a) != nil {
+			return mockInvalidArgument
+		}
+		for i, existing := range rules.list {
+			if existing["id"] == a.ID {
+				rules.list = append(rules.list[:i], rules.list[i+1:]...)
+				return simOK
+			}
+		}
+		return mockInvalidArgument
+	case "delete_all_rules":
+		rules.list = nil
+		return simOK
+	case "set_overall_enable":
+		var a struct {
+			Enable *int `json:"enable"`
+		}
+		// anti_theft takes it as a bare number alongside add_rule and edit_rule
+		if json.Unmarshal(args, &a) != nil || a.Enable == nil {
+			if json.Unmarshal(args, &a.Enable) != nil || a.Enable == nil {
+				return mockInvalidArgument
+			}
+		}
+		rules.enabled = *a.Enable == 1
+		return simOK
+	}
+	return s.profile.UnsupportedMethod
+}
+
+// emeter answers for one outlet. A strip's meters are per outlet, so without a context it doesn't have one to read.
+func (s *Simulator) emeter(method string, args json.RawMessage, targets []*simOutlet) interface{} {
+	var o = s.device
+	switch {
+	case len(targets) > 0:
+		o = targets[0]
+	case len(s.children) > 0:
+		return s.profile.UnsupportedMethod
+	}
+	switch method {
+	case "get_realtime":
+		var voltage, current = o.reading(s.power(o, s.now()))
+		if s.profile.Schema == SchemaV1 {
+			return map[string]interface{}{"voltage": float64(voltage) / 1000, "current": float64(current) / 1000,
+				"power": float64(voltage) * float64(current) / 1e6, "total": o.totalWh / 1000, "err_code": 0}
+		}
+		return map[string]interface{}{"voltage_mv": voltage, "current_ma": current,
+			"power_mw": voltage * current / 1000, "total_wh": int(math.Round(o.totalWh)), "err_code": 0}
+	case "get_vgain_igain":
+		return map[string]interface{}{"vgain": o.gains.VGain, "igain": o.gains.IGain, "err_code": 0}
+	case "set_vgain_igain":
+		var gains EMeterGains
+		if json.Unmarshal(args, &gains) != nil || gains.VGain <= 0 || gains.IGain <= 0 {
+			return mockInvalidArgument
+		}
+		o.gains = gains
+		return simOK
+	case "erase_emeter_stat":
+		o.totalWh = 0
+		for _, usage := range o.days {
+			usage.energyWh = 0
+		}
+		return simOK
+	case "get_daystat", "get_monthstat":
+		return s.stats(o, method, args, func(u *simUsage) bool { return u.energyWh > 0 },
+			func(u *simUsage) (string, interface{}) {
+				if s.profile.Schema == SchemaV1 {
+					return "energy", u.energyWh / 1000
+				}
+				return "energy_wh", int(math.Round(u.energyWh))
+			})
+	}
+	return s.profile.UnsupportedMethod
+}
+
+// reading is what the outlet's meter reads with watts plugged in, in millivolts and milliamps, through its gains
+func (o *simOutlet) reading(watts float64) (voltage, current int) {
+	voltage = int(math.Round(float64(simVoltage) * float64(o.gains.VGain) / float64(simNominalGains.VGain)))
+	current = int(math.Round(watts / simVoltage * 1e6 * float64(o.gains.IGain) / float64(simNominalGains.IGain)))
+	return voltage, current
+}
+
+// stats answers get_daystat (for a month) or get_monthstat (for a year) out of the outlet's usage, with value
+// picking the field and value for a day or month. Days counted says have nothing to say for these stats aren't
+// listed, like a real device, so erasing one set of stats doesn't leave its days behind.
+func (s *Simulator) stats(o *simOutlet, method string, args json.RawMessage, counted func(*simUsage) bool,
+	value func(*simUsage) (string, interface{})) interface{} {
+	var a struct {
+		Year  int        `json:"year"`
+		Month time.Month `json:"month"`
+	}
+	if json.Unmarshal(args, &a) != nil || a.Year == 0 || (method == "get_daystat" && a.Month == 0) {
+		return mockInvalidArgument
+	}
+	var (
+		list   = []map[string]interface{}{}
+		months = map[time.Month]*simUsage{}
+	)
+	for day, usage := range o.days {
+		if day.year != a.Year || !counted(usage) {
+			continue
+		}
+		if method == "get_monthstat" {
+			if months[day.month] == nil {
+				months[day.month] = &simUsage{}
+			}
+			months[day.month].energyWh += usage.energyWh
+			months[day.month].onTime += usage.onTime
+			continue
+		}
+		if day.month == a.Month {
+			var field, v = value(usage)
+			list = append(list, map[string]interface{}{"year": day.year, "month": int(day.month), "day": day.day,
+				field: v})
+		}
+	}
+	for month, usage := range months {
+		var field, v = value(usage)
+		list = append(list, map[string]interface{}{"year": a.Year, "month": int(month), field: v})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		var a, b = list[i], list[j]
+		return a["month"].(int) < b["month"].(int) || (a["month"] == b["month"] && a["day"].(int) < b["day"].(int))
+	})
+	if method == "get_monthstat" {
+		return map[string]interface{}{"month_list": list, "err_code": 0}
+	}
+	return map[string]interface{}{"day_list": list, "err_code": 0}
+}
+
+// bulbEMeter is a bulb's meter, which only knows power. The load is what the bulb draws at full brightness.
+func (s *Simulator) bulbEMeter(method string) interface{} {
+	if method != "get_realtime" {
+		return s.profile.UnsupportedMethod
+	}
+	return map[string]interface{}{"power_mw": int(math.Round(s.power(s.device, s.now()) * 1000)),
+		"total_wh": int(math.Round(s.device.totalWh)), "err_code": 0}
+}
+
+// time keeps the device's timezone and clock. set_timezone is the only way to set the clock, and it sets the zone at
+// the same time; the clock fields are in the new zone.
+func (s *Simulator) time(method string, args json.RawMessage) interface{} {
+	switch method {
+	case "get_time":
+		var now = s.deviceNow()
+		return map[string]interface{}{"year": now.Year(), "month": int(now.Month()), "mday": now.Day(),
+			"hour": now.Hour(), "min": now.Minute(), "sec": now.Second(), "err_code": 0}
+	case "get_timezone":
+		return map[string]interface{}{"index": s.timezone, "err_code": 0}
+	case "set_timezone":
+		var a struct {
+			Index *int `json:"index"`
+			Year  *int `json:"year"`
+			Month *int `json:"month"`
+			MDay  *int `json:"mday"`
+			Hour  *int `json:"hour"`
+			Min   *int `json:"min"`
+			Sec   *int `json:"sec"`
+		}
+		if json.Unmarshal(args, &a) != nil || a.Index == nil {
+			return mockInvalidArgument
+		}
+		var loc, err = TimezoneLocation(*a.Index)
+		if err != nil {
+			return mockInvalidArgument
+		}
+		var clock = []*int{a.Year, a.Month, a.MDay, a.Hour, a.Min, a.Sec}
+		var set int
+		for _, field := range clock {
+			if field != nil {
+				set++
+			}
+		}
+		switch set {
+		case 0:
+		case len(clock):
+			var t = time.Date(*a.Year, time.Month(*a.Month), *a.MDay, *a.Hour, *a.Min, *a.Sec, 0, loc)
+			if t.Month() != time.Month(*a.Month) || t.Day() != *a.MDay || t.Hour() != *a.Hour ||
+				t.Minute() != *a.Min || t.Second() != *a.Sec {
+				// time.Date normalizes, so the 31st of June comes back as the 1st of July
+				return mockInvalidArgument
+			}
+			s.clockOffset = t.Sub(s.now())
+		default:
+			return mockInvalidArgument
+		}
+		s.timezone = *a.Index
+		return simOK
+	}
+	return s.profile.UnsupportedMethod
+}
+
+// netif scans for the Simulator's access points and joins one. Once it's told to join a network the device leaves
+// the one it was on, so it stops taking TCP connections at its address; it still answers UDP, like discovery on
+// the network it joined.
+func (s *Simulator) netif(method string, args json.RawMessage) interface{} {
+	switch method {
+	case "get_scaninfo":
+		return map[string]interface{}{"ap_list": s.accessPoints, "err_code": 0}
+	case "set_stainfo":
+		var a struct {
+			SSID     string   `json:"ssid"`
+			Password string   `json:"password"`
+			KeyType  *KeyType `json:"key_type"`
+		}
+		if json.Unmarshal(args, &a) != nil || a.SSID == "" || a.KeyType == nil || *a.KeyType < KeyTypeNone ||
+			*a.KeyType > KeyTypeWPA2 || (*a.KeyType != KeyTypeNone && a.Password == "") {
+			return mockInvalidArgument
+		}
+		s.wifi = AccessPoint{SSID: a.SSID, KeyType: *a.KeyType}
+		_ = s.mockServer.leave()
+		return simOK
+	}
+	return s.profile.UnsupportedMethod
+}
+
+// cnCloud keeps the cloud server and binding. Any password binds, and the firmware list is always empty.
+func (s *Simulator) cnCloud(method string, args json.RawMessage) interface{} {
+	switch method {
+	case "get_info":
+		return map[string]interface{}{"username": s.cloud.username, "server": s.cloud.server,
+			"binded": boolToInt(s.cloud.binded), "cld_connection": 0, "illegalType": 0, "stopConnect": 0,
+			"tcspStatus": 0, "fwDlPage": "", "tcspInfo": "", "fwNotifyType": 0, "err_code": 0}
+	case "get_intl_fw_list":
+		return map[string]interface{}{"fw_list": []interface{}{}, "err_code": 0}
+	case "set_server_url":
+		var a struct {
+			Server string `json:"server"`
+		}
+		if json.Unmarshal(args, &a) != nil || a.Server == "" {
+			return mockInvalidArgument
+		}
+		s.cloud.server = a.Server
+		return simOK
+	case "bind":
+		var a struct {
+			Username string `json:"username"`
+		}
+		if json.Unmarshal(args, &a) != nil || a.Username == "" {
+			return mockInvalidArgument
+		}
+		s.cloud.username, s.cloud.binded = a.Username, true
+		return simOK
+	case "unbind":
+		s.cloud.username, s.cloud.binded = "", false
+		return simOK
+	}
+	return s.profile.UnsupportedMethod
+}
+
+// dimmer handles the dimmer module: brightness, transitions to it, and the fade times and default behaviors
+func (s *Simulator) dimmer(method string, args json.RawMessage) interface{} {
+	var a struct {
+		Brightness *int `json:"brightness"`
+	}
+	switch method {
+	case "set_brightness", "set_dimmer_transition":
+		if json.Unmarshal(args, &a) != nil || a.Brightness == nil || *a.Brightness < 0 ||
+			*a.Brightness > MaxBrightness || (method == "set_brightness" && *a.Brightness == 0) {
+			return mockInvalidArgument
+		}
+		if method == "set_dimmer_transition" {
+			// a transition turns the dimmer on, or off if it's to 0
+			s.device.setState(boolToInt(*a.Brightness > 0), s.now())
+			if *a.Brightness == 0 {
+				return simOK
+			}
+		}
+		s.brightness = *a.Brightness
+		return simOK
+	}
+	if answer, ok := s.dimmerSettings.answer(method, args); ok {
+		return answer
+	}
+	return s.profile.UnsupportedMethod
+}
+
+// lightingService handles a bulb's light state
+func (s *Simulator) lightingService(method string, args json.RawMessage) interface{} {
+	if s.light == nil {
+		return s.profile.UnsupportedMethod
+	}
+	switch method {
+	case "get_light_state":
+		return s.lightState()
+	case "transition_light_state":
+		var change struct {
+			OnOff      *int    `json:"on_off"`
+			Mode       *string `json:"mode"`
+			Hue        *int    `json:"hue"`
+			Saturation *int    `json:"saturation"`
+			ColorTemp  *int    `json:"color_temp"`
+			Brightness *int    `json:"brightness"`
+		}
+		if err := json.Unmarshal(args, &change); err != nil {
+			return mockInvalidArgument
+		}
+		for field, value := range map[*int]*int{&s.light.OnOff: change.OnOff, &s.light.Hue: change.Hue,
+			&s.light.Saturation: change.Saturation, &s.light.ColorTemp: change.ColorTemp,
+			&s.light.Brightness: change.Brightness} {
+			if value != nil {
+				*field = *value
+			}
+		}
+		if change.Mode != nil {
+			s.light.Mode = *change.Mode
+		}
+		return s.lightState()
+	}
+	return s.profile.UnsupportedMethod
+}
+
+// lightState is the light state the way a bulb reports it, with everything but on_off tucked into dft_on_state
+// while it's off
+func (s *Simulator) lightState() lightState {
+	var state = *s.light
+	if state.OnOff == 0 {
+		return lightState{OnOff: 0, DftOnState: &state}
+	}
+	return state
+}
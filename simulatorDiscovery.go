@@ -0,0 +1,98 @@
+package kasalink
+
+import (
+	"encoding/json"
+	"net"
+	"sync"
+)
+
+// DiscoveryResponder answers discovery for a set of Simulators. Each Simulator answers get_sysinfo over UDP on its
+// own port already, but a discovery broadcast only goes to one port; the DiscoveryResponder listens on that port and
+// has every Simulator added to it answer, each from its own address, so Discover finds them all where they are.
+// Run one per port on loopback and any number of them fit in one test.
+type DiscoveryResponder struct {
+	conn    net.PacketConn
+	lock    sync.Mutex
+	devices []*Simulator
+}
+
+// NewDiscoveryResponder starts answering discovery on address, a free port on localhost if it's empty. Listen on
+// 0.0.0.0 to hear broadcasts, and on port 9999 to look like the real thing.
+func NewDiscoveryResponder(address string, devices ...*Simulator) (*DiscoveryResponder, error) {
+	if address == "" {
+		address = "127.0.0.1:0"
+	}
+	var conn, err = net.ListenPacket("udp4", address)
+	if err != nil {
+		return nil, err
+	}
+	var dr = &DiscoveryResponder{conn: conn, devices: devices}
+	go dr.serve()
+	return dr, nil
+}
+
+// Addr is where the DiscoveryResponder listens, hand it to Discover
+func (dr *DiscoveryResponder) Addr() string {
+	return dr.conn.LocalAddr().String()
+}
+
+// Add has s answer discovery too
+func (dr *DiscoveryResponder) Add(s *Simulator) {
+	dr.lock.Lock()
+	defer dr.lock.Unlock()
+	dr.devices = append(dr.devices, s)
+}
+
+// Remove stops s answering discovery, like it was unplugged
+func (dr *DiscoveryResponder) Remove(s *Simulator) {
+	dr.lock.Lock()
+	defer dr.lock.Unlock()
+	for i, device := range dr.devices {
+		if device == s {
+			dr.devices = append(dr.devices[:i], dr.devices[i+1:]...)
+			return
+		}
+	}
+}
+
+// Close stops answering discovery, the Simulators carry on
+func (dr *DiscoveryResponder) Close() error {
+	return dr.conn.Close()
+}
+
+func (dr *DiscoveryResponder) serve() {
+	var buf = make([]byte, 64*1024)
+	for {
+		var n, from, err = dr.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		// a copy, the answers go out after buf's been read into again
+		var clearBits = decrypt(append([]byte(nil), buf[:n]...))
+		if !isDiscovery(clearBits) {
+			continue
+		}
+		dr.lock.Lock()
+		var devices = append([]*Simulator(nil), dr.devices...)
+		dr.lock.Unlock()
+		// each device answers in its own time, one with Faults.Latency mustn't hold up the rest
+		for _, s := range devices {
+			go func(s *Simulator) {
+				// a Simulator that's been closed can't answer, same as a device that's been unplugged
+				_ = s.answerDatagram(clearBits, from)
+			}(s)
+		}
+	}
+}
+
+// isDiscovery is true for a command that asks for system info, which is all discovery is
+func isDiscovery(clearBits []byte) bool {
+	var command struct {
+		System map[string]json.RawMessage `json:"system"`
+	}
+	if json.Unmarshal(clearBits, &command) != nil {
+		return false
+	}
+	var _, ok = command.System["get_sysinfo"]
+	return ok
+}
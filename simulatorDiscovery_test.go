@@ -0,0 +1,110 @@
+package kasalink
+
+import (
+	"context"
+	"net"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestDiscoveryResponder(t *testing.T) {
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var (
+		sims = map[string]*Simulator{}
+		dr   = map[string]*DiscoveryResponder{}
+	)
+	for _, name := range []string{"HS100", "HS110v2", "KP303"} {
+		var profile, err = LoadSimulatorProfile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sims[name], err = NewSimulator(SimulatorConfig{Profile: profile}); err != nil {
+			t.Fatal(err)
+		}
+		defer sims[name].Close()
+	}
+	// two houses, side by side in the one test
+	var err error
+	if dr["upstairs"], err = NewDiscoveryResponder("", sims["HS100"], sims["HS110v2"]); err != nil {
+		t.Fatal(err)
+	}
+	defer dr["upstairs"].Close()
+	if dr["downstairs"], err = NewDiscoveryResponder("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	defer dr["downstairs"].Close()
+	dr["downstairs"].Add(sims["KP303"])
+
+	var found []DiscoveredDevice
+	if found, err = Discover(ctx, dr["upstairs"].Addr(), 300*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	var addrs []string
+	for _, device := range found {
+		addrs = append(addrs, device.Address)
+		if device.Address == sims["HS100"].Addr() && device.SysInfo.Model != "HS100(US)" {
+			t.Errorf("HS100 says it's a %s", device.SysInfo.Model)
+		}
+	}
+	sort.Strings(addrs)
+	var want = []string{sims["HS100"].Addr(), sims["HS110v2"].Addr()}
+	sort.Strings(want)
+	if len(addrs) != 2 || addrs[0] != want[0] || addrs[1] != want[1] {
+		t.Errorf("upstairs found %v, not %v", addrs, want)
+	}
+	if found, err = Discover(ctx, dr["downstairs"].Addr(), 300*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].Address != sims["KP303"].Addr() || len(found[0].SysInfo.Children) != 3 {
+		t.Errorf("downstairs found %+v", found)
+	}
+
+	// what's found can be talked to where it was found
+	var kpp *KasaPowerPlug
+	if kpp, err = NewKasaPowerPlug(found[0].Address); err != nil {
+		t.Fatal(err)
+	}
+	_ = kpp.Close()
+
+	// a slow device doesn't hold up the others
+	sims["HS100"].SetFaults(Faults{Latency: time.Second})
+	if found, err = Discover(ctx, dr["upstairs"].Addr(), 300*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].Address != sims["HS110v2"].Addr() {
+		t.Errorf("found %+v with the HS100 slow to answer", found)
+	}
+
+	dr["upstairs"].Remove(sims["HS100"])
+	sims["HS110v2"].SetFaults(Faults{Garbage: true})
+	if found, err = Discover(ctx, dr["upstairs"].Addr(), 300*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 0 {
+		t.Errorf("found %+v with one device gone and the other garbled", found)
+	}
+}
+
+func TestDiscoveryResponderBroadcast(t *testing.T) {
+	var s, err = NewSimulator(SimulatorConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	var dr *DiscoveryResponder
+	if dr, err = NewDiscoveryResponder("0.0.0.0:0", s); err != nil {
+		t.Fatal(err)
+	}
+	defer dr.Close()
+	var _, port, _ = net.SplitHostPort(dr.Addr())
+	var found []DiscoveredDevice
+	found, err = Discover(context.Background(), "255.255.255.255:"+port, 500*time.Millisecond)
+	if err != nil || len(found) == 0 {
+		t.Skipf("no broadcasts on this network (%v)", err)
+	}
+	if len(found) != 1 || found[0].Address != s.Addr() {
+		t.Errorf("broadcast found %+v", found)
+	}
+}
@@ -0,0 +1,107 @@
+package kasalink
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"time"
+)
+
+// Faults is how a Simulator misbehaves answering a request, the zero Faults is a device behaving itself. The framing
+// faults (DropMidFrame, TruncatedHeader and OversizedHeader) all end with the Simulator hanging up, and only one of
+// them happens to an answer, in that order.
+type Faults struct {
+	// Latency is how long to sit on a request before answering
+	Latency time.Duration
+	// Errors are err_code answers to give in place of the real ones, by "module.method", like "emeter.get_realtime"
+	Errors map[string]SimulatorError
+	// Garbage sends random bytes in place of the encrypted answer, under the right length header
+	Garbage bool
+	// DropMidFrame sends the length header and half the answer
+	DropMidFrame bool
+	// TruncatedHeader sends the first two bytes of the length header and nothing else
+	TruncatedHeader bool
+	// OversizedHeader has the length header claim faultOversize more than the answer it sends
+	OversizedHeader bool
+}
+
+// faultOversize is how much longer than the answer an OversizedHeader says it is
+const faultOversize = 1 << 20
+
+// SetFaults has every connection misbehave the same way, from its next request on. SetFaults(Faults{}) puts the
+// Simulator right again.
+func (s *Simulator) SetFaults(f Faults) {
+	s.ScriptFaults(func(conn, request int) Faults {
+		return f
+	})
+}
+
+// ScriptFaults has script pick the Faults for every answer, given the connection (numbered from 1 as they're
+// accepted, UDP is 0) and the request on that connection (numbered from 1). script is called from the connection's
+// goroutine, so it has to be safe to call concurrently. Pass nil to stop misbehaving.
+func (s *Simulator) ScriptFaults(script func(conn, request int) Faults) {
+	s.mockServer.setFaults(script)
+}
+
+// RefuseConnections hangs up on every new TCP connection for d, connections already made carry on
+func (s *Simulator) RefuseConnections(d time.Duration) {
+	s.mockServer.refuse(time.Now().Add(d))
+}
+
+// apply puts f's Errors into answer
+func (f Faults) apply(answer string) string {
+	if len(f.Errors) == 0 {
+		return answer
+	}
+	var modules map[string]map[string]json.RawMessage
+	if json.Unmarshal([]byte(answer), &modules) != nil {
+		return answer
+	}
+	for module, methods := range modules {
+		for method := range methods {
+			if e, ok := f.Errors[module+"."+method]; ok {
+				methods[method], _ = json.Marshal(e)
+			}
+		}
+	}
+	var b, _ = json.Marshal(modules)
+	return string(b)
+}
+
+// send writes answer to conn, as badly as f says. It's false once it's time to hang up.
+func (f Faults) send(conn net.Conn, answer string) bool {
+	time.Sleep(f.Latency)
+	var frame = encrypt(answer)
+	if f.Garbage {
+		_, _ = rand.Read(frame[4:])
+	}
+	switch {
+	case f.DropMidFrame:
+		_, _ = conn.Write(frame[:4+(len(frame)-4)/2])
+		return false
+	case f.TruncatedHeader:
+		_, _ = conn.Write(frame[:2])
+		return false
+	case f.OversizedHeader:
+		binary.BigEndian.PutUint32(frame, uint32(len(frame)-4+faultOversize))
+		_, _ = conn.Write(frame)
+		return false
+	}
+	var _, err = conn.Write(frame)
+	return err == nil
+}
+
+// datagram is answer as a UDP datagram, as badly as f says. There's no length header or connection to drop over
+// UDP, so DropMidFrame sends half the datagram and the header faults don't do anything.
+func (f Faults) datagram(answer string) []byte {
+	time.Sleep(f.Latency)
+	var datagram = encryptDatagram(answer)
+	if f.Garbage {
+		_, _ = rand.Read(datagram)
+	}
+	if f.DropMidFrame {
+		datagram = datagram[:len(datagram)/2]
+	}
+	return datagram
+}
@@ -0,0 +1,98 @@
+package kasalink
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSimulatorFaults(t *testing.T) {
+	var profile, err = LoadSimulatorProfile("HS110v2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s *Simulator
+	if s, err = NewSimulator(SimulatorConfig{Profile: profile}); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var device Device
+	if device, err = NewDevice(ctx, s.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	defer device.Close()
+	var kpp = device.(*KasaPowerPlug)
+
+	s.SetFaults(Faults{Latency: 200 * time.Millisecond})
+	var started = time.Now()
+	if _, err = kpp.EMeterReading(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if took := time.Since(started); took < 200*time.Millisecond {
+		t.Errorf("answered in %s with 200ms latency", took)
+	}
+
+	s.SetFaults(Faults{Errors: map[string]SimulatorError{"emeter.get_realtime": {Code: -99, Message: "busy"}}})
+	_, err = kpp.EMeterReading(ctx)
+	var responseErr *ResponseError
+	if !errors.As(err, &responseErr) || responseErr.Code != -99 {
+		t.Errorf("got %v, not the err_code -99", err)
+	}
+
+	for name, faults := range map[string]Faults{
+		"garbage":          {Garbage: true},
+		"dropped":          {DropMidFrame: true},
+		"truncated header": {TruncatedHeader: true},
+		"oversized header": {OversizedHeader: true},
+	} {
+		s.SetFaults(faults)
+		if _, err = kpp.EMeterReading(ctx); err == nil {
+			t.Errorf("%s answer didn't fail", name)
+		}
+		s.SetFaults(Faults{})
+		if _, err = kpp.EMeterReading(ctx); err != nil {
+			t.Errorf("didn't get over a %s answer: %v", name, err)
+		}
+	}
+
+	// the next connection drops its second answer, and only that connection
+	var (
+		first     int
+		firstLock sync.Mutex
+	)
+	s.ScriptFaults(func(conn, request int) Faults {
+		// the script gets called from every connection's goroutine
+		firstLock.Lock()
+		defer firstLock.Unlock()
+		if first == 0 {
+			first = conn
+		}
+		return Faults{DropMidFrame: conn == first && request == 2}
+	})
+	kpp.closer()
+	kpp.tplinkClient = nil
+	for try := 1; try <= 4; try++ {
+		if _, err = kpp.EMeterReading(ctx); (err == nil) != (try != 2) {
+			t.Errorf("try %d got %v", try, err)
+		}
+	}
+	s.ScriptFaults(nil)
+
+	s.RefuseConnections(300 * time.Millisecond)
+	if _, err = kpp.EMeterReading(ctx); err != nil {
+		t.Errorf("refusing new connections dropped an old one: %v", err)
+	}
+	var refused = &KasaPowerPlug{plugNetworkLocation: s.Addr()}
+	defer refused.Close()
+	if _, err = refused.EMeterReading(ctx); err == nil {
+		t.Error("connected while refusing connections")
+	}
+	time.Sleep(300 * time.Millisecond)
+	if _, err = refused.EMeterReading(ctx); err != nil {
+		t.Errorf("still refused: %v", err)
+	}
+}
@@ -0,0 +1,128 @@
+package kasalink
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// Load is something plugged into a simulated outlet. Watts is what it draws at now, given the outlet's relay has been
+// on since onSince; it's only asked while the relay's on.
+type Load interface {
+	Watts(now, onSince time.Time) float64
+}
+
+// ConstantLoad always draws the same, like a light or a powerhead
+type ConstantLoad float64
+
+// Watts is the ConstantLoad
+func (c ConstantLoad) Watts(now, onSince time.Time) float64 {
+	return float64(c)
+}
+
+// HeaterLoad is a thermostat heater: it draws Power for Duty (0 to 1) of every Period and nothing the rest, starting
+// with a heating cycle when the outlet turns on
+type HeaterLoad struct {
+	Power  float64
+	Period time.Duration
+	Duty   float64
+}
+
+// Watts is Power while the heater's heating, 0 while it isn't
+func (h HeaterLoad) Watts(now, onSince time.Time) float64 {
+	if h.Period <= 0 {
+		return h.Power
+	}
+	var phase = now.Sub(onSince) % h.Period
+	if phase < time.Duration(h.Duty*float64(h.Period)) {
+		return h.Power
+	}
+	return 0
+}
+
+// PumpLoad is a motor: it draws Surge for SurgeFor after the outlet turns on, and Power after that
+type PumpLoad struct {
+	Power    float64
+	Surge    float64
+	SurgeFor time.Duration
+}
+
+// Watts is Surge while the pump's starting, Power once it's running
+func (p PumpLoad) Watts(now, onSince time.Time) float64 {
+	if now.Sub(onSince) < p.SurgeFor {
+		return p.Surge
+	}
+	return p.Power
+}
+
+// NoisyLoad wobbles Load by up to Jitter (0.05 is 5%) either way. The wobble only changes once a second and is the
+// same for the same second every time, so runs are repeatable.
+type NoisyLoad struct {
+	Load   Load
+	Jitter float64
+}
+
+// Watts is Load's, give or take Jitter
+func (n NoisyLoad) Watts(now, onSince time.Time) float64 {
+	var (
+		h   = fnv.New64a()
+		buf = make([]byte, 8)
+	)
+	binary.BigEndian.PutUint64(buf, uint64(now.Unix()))
+	_, _ = h.Write(buf)
+	// a number from -1 to 1
+	var wobble = float64(h.Sum64()%2001)/1000 - 1
+	return n.Load.Watts(now, onSince) * (1 + wobble*n.Jitter)
+}
+
+// FailingLoad is Load until At, when it fails and becomes After (nothing at all, if After is nil). A heater that
+// burns out, or a pump that seizes and draws more.
+type FailingLoad struct {
+	Load  Load
+	At    time.Time
+	After Load
+}
+
+// Watts is Load's before the failure, After's from then on
+func (f FailingLoad) Watts(now, onSince time.Time) float64 {
+	if now.Before(f.At) {
+		return f.Load.Watts(now, onSince)
+	}
+	if f.After == nil {
+		return 0
+	}
+	return f.After.Watts(now, onSince)
+}
+
+// ManualClock is a clock for the Simulator that only moves when you move it, hand its Now to SimulatorConfig.Clock
+type ManualClock struct {
+	lock sync.Mutex
+	now  time.Time
+}
+
+// NewManualClock gives you a ManualClock stopped at start
+func NewManualClock(start time.Time) *ManualClock {
+	return &ManualClock{now: start}
+}
+
+// Now is the time the ManualClock's stopped at
+func (c *ManualClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+// Advance moves the ManualClock forward by d
+func (c *ManualClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// Set moves the ManualClock to t
+func (c *ManualClock) Set(t time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.now = t
+}
@@ -0,0 +1,135 @@
+package kasalink
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoads(t *testing.T) {
+	var start = time.Date(2024, time.June, 3, 16, 0, 0, 0, time.UTC)
+	var heater = HeaterLoad{Power: 1000, Period: 10 * time.Minute, Duty: 0.3}
+	if w := heater.Watts(start.Add(2*time.Minute), start); w != 1000 {
+		t.Errorf("heater draws %vW 2 minutes in", w)
+	}
+	if w := heater.Watts(start.Add(5*time.Minute), start); w != 0 {
+		t.Errorf("heater draws %vW 5 minutes in", w)
+	}
+	var noisy = NoisyLoad{Load: ConstantLoad(100), Jitter: 0.05}
+	for i := 0; i < 100; i++ {
+		var now = start.Add(time.Duration(i) * time.Second)
+		var w = noisy.Watts(now, start)
+		if w < 95 || w > 105 || w != noisy.Watts(now, start) {
+			t.Fatalf("noisy 100W load draws %vW at %s", w, now)
+		}
+	}
+	var failing = FailingLoad{Load: ConstantLoad(100), At: start.Add(time.Hour), After: ConstantLoad(300)}
+	if failing.Watts(start, start) != 100 || failing.Watts(start.Add(time.Hour), start) != 300 {
+		t.Error("failing load didn't fail")
+	}
+}
+
+func TestSimulatorLoads(t *testing.T) {
+	var (
+		start = time.Date(2024, time.June, 3, 16, 0, 0, 0, time.UTC)
+		clock = NewManualClock(start)
+	)
+	var s, err = NewSimulator(SimulatorConfig{Clock: clock.Now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	for child, load := range []Load{
+		HeaterLoad{Power: 1000, Period: 10 * time.Minute, Duty: 0.3},
+		PumpLoad{Power: 500, Surge: 1500, SurgeFor: 30 * time.Second},
+		FailingLoad{Load: ConstantLoad(100), At: start.Add(2 * time.Hour)},
+	} {
+		if err = s.SetLoad(child, load); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = s.SetLoad(6, ConstantLoad(1)); err == nil {
+		t.Error("an HS300 has a seventh outlet")
+	}
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var device Device
+	if device, err = NewDevice(ctx, s.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	defer device.Close()
+	var kpp = device.(*KasaPowerPlug)
+	var reading *EMeterReading
+	if reading, err = kpp.EMeterReading(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if reading.Power < 1490 || reading.Power > 1510 {
+		t.Errorf("pump starting up draws %vW", reading.Power)
+	}
+	clock.Advance(time.Minute)
+	if reading, err = kpp.EMeterReading(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if reading.Power < 495 || reading.Power > 505 {
+		t.Errorf("pump running draws %vW", reading.Power)
+	}
+	// a day on, across midnight on the device's clock
+	clock.Advance(24*time.Hour - time.Minute)
+	if reading, err = kpp.EMeterReading(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	if reading.Power != 0 {
+		t.Errorf("failed load draws %vW", reading.Power)
+	}
+	var answer = s.answer([]byte(`{"context":{"child_ids":["02"]},"emeter":{"get_realtime":{}}}`))
+	if !strings.Contains(answer, `"total_wh":200`) {
+		t.Errorf("100W for 2 hours got %s", answer)
+	}
+	var days []EnergyStat
+	if days, err = kpp.DailyEnergy(ctx, 2024, time.June, 0); err != nil {
+		t.Fatal(err)
+	}
+	if len(days) != 2 || days[0].Day != 3 || days[1].Day != 4 || days[0].Energy+days[1].Energy != 7200 {
+		t.Errorf("heater at 30%% of 1kW for a day used %+v", days)
+	}
+	var months []EnergyStat
+	if months, err = kpp.MonthlyEnergy(ctx, 2024, 0); err != nil {
+		t.Fatal(err)
+	}
+	if len(months) != 1 || months[0].Month != time.June || months[0].Energy != 7200 {
+		t.Errorf("heater used %+v by month", months)
+	}
+	var runtime []RuntimeStat
+	if runtime, err = kpp.DailyRuntime(ctx, 2024, time.June, 0); err != nil {
+		t.Fatal(err)
+	}
+	if len(runtime) != 2 || runtime[0].OnTime+runtime[1].OnTime != 24*time.Hour {
+		t.Errorf("heater was on %+v", runtime)
+	}
+	// nothing's used while it's off
+	if _, err = kpp.TurnDeviceOff(0); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Hour)
+	if months, err = kpp.MonthlyEnergy(ctx, 2024, 0); err != nil {
+		t.Fatal(err)
+	}
+	if len(months) != 1 || months[0].Energy != 7200 {
+		t.Errorf("heater used %+v, switched off", months)
+	}
+	answer = s.answer([]byte(`{"context":{"child_ids":["00"]},"emeter":{"erase_emeter_stat":{}}}`))
+	if days, err = kpp.DailyEnergy(ctx, 2024, time.June, 0); err != nil {
+		t.Fatal(err)
+	}
+	if len(days) != 0 {
+		t.Errorf("erased emeter stats are %+v (%s)", days, answer)
+	}
+	// the runtime stats are kept apart, so they're still there
+	if runtime, err = kpp.DailyRuntime(ctx, 2024, time.June, 0); err != nil {
+		t.Fatal(err)
+	}
+	if len(runtime) != 2 {
+		t.Errorf("runtime stats after erasing the emeter's are %+v", runtime)
+	}
+}
@@ -0,0 +1,98 @@
+package kasalink
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+)
+
+// profileFiles are the device profiles the Simulator comes with, one JSON fixture per device
+//
+//go:embed profiles/*.json
+var profileFiles embed.FS
+
+// The firmware schema variants a SimulatorProfile can have
+const (
+	// SchemaV1 is the original firmware's: emeter readings in volts, amps, watts and kWh, location in degrees
+	SchemaV1 = "v1"
+	// SchemaV2 is everything since: emeter readings in milli-units and watt hours, location in ten-thousandths
+	SchemaV2 = "v2"
+)
+
+// SimulatorError is an err_code answer, what a device says to something it doesn't do
+type SimulatorError struct {
+	Code    int    `json:"err_code"`
+	Message string `json:"err_msg"`
+}
+
+// SimulatorProfile is a device for the Simulator to play: its system info, which modules it answers, how it turns
+// down what it doesn't, and which firmware schema it speaks
+type SimulatorProfile struct {
+	Name string `json:"name"`
+	// Schema is SchemaV1 or SchemaV2, it defaults to SchemaV2
+	Schema string `json:"schema"`
+	// Modules are the modules the device answers, everything else gets UnsupportedModule
+	Modules []string `json:"modules"`
+	// UnsupportedModule and UnsupportedMethod are the answers to a module, or a method in a module, it doesn't have
+	UnsupportedModule SimulatorError `json:"unsupported_module"`
+	UnsupportedMethod SimulatorError `json:"unsupported_method"`
+	// Loads are what's plugged in, in watts, one per outlet (or one for the device, if it has no children)
+	Loads []float64 `json:"loads"`
+	// SysInfo is what get_sysinfo answers with before anything's been changed
+	SysInfo json.RawMessage `json:"sysinfo"`
+}
+
+// SimulatorProfiles are the names of the profiles the Simulator comes with
+func SimulatorProfiles() []string {
+	var entries, _ = profileFiles.ReadDir("profiles")
+	var names = make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, strings.TrimSuffix(entry.Name(), ".json"))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LoadSimulatorProfile gives you one of the SimulatorProfiles by name, like "HS110v1"
+func LoadSimulatorProfile(name string) (*SimulatorProfile, error) {
+	for _, known := range SimulatorProfiles() {
+		if strings.EqualFold(known, name) {
+			var f, err = profileFiles.Open(path.Join("profiles", known+".json"))
+			if err != nil {
+				return nil, err
+			}
+			defer f.Close()
+			return ReadSimulatorProfile(f)
+		}
+	}
+	return nil, fmt.Errorf("no simulator profile called %q, there's %s", name,
+		strings.Join(SimulatorProfiles(), ", "))
+}
+
+// ReadSimulatorProfile reads a profile from JSON, for devices the Simulator doesn't come with
+func ReadSimulatorProfile(r io.Reader) (*SimulatorProfile, error) {
+	var p = &SimulatorProfile{}
+	if err := json.NewDecoder(r).Decode(p); err != nil {
+		return nil, err
+	}
+	if p.Schema == "" {
+		p.Schema = SchemaV2
+	}
+	if p.Schema != SchemaV1 && p.Schema != SchemaV2 {
+		return nil, fmt.Errorf("profile %q has schema %q, not %s or %s", p.Name, p.Schema, SchemaV1, SchemaV2)
+	}
+	if p.UnsupportedModule.Code == 0 {
+		p.UnsupportedModule = SimulatorError{Code: -1, Message: "module not support"}
+	}
+	if p.UnsupportedMethod.Code == 0 {
+		p.UnsupportedMethod = SimulatorError{Code: -2, Message: "member not support"}
+	}
+	if len(p.SysInfo) == 0 {
+		return nil, fmt.Errorf("profile %q has no sysinfo", p.Name)
+	}
+	return p, nil
+}
@@ -0,0 +1,224 @@
+package kasalink
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSimulatorProfiles(t *testing.T) {
+	var names = SimulatorProfiles()
+	if len(names) < 9 {
+		t.Fatalf("only %d profiles: %v", len(names), names)
+	}
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, name := range names {
+		var profile, err = LoadSimulatorProfile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var s *Simulator
+		if s, err = NewSimulator(SimulatorConfig{Profile: profile}); err != nil {
+			t.Fatal(err)
+		}
+		var device Device
+		if device, err = NewDevice(ctx, s.Addr()); err != nil {
+			s.Close()
+			t.Fatalf("%s: %v", name, err)
+		}
+		var sysInfo, _ = device.GetSystemInfo()
+		var model, _ = ModelOf(sysInfo)
+		var caps, _ = device.Capabilities()
+		t.Logf("%s plays a %s (%s): %+v", name, sysInfo.Model, model.Kind, caps)
+		if !strings.HasPrefix(name, model.Name) {
+			t.Errorf("%s plays a %s", name, model.Name)
+		}
+		if caps.EnergyMeter != (len(profile.Loads) > 0) {
+			t.Errorf("%s has loads %v, but energy meter %v", name, profile.Loads, caps.EnergyMeter)
+		}
+		_ = device.Close()
+		_ = s.Close()
+	}
+	if _, err := LoadSimulatorProfile("HS999"); err == nil {
+		t.Error("loaded a profile that isn't there")
+	}
+}
+
+func TestSimulatorSchemaV1(t *testing.T) {
+	var profile, err = LoadSimulatorProfile("hs110v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s *Simulator
+	if s, err = NewSimulator(SimulatorConfig{Profile: profile}); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	var ctx = context.Background()
+	var device Device
+	if device, err = NewDevice(ctx, s.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	defer device.Close()
+	var kpp = device.(*KasaPowerPlug)
+	if kpp.quirks()&QuirkEmeterUnitsV1 == 0 {
+		t.Fatal("an HS110 v1 doesn't have QuirkEmeterUnitsV1")
+	}
+	if loc := kpp.SysInfo.Location(); loc != (Location{Lat: 39.1156, Lon: -77.5702}) {
+		t.Errorf("device is at %s", loc)
+	}
+	var reading *EMeterReading
+	if reading, err = kpp.EMeterReading(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if reading.Voltage != 120 || reading.Power < 149 || reading.Power > 151 {
+		t.Errorf("a 150W heater reads %+v", reading)
+	}
+	// modules it doesn't have, and methods it doesn't, get the profile's errors
+	var answer = s.answer([]byte(`{"smartlife.iot.dimmer":{"set_brightness":{"brightness":5}},"system":{"get_dev_icon":{}}}`))
+	if !strings.Contains(answer, `"module not support"`) || !strings.Contains(answer, `"member not support"`) {
+		t.Errorf("got %s", answer)
+	}
+}
+
+func TestSimulatorBulbAndDimmer(t *testing.T) {
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var profile, err = LoadSimulatorProfile("KL130")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s *Simulator
+	if s, err = NewSimulator(SimulatorConfig{Profile: profile}); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	var b *Bulb
+	if b, err = NewBulb(ctx, s.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	if _, err = b.SetHSV(ctx, 200, 80, 40, 0); err != nil {
+		t.Fatal(err)
+	}
+	var state *LightState
+	if state, err = b.TurnOff(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	if state.On || state.Hue != 200 || state.Brightness != 40 {
+		t.Errorf("bulb is showing %+v", state)
+	}
+	if profile, err = LoadSimulatorProfile("HS220"); err != nil {
+		t.Fatal(err)
+	}
+	var ds *Simulator
+	if ds, err = NewSimulator(SimulatorConfig{Profile: profile}); err != nil {
+		t.Fatal(err)
+	}
+	defer ds.Close()
+	var d *Dimmer
+	if d, err = NewDimmer(ctx, ds.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if err = d.TransitionTo(ctx, 80, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	var brightness int
+	if brightness, err = d.Brightness(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if brightness != 80 || d.SysInfo.RelayState != 1 {
+		t.Errorf("dimmer is at %d, relay %d", brightness, d.SysInfo.RelayState)
+	}
+	for _, set := range []func(context.Context, time.Duration) error{d.SetFadeOnTime, d.SetFadeOffTime} {
+		if err = set(ctx, 2500*time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, set := range []func(context.Context, time.Duration) error{d.SetGentleOnTime, d.SetGentleOffTime} {
+		if err = set(ctx, 5*time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var settings *DimmerSettings
+	if settings, err = d.Settings(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if settings.FadeOn != 2500*time.Millisecond || settings.FadeOff != 2500*time.Millisecond ||
+		settings.GentleOn != 5*time.Minute || settings.GentleOff != 5*time.Minute || settings.MinThreshold != 11 {
+		t.Errorf("dimmer settings are %+v", settings)
+	}
+	if err = d.SetDefaultBehavior(ctx, DimmerHardOn, DimmerGentle); err != nil {
+		t.Fatal(err)
+	}
+	if err = d.SetDefaultBehavior(ctx, DimmerDoubleClick, DimmerNoAction); err != nil {
+		t.Fatal(err)
+	}
+	var behavior DimmerBehavior
+	if behavior, err = d.DefaultBehavior(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if behavior[DimmerHardOn] != DimmerGentle || behavior[DimmerSoftOn] != DimmerLastStatus ||
+		behavior[DimmerDoubleClick] != DimmerNoAction {
+		t.Errorf("dimmer behavior is %+v", behavior)
+	}
+	var answer = ds.answer([]byte(`{"smartlife.iot.dimmer":{"set_fade_on_time":{"fadeTime":20000}}}`))
+	if !strings.Contains(answer, `"err_code":-3`) {
+		t.Errorf("a 20s fade got %s", answer)
+	}
+	answer = ds.answer([]byte(`{"smartlife.iot.dimmer":{"set_soft_on_behavior":{"mode":"disco"}}}`))
+	if !strings.Contains(answer, `"err_code":-3`) {
+		t.Errorf("a disco soft on got %s", answer)
+	}
+}
+
+func TestSimulatorProfileModules(t *testing.T) {
+	// a method from every module a profile can list, one a device answers without any arguments
+	var probes = map[string]string{
+		"system":                           "get_sysinfo",
+		"schedule":                         "get_rules",
+		"smartlife.iot.common.schedule":    "get_rules",
+		"count_down":                       "get_rules",
+		"anti_theft":                       "get_rules",
+		"emeter":                           "get_realtime",
+		"smartlife.iot.common.emeter":      "get_realtime",
+		"time":                             "get_time",
+		"smartlife.iot.common.timesetting": "get_time",
+		"cnCloud":                          "get_info",
+		"smartlife.iot.common.cloud":       "get_info",
+		"netif":                            "get_scaninfo",
+		dimmerModule:                       "get_dimmer_parameters",
+		lightingServiceModule:              "get_light_state",
+	}
+	for _, name := range SimulatorProfiles() {
+		var profile, err = LoadSimulatorProfile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var s *Simulator
+		if s, err = NewSimulator(SimulatorConfig{Profile: profile}); err != nil {
+			t.Fatal(err)
+		}
+		var context string
+		if s.Outlets() > 0 {
+			// a strip's meters are per outlet
+			context = `"context":{"child_ids":["00"]},`
+		}
+		for _, module := range profile.Modules {
+			var method, ok = probes[module]
+			if !ok {
+				t.Errorf("%s lists %s, which nothing here knows how to ask", name, module)
+				continue
+			}
+			var answer = s.answer([]byte(fmt.Sprintf(`{%s%q:{%q:{}}}`, context, module, method)))
+			if strings.Contains(answer, `"err_code":-`) {
+				t.Errorf("%s lists %s, but %s got %s", name, module, method, answer)
+			}
+		}
+		_ = s.Close()
+	}
+}
@@ -0,0 +1,233 @@
+package kasalink
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSimulator(t *testing.T) {
+	var s, err = NewSimulator(SimulatorConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	// each outlet gets its own client, all at once
+	var (
+		wg   sync.WaitGroup
+		errs = make(chan error, 6)
+	)
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func(child int) {
+			defer wg.Done()
+			var device, err = NewDevice(ctx, s.Addr())
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer device.Close()
+			var kpp = device.(*KasaPowerPlug)
+			if err = kpp.SetAlias(ctx, fmt.Sprintf("Outlet %d", child), child); err != nil {
+				errs <- err
+				return
+			}
+			if child%2 == 1 {
+				_, err = kpp.TurnDeviceOff(child)
+			}
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err = range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	var device Device
+	if device, err = NewDevice(ctx, s.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	defer device.Close()
+	var kpp = device.(*KasaPowerPlug)
+	if _, err = kpp.DisableLED(); err != nil {
+		t.Fatal(err)
+	}
+	if err = kpp.SetLocation(ctx, Location{Lat: 21.3069, Lon: -157.8583}); err != nil {
+		t.Fatal(err)
+	}
+	var sysInfo *SystemInfo
+	if sysInfo, err = kpp.fetchSystemInfo(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for i, child := range sysInfo.Children {
+		if want := fmt.Sprintf("Outlet %d", i); child.Alias != want {
+			t.Errorf("child %d is called %q, not %q", i, child.Alias, want)
+		}
+		if want := 1 - i%2; child.State != want {
+			t.Errorf("child %d is in state %d, not %d", i, child.State, want)
+		}
+	}
+	if sysInfo.LEDOff != 1 {
+		t.Error("LED is still on")
+	}
+	if loc := sysInfo.Location(); loc != (Location{Lat: 21.3069, Lon: -157.8583}) {
+		t.Errorf("device is at %s", loc)
+	}
+	var reading *EMeterReading
+	if reading, err = kpp.EMeterReading(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if reading.Current != 0 {
+		t.Errorf("outlet 1 is off but draws %vA", reading.Current)
+	}
+	if reading, err = kpp.EMeterReading(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	if reading.Power < 59 || reading.Power > 61 {
+		t.Errorf("outlet 0 has a 60W light on it, but reads %vW", reading.Power)
+	}
+}
+
+func TestSimulatorRules(t *testing.T) {
+	var s, err = NewSimulator(SimulatorConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	var answer = s.answer([]byte(`{"context":{"child_ids":["01"]},"schedule":{"add_rule":{"name":"heater off","sact":0,"smin":600,"enable":1}}}`))
+	if !strings.Contains(answer, `"id":"`) {
+		t.Fatalf("add_rule got %s", answer)
+	}
+	if answer = s.answer([]byte(`{"context":{"child_ids":["01"]},"schedule":{"get_rules":{}}}`)); !strings.Contains(
+		answer, `"heater off"`) {
+		t.Errorf("get_rules got %s", answer)
+	}
+	if answer = s.answer([]byte(`{"context":{"child_ids":["02"]},"schedule":{"get_rules":{}}}`)); strings.Contains(
+		answer, `"heater off"`) {
+		t.Errorf("outlet 2 has outlet 1's rule: %s", answer)
+	}
+	if answer = s.answer([]byte(`{"context":{"child_ids":["nope"]},"system":{"set_relay_state":{"state":0}}}`)); !strings.Contains(
+		answer, fmt.Sprint(simErrNoChild)) {
+		t.Errorf("a child that isn't there got %s", answer)
+	}
+}
+
+func TestSimulatorClock(t *testing.T) {
+	var clock = NewManualClock(time.Date(2024, time.June, 3, 16, 0, 0, 0, time.UTC))
+	var s, err = NewSimulator(SimulatorConfig{Clock: clock.Now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var device Device
+	if device, err = NewDevice(ctx, s.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	defer device.Close()
+	var kpp = device.(*KasaPowerPlug)
+	var (
+		index int
+		loc   *time.Location
+	)
+	if index, loc, err = kpp.DeviceTimezone(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if loc.String() != "EST5EDT" {
+		t.Errorf("Simulator starts out on timezone %d, %s", index, loc)
+	}
+	var now time.Time
+	if now, err = kpp.DeviceTime(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !now.Equal(clock.Now()) {
+		t.Errorf("device clock says %s, not %s", now, clock.Now())
+	}
+	// setting the clock keeps it that far off from then on
+	var set = time.Date(2025, time.January, 1, 8, 30, 0, 0, loc)
+	if err = kpp.SetDeviceTime(ctx, set); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Hour)
+	if now, err = kpp.DeviceTime(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !now.Equal(set.Add(time.Hour)) {
+		t.Errorf("device clock says %s, not %s", now, set.Add(time.Hour))
+	}
+	var answer = s.answer([]byte(
+		`{"time":{"set_timezone":{"year":2025,"month":6,"mday":31,"hour":0,"min":0,"sec":0,"index":17}}}`))
+	if !strings.Contains(answer, `"err_code":-3`) {
+		t.Errorf("the 31st of June got %s", answer)
+	}
+}
+
+func TestSimulatorTimersAndWiFi(t *testing.T) {
+	var profile, err = LoadSimulatorProfile("HS110v2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s *Simulator
+	if s, err = NewSimulator(SimulatorConfig{Profile: profile}); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var device Device
+	if device, err = NewDevice(ctx, s.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	defer device.Close()
+	var kpp = device.(*KasaPowerPlug)
+	if caps, _ := kpp.Capabilities(); !caps.Timer {
+		t.Fatal("an HS110 has a countdown timer")
+	}
+	var answer []byte
+	if answer, err = kpp.AddNewCountdownRule(1, 1800, 0, "feed pause"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(answer), `"id"`) {
+		t.Errorf("adding a countdown got %s", answer)
+	}
+	if answer, err = kpp.GetCountdownRule(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(answer), `"feed pause"`) {
+		t.Errorf("countdown rules are %s", answer)
+	}
+	if answer, err = kpp.DeleteAllCountdownRules(); err != nil {
+		t.Fatal(err)
+	}
+	if answer, err = kpp.GetCountdownRule(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(answer), `"rule_list":[]`) {
+		t.Errorf("countdown rules are %s after deleting them all", answer)
+	}
+
+	var aps []AccessPoint
+	if aps, err = kpp.ScanWiFi(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(aps) != len(simAccessPoints) || aps[0] != simAccessPoints[0] {
+		t.Errorf("scan found %+v", aps)
+	}
+	if err = kpp.JoinWiFi(ctx, "ReefNet", "hunter2", KeyTypeAuto); err != nil {
+		t.Fatal(err)
+	}
+	if wifi := s.WiFi(); wifi.SSID != "ReefNet" || wifi.KeyType != KeyTypeWPA2 {
+		t.Errorf("device joined %+v", wifi)
+	}
+	if _, err = kpp.fetchSystemInfo(ctx); err == nil {
+		t.Error("the device is still answering on its old network")
+	}
+}
@@ -0,0 +1,138 @@
+package kasalink
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+// RuntimeStat is how long an outlet was on over one day, or over one month when Day is 0
+type RuntimeStat struct {
+	Year   int
+	Month  time.Month
+	Day    int
+	OnTime time.Duration
+}
+
+// EnergyStat is how much energy an outlet used over one day, or over one month when Day is 0
+type EnergyStat struct {
+	Year  int
+	Month time.Month
+	Day   int
+	// Energy is in watt hours
+	Energy int
+}
+
+// DailyRuntime asks the device how long it was on each day of a month, pass at most one child. Days the device
+// wasn't keeping count (it was unplugged, or it hadn't been set up yet) aren't there at all.
+func (kpp *KasaPowerPlug) DailyRuntime(ctx context.Context, year int, month time.Month,
+	children ...int) ([]RuntimeStat, error) {
+	if err := checkStatDate(year, month); err != nil {
+		return nil, err
+	}
+	var stats, err = kpp.scheduleStats(ctx, fmt.Sprintf(getDailyRuntimeStatsFormatString, month, year), "get_daystat",
+		children...)
+	if err != nil {
+		return nil, err
+	}
+	return runtimeStats(stats.DayList), nil
+}
+
+// MonthlyRuntime asks the device how long it was on each month of a year, pass at most one child
+func (kpp *KasaPowerPlug) MonthlyRuntime(ctx context.Context, year int, children ...int) ([]RuntimeStat, error) {
+	if err := checkStatDate(year, time.January); err != nil {
+		return nil, err
+	}
+	var stats, err = kpp.scheduleStats(ctx, fmt.Sprintf(getMonthlyRuntimeStatsFormatString, year), "get_monthstat",
+		children...)
+	if err != nil {
+		return nil, err
+	}
+	return runtimeStats(stats.MonthList), nil
+}
+
+// DailyEnergy asks the energy meter how much energy was used each day of a month, pass at most one child
+func (kpp *KasaPowerPlug) DailyEnergy(ctx context.Context, year int, month time.Month,
+	children ...int) ([]EnergyStat, error) {
+	if err := checkStatDate(year, month); err != nil {
+		return nil, err
+	}
+	var module, err = kpp.emeter(ctx, fmt.Sprintf(getDailyEnergyStatsFormatString, month, year), "get_daystat",
+		children...)
+	if err != nil {
+		return nil, err
+	}
+	return kpp.energyStats(module.DayStat.DayList), nil
+}
+
+// MonthlyEnergy asks the energy meter how much energy was used each month of a year, pass at most one child
+func (kpp *KasaPowerPlug) MonthlyEnergy(ctx context.Context, year int, children ...int) ([]EnergyStat, error) {
+	if err := checkStatDate(year, time.January); err != nil {
+		return nil, err
+	}
+	var module, err = kpp.emeter(ctx, fmt.Sprintf(getMonthlyEnergyStatsFormatString, year), "get_monthstat",
+		children...)
+	if err != nil {
+		return nil, err
+	}
+	return kpp.energyStats(module.MonthStat.MonthList), nil
+}
+
+func checkStatDate(year int, month time.Month) error {
+	if year < 2000 || month < time.January || month > time.December {
+		return fmt.Errorf("%d-%02d isn't a month there could be stats for", year, int(month))
+	}
+	return nil
+}
+
+func runtimeStats(entries []statEntry) []RuntimeStat {
+	var stats = make([]RuntimeStat, 0, len(entries))
+	for _, e := range entries {
+		stats = append(stats, RuntimeStat{Year: e.Year, Month: time.Month(e.Month), Day: e.Day,
+			OnTime: time.Duration(e.Time) * time.Minute})
+	}
+	return stats
+}
+
+// energyStats turns the meter's stats into EnergyStats, converting from kWh on devices with QuirkEmeterUnitsV1
+func (kpp *KasaPowerPlug) energyStats(entries []statEntry) []EnergyStat {
+	var (
+		stats = make([]EnergyStat, 0, len(entries))
+		v1    = kpp.quirks()&QuirkEmeterUnitsV1 != 0
+	)
+	for _, e := range entries {
+		var energy = e.EnergyWh
+		if v1 {
+			energy = int(math.Round(e.Energy * 1000))
+		}
+		stats = append(stats, EnergyStat{Year: e.Year, Month: time.Month(e.Month), Day: e.Day, Energy: energy})
+	}
+	return stats
+}
+
+// scheduleStats sends get_daystat or get_monthstat to the schedule module and makes sure the device answered it
+// without complaint
+func (kpp *KasaPowerPlug) scheduleStats(ctx context.Context, cmd, method string, children ...int) (*statList, error) {
+	if len(children) > 1 {
+		return nil, fmt.Errorf("%s is one outlet at a time, not %v", method, children)
+	}
+	var response, err = kpp.query(ctx, cmd, children...)
+	if err != nil {
+		return nil, err
+	}
+	if response.Schedule == nil {
+		return nil, errNoAnswer("schedule", method)
+	}
+	var answer = response.Schedule.DayStat
+	if method == "get_monthstat" {
+		answer = response.Schedule.MonthStat
+	}
+	if answer == nil {
+		return nil, response.Schedule.missing("schedule", method)
+	}
+	if err = answer.err("schedule", method); err != nil {
+		return nil, err
+	}
+	return answer, nil
+}
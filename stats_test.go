@@ -0,0 +1,75 @@
+package kasalink
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRuntimeStats(t *testing.T) {
+	var (
+		kpp *KasaPowerPlug
+		ctx = context.Background()
+		now = time.Now()
+	)
+	mockOrNot(&kpp, t)
+	defer kpp.Close()
+	var days, err = kpp.DailyRuntime(ctx, now.Year(), now.Month(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, day := range days {
+		t.Logf("%d-%02d-%02d: on for %s", day.Year, day.Month, day.Day, day.OnTime)
+	}
+	if useMock && (len(days) != 3 || days[2].OnTime != 24*time.Hour || days[2].Month != now.Month()) {
+		t.Errorf("got %+v", days)
+	}
+	var months []RuntimeStat
+	if months, err = kpp.MonthlyRuntime(ctx, now.Year(), 1); err != nil {
+		t.Fatal(err)
+	}
+	if useMock && (len(months) != 2 || months[0].OnTime != 240*time.Hour || months[0].Day != 0) {
+		t.Errorf("got %+v", months)
+	}
+	if _, err = kpp.DailyRuntime(ctx, now.Year(), 13, 1); err == nil {
+		t.Error("got stats for month 13")
+	}
+	if _, err = kpp.DailyRuntime(ctx, now.Year(), now.Month(), 1, 2); err == nil {
+		t.Error("got stats for two outlets at once")
+	}
+}
+
+func TestEnergyStats(t *testing.T) {
+	var (
+		kpp *KasaPowerPlug
+		ctx = context.Background()
+		now = time.Now()
+	)
+	mockOrNot(&kpp, t)
+	defer kpp.Close()
+	var days, err = kpp.DailyEnergy(ctx, now.Year(), now.Month(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, day := range days {
+		t.Logf("%d-%02d-%02d: %dWh", day.Year, day.Month, day.Day, day.Energy)
+	}
+	if useMock && (len(days) != 3 || days[0].Energy != 90) {
+		t.Errorf("got %+v", days)
+	}
+	var months []EnergyStat
+	if months, err = kpp.MonthlyEnergy(ctx, now.Year(), 0); err != nil {
+		t.Fatal(err)
+	}
+	if useMock && (len(months) != 2 || months[1].Energy != 12960) {
+		t.Errorf("got %+v", months)
+	}
+}
+
+func TestEnergyStatsV1Units(t *testing.T) {
+	var kpp = &KasaPowerPlug{SysInfo: &SystemInfo{Model: "HS110(US)", HardwareVersion: "1.0"}}
+	var stats = kpp.energyStats([]statEntry{{Year: 2019, Month: 3, Day: 10, Energy: 1.2345}})
+	if len(stats) != 1 || stats[0].Energy != 1235 {
+		t.Fatalf("got %+v", stats)
+	}
+}
@@ -0,0 +1,118 @@
+package kasalink
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultDriftThreshold is how far off a device's clock can be before SyncTime bothers correcting it. Kasa devices
+// only keep time to the second, so anything much tighter than this just chases rounding.
+const DefaultDriftThreshold = 2 * time.Second
+
+// ClockDrift is how far a device's clock was from the host's clock when we checked
+type ClockDrift struct {
+	DeviceID   string
+	Alias      string
+	DeviceTime time.Time
+	HostTime   time.Time
+	// Drift is DeviceTime - HostTime, so a positive Drift means the device is running ahead
+	Drift     time.Duration
+	Corrected bool
+	Err       error
+}
+
+// MeasureClockDrift compares the device's clock against the host's. The host time used is the middle of the round
+// trip, which is the best guess at when the device actually read its clock.
+func (kpp *KasaPowerPlug) MeasureClockDrift(ctx context.Context) (drift ClockDrift, err error) {
+	if kpp.SysInfo != nil {
+		drift.DeviceID = kpp.SysInfo.DeviceID
+		drift.Alias = kpp.SysInfo.Alias
+	}
+	var sent = time.Now()
+	if drift.DeviceTime, err = kpp.DeviceTime(ctx); err != nil {
+		drift.Err = err
+		return drift, err
+	}
+	var received = time.Now()
+	drift.HostTime = sent.Add(received.Sub(sent) / 2)
+	// the device drops fractions of a second, so compare against the middle of the second it reported
+	drift.Drift = drift.DeviceTime.Add(500 * time.Millisecond).Sub(drift.HostTime)
+	return drift, nil
+}
+
+// SyncTime measures the device's clock drift, and if it's off by more than threshold, sets the device's clock to
+// the host's time (keeping the device's timezone). A threshold of zero means DefaultDriftThreshold.
+func (kpp *KasaPowerPlug) SyncTime(ctx context.Context, threshold time.Duration) (drift ClockDrift, err error) {
+	if threshold == 0 {
+		threshold = DefaultDriftThreshold
+	}
+	if drift, err = kpp.MeasureClockDrift(ctx); err != nil {
+		return drift, err
+	}
+	if drift.Drift < threshold && drift.Drift > -threshold {
+		return drift, nil
+	}
+	if err = kpp.SetDeviceTime(ctx, time.Now()); err != nil {
+		drift.Err = err
+		return drift, err
+	}
+	drift.Corrected = true
+	if kpp.log != nil {
+		kpp.log.Printf("Corrected clock on %s (%s), it was off by %s", drift.Alias, drift.DeviceID, drift.Drift)
+	}
+	return drift, nil
+}
+
+// TimeSyncer keeps the clocks on a list of devices in line with the host's clock, so device side schedules fire
+// when you expect them to.
+type TimeSyncer struct {
+	Devices []*KasaPowerPlug
+	// Threshold is passed along to SyncTime, zero means DefaultDriftThreshold
+	Threshold time.Duration
+	// Interval is how long Run waits between passes over Devices, zero means an hour
+	Interval time.Duration
+	// Report, if set, gets told about every device on every pass, including the ones that failed
+	Report func(ClockDrift)
+}
+
+// SyncOnce runs SyncTime against every device at the same time, and gives back the results in the same order as
+// Devices. Failures are in each result's Err.
+func (ts *TimeSyncer) SyncOnce(ctx context.Context) []ClockDrift {
+	var (
+		results = make([]ClockDrift, len(ts.Devices))
+		wg      sync.WaitGroup
+	)
+	for i, kpp := range ts.Devices {
+		wg.Add(1)
+		go func(i int, kpp *KasaPowerPlug) {
+			defer wg.Done()
+			results[i], _ = kpp.SyncTime(ctx, ts.Threshold)
+		}(i, kpp)
+	}
+	wg.Wait()
+	if ts.Report != nil {
+		for _, result := range results {
+			ts.Report(result)
+		}
+	}
+	return results
+}
+
+// Run calls SyncOnce right away, and then every Interval, until ctx is done
+func (ts *TimeSyncer) Run(ctx context.Context) error {
+	var interval = ts.Interval
+	if interval == 0 {
+		interval = time.Hour
+	}
+	var ticker = time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		ts.SyncOnce(ctx)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
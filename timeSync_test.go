@@ -0,0 +1,50 @@
+package kasalink
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestKasaPowerPlug_SyncTime(t *testing.T) {
+	var (
+		kpp   *KasaPowerPlug
+		drift ClockDrift
+		err   error
+	)
+	mockOrNot(&kpp, t)
+	drift, err = kpp.SyncTime(context.Background(), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("%+v", drift)
+	if useMock && !drift.Corrected {
+		t.Fatal("the mock's clock is years behind, it should have been corrected")
+	}
+}
+
+func TestTimeSyncer_Run(t *testing.T) {
+	var (
+		kpp     *KasaPowerPlug
+		reports int
+	)
+	mockOrNot(&kpp, t)
+	var ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	var ts = TimeSyncer{
+		Devices:  []*KasaPowerPlug{kpp},
+		Interval: 10 * time.Millisecond,
+		Report: func(drift ClockDrift) {
+			if drift.Err != nil && drift.Err != context.DeadlineExceeded {
+				t.Error(drift.Err)
+			}
+			reports++
+		},
+	}
+	if err := ts.Run(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expected Run to stop with the context, got %v", err)
+	}
+	if reports < 2 {
+		t.Fatalf("expected a report per pass, got %d", reports)
+	}
+}
@@ -0,0 +1,92 @@
+package kasalink
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// kasaTimezones is TP-Link's timezone table, the position in the slice is the "index" the time module wants. The
+// names are the closest IANA zone to what the Kasa app shows for each entry.
+var kasaTimezones = []string{
+	"Etc/GMT+12", "Pacific/Samoa", "US/Hawaii", "US/Alaska", "Mexico/BajaNorte", "Etc/GMT+8", "PST8PDT",
+	"US/Arizona", "America/Mazatlan", "MST", "MST7MDT", "Mexico/General", "Etc/GMT+6", "CST6CDT",
+	"America/Monterrey", "Canada/Saskatchewan", "America/Bogota", "EST5EDT", "America/Indiana/Indianapolis",
+	"America/Caracas", "America/Asuncion", "Etc/GMT+4", "Canada/Atlantic", "America/Cuiaba", "Brazil/West",
+	"America/Santiago", "Canada/Newfoundland", "America/Sao_Paulo", "America/Argentina/Buenos_Aires",
+	"America/Cayenne", "America/Miquelon", "America/Montevideo", "Chile/Continental", "Etc/GMT+2",
+	"Atlantic/Azores", "Atlantic/Cape_Verde", "Africa/Casablanca", "UCT", "GB", "Africa/Monrovia",
+	"Europe/Amsterdam", "Europe/Belgrade", "Europe/Brussels", "Europe/Sarajevo", "Africa/Lagos", "Africa/Windhoek",
+	"Asia/Amman", "Europe/Athens", "Asia/Beirut", "Africa/Cairo", "Asia/Damascus", "EET", "Africa/Harare",
+	"Europe/Helsinki", "Asia/Istanbul", "Asia/Jerusalem", "Europe/Kaliningrad", "Africa/Tripoli", "Asia/Baghdad",
+	"Asia/Kuwait", "Europe/Minsk", "Europe/Moscow", "Africa/Nairobi", "Asia/Tehran", "Asia/Muscat", "Asia/Baku",
+	"Europe/Samara", "Indian/Mauritius", "Asia/Tbilisi", "Asia/Yerevan", "Asia/Kabul", "Asia/Ashgabat",
+	"Asia/Yekaterinburg", "Asia/Karachi", "Asia/Kolkata", "Asia/Colombo", "Asia/Kathmandu", "Asia/Almaty",
+	"Asia/Dhaka", "Asia/Novosibirsk", "Asia/Rangoon", "Asia/Bangkok", "Asia/Krasnoyarsk", "Asia/Chongqing",
+	"Asia/Irkutsk", "Asia/Singapore", "Australia/Perth", "Asia/Taipei", "Asia/Ulaanbaatar", "Asia/Tokyo",
+	"Asia/Seoul", "Asia/Yakutsk", "Australia/Adelaide", "Australia/Darwin", "Australia/Brisbane",
+	"Australia/Canberra", "Pacific/Guam", "Australia/Hobart", "Antarctica/DumontDUrville", "Asia/Magadan",
+	"Asia/Srednekolymsk", "Etc/GMT-11", "Asia/Anadyr", "Pacific/Auckland", "Etc/GMT-12", "Pacific/Fiji",
+	"Etc/GMT-13", "Pacific/Apia", "Etc/GMT-14",
+}
+
+var (
+	kasaLocations     = map[int]*time.Location{}
+	kasaLocationsLock sync.Mutex
+)
+
+// TimezoneLocation gives you the *time.Location for an index in TP-Link's timezone table
+func TimezoneLocation(index int) (*time.Location, error) {
+	if index < 0 || index >= len(kasaTimezones) {
+		return nil, fmt.Errorf("%d is not a kasa timezone index [0-%d]", index, len(kasaTimezones)-1)
+	}
+	kasaLocationsLock.Lock()
+	defer kasaLocationsLock.Unlock()
+	if loc, ok := kasaLocations[index]; ok {
+		return loc, nil
+	}
+	var loc, err = time.LoadLocation(kasaTimezones[index])
+	if err != nil {
+		return nil, err
+	}
+	kasaLocations[index] = loc
+	return loc, nil
+}
+
+// TimezoneIndex finds the index in TP-Link's timezone table for an IANA zone name (like "America/New_York"). Zones
+// that aren't in the table by name get matched to the first entry that keeps the same UTC offset and daylight saving
+// rules all year long, so the device still switches to and from DST on the right days.
+func TimezoneIndex(name string) (int, error) {
+	for i, tz := range kasaTimezones {
+		if tz == name {
+			return i, nil
+		}
+	}
+	var want, err = time.LoadLocation(name)
+	if err != nil {
+		return -1, err
+	}
+	for i := range kasaTimezones {
+		var candidate, err = TimezoneLocation(i)
+		if err != nil {
+			// the host's zoneinfo doesn't know this one, so it can't be compared
+			continue
+		}
+		if sameRules(want, candidate, time.Now().Year()) {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("no kasa timezone behaves like %s", name)
+}
+
+// sameRules checks a and b have the same UTC offset at noon (UTC) on every day of the given year
+func sameRules(a, b *time.Location, year int) bool {
+	for day := time.Date(year, time.January, 1, 12, 0, 0, 0, time.UTC); day.Year() == year; day = day.AddDate(0, 0, 1) {
+		var _, offsetA = day.In(a).Zone()
+		var _, offsetB = day.In(b).Zone()
+		if offsetA != offsetB {
+			return false
+		}
+	}
+	return true
+}
@@ -1,6 +1,7 @@
 package kasalink
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -15,28 +16,32 @@ const (
 	turnOff                            = `{"system":{"set_relay_state":{"state":0}}}`
 	turnOffLED                         = `{"system":{"set_led_off":{"off":1}}}`
 	turnOnLED                          = `{"system":{"set_led_off":{"off":0}}}`
-	getDeviceIcon                      = `{"system":{"get_dev_icon":}}`
-	getCloudInfo                       = `{"cnCloud":{"get_info":}}`
+	getDeviceIcon                      = `{"system":{"get_dev_icon":{}}}`
+	getCloudInfo                       = `{"cnCloud":{"get_info":{}}}`
 	getFirmwareList                    = `{"cnCloud":{"get_intl_fw_list":{}}}`
 	setDefaultCloudURL                 = `{"cnCloud":{"set_server_url":{"server":"devs.tplinkcloud.com"}}}`
-	unbindDeviceFromCloud              = `{"cnCloud":{"unbind":}}`
-	getDeviceTime                      = `{"time":{"get_time":}}`
-	getDeviceTimeZone                  = `{"time":{"get_timezone":}}`
+	unbindDeviceFromCloud              = `{"cnCloud":{"unbind":{}}}`
+	getDeviceTime                      = `{"time":{"get_time":{}}}`
+	getDeviceTimeZone                  = `{"time":{"get_timezone":{}}}`
+	getDeviceTimeAndZone               = `{"time":{"get_time":{},"get_timezone":{}}}`
 	getCurrentAndVoltage               = `{"emeter":{"get_realtime":{}}}`
 	getVandIGain                       = `{"emeter":{"get_vgain_igain":{}}}`
 	scanForAccessPoints                = `{"netif":{"get_scaninfo":{"refresh":1}}}`
-	setDeviceAliasFormatString         = "{\"system\":{\"set_dev_alias\":{\"alias\":\"%s\"}}}"
+	setDeviceAliasFormatString         = "{\"system\":{\"set_dev_alias\":{\"alias\":%s}}}"
 	latLongFormatString                = "{\"system\":{\"set_dev_location\":{\"longitude\":%f,\"latitude\":%f}}}"
-	setDeviceIconFormatString          = "{\"system\":{\"set_dev_icon\":{\"icon\":\"%s\",\"hash\":\"%s\"}}}"
+	setDeviceIconFormatString          = "{\"system\":{\"set_dev_icon\":{\"icon\":%s,\"hash\":%s}}}"
 	eraseEnergyMeterStats              = `{"emeter":{"erase_emeter_stat":}}`
 	connecToAccessPointFormatString    = "{\"netif\":{\"set_stainfo\":{\"ssid\":\"%s\",\"password\":\"%s\",\"key_type\":3}}}"
-	setCloudURLFormatString            = "{\"cnCloud\":{\"set_server_url\":{\"server\":\"%s\"}}}"
-	cloudConnectFormatString           = "{\"cnCloud\":{\"bind\":{\"username\":\"%s\", \"password\":\"%s\"}}}"
+	joinWiFiFormatString               = "{\"netif\":{\"set_stainfo\":{\"ssid\":%s,\"password\":%s,\"key_type\":%d}}}"
+	setCloudURLFormatString            = "{\"cnCloud\":{\"set_server_url\":{\"server\":%s}}}"
+	cloudConnectFormatString           = "{\"cnCloud\":{\"bind\":{\"username\":%s,\"password\":%s}}}"
 	setDeviceTimeFormatString          = "{\"time\":{\"set_timezone\":{\"year\":%d,\"month\":%d,\"mday\":%d,\"hour\":%d,\"min\":%d,\"sec\":%d,\"index\":%d}}}"
 	setVandIGainFormatString           = "{\"emeter\":{\"set_vgain_igain\":{\"vgain\":%d,\"igain\":%d}}}"
 	startEMeterCalibrationFormatString = "{\"emeter\":{\"start_calibration\":{\"vtarget\":%d,\"itarget\":%d}}}"
 	getDailyEnergyStatsFormatString    = "{\"emeter\":{\"get_daystat\":{\"month\":%d,\"year\":%d}}}"
-	getMonthlyEnergyStatsFormatString  = "{\"emeter\":{\"\"get_monthstat\":{\"year\":%d}}}"
+	getMonthlyEnergyStatsFormatString  = "{\"emeter\":{\"get_monthstat\":{\"year\":%d}}}"
+	getDailyRuntimeStatsFormatString   = "{\"schedule\":{\"get_daystat\":{\"month\":%d,\"year\":%d}}}"
+	getMonthlyRuntimeStatsFormatString = "{\"schedule\":{\"get_monthstat\":{\"year\":%d}}}"
 )
 
 // GetSystemInfo is the is the Struct that contains info about the Kasa Device
@@ -53,6 +58,26 @@ func (kpp *KasaPowerPlug) GetSystemInfo() (*SystemInfo, error) {
 	return si.System.GetSysInfo, err
 }
 
+// fetchSystemInfo always asks the device, and keeps what it says in SysInfo
+func (kpp *KasaPowerPlug) fetchSystemInfo(ctx context.Context) (*SystemInfo, error) {
+	var response, err = kpp.query(ctx, getSysInfo)
+	if err != nil {
+		return nil, err
+	}
+	if response.System == nil {
+		return nil, errNoAnswer("system", "get_sysinfo")
+	}
+	if response.System.GetSysInfo == nil {
+		return nil, response.System.missing("system", "get_sysinfo")
+	}
+	if response.System.GetSysInfo.ErrCode != 0 {
+		return nil, &ResponseError{Module: "system", Method: "get_sysinfo", Code: response.System.GetSysInfo.ErrCode}
+	}
+	kpp.SysInfo = response.System.GetSysInfo
+	kpp.deviceID = kpp.SysInfo.DeviceID
+	return kpp.SysInfo, nil
+}
+
 func (kpp *KasaPowerPlug) querySystemInfo(children ...int) ([]byte, error) {
 	if children != nil {
 		return kpp.tellChild(getSysInfo, children...)
@@ -115,12 +140,19 @@ func (kpp *KasaPowerPlug) EnableLED() (wrapper *KasaResponse, err error) {
 // SetDeviceAliasString takes a string to assign as the device alias
 func (kpp *KasaPowerPlug) SetDeviceAliasString(alias string, children ...int) ([]byte, error) {
 	if children != nil {
-		return kpp.tellChild(fmt.Sprintf(setDeviceAliasFormatString, alias), children...)
+		return kpp.tellChild(fmt.Sprintf(setDeviceAliasFormatString, jsonString(alias)), children...)
 	}
-	return kpp.talkToPlug(fmt.Sprintf(setDeviceAliasFormatString, alias))
+	return kpp.talkToPlug(fmt.Sprintf(setDeviceAliasFormatString, jsonString(alias)))
+}
+
+// SetAlias gives the device (or the given children of the device) a new name
+func (kpp *KasaPowerPlug) SetAlias(ctx context.Context, alias string, children ...int) error {
+	return kpp.system(ctx, fmt.Sprintf(setDeviceAliasFormatString, jsonString(alias)), "set_dev_alias", children...)
 }
 
 // SetLongLat returns the JSON required to set the location of a device
+//
+// Deprecated: use SetLocation, which checks the location and what the device says about it
 func (kpp *KasaPowerPlug) SetLongLat(long, lat float64) ([]byte, error) {
 	return kpp.talkToPlug(fmt.Sprintf(latLongFormatString, long, lat))
 }
@@ -128,17 +160,18 @@ func (kpp *KasaPowerPlug) SetLongLat(long, lat float64) ([]byte, error) {
 // GetDeviceIcon is the JSON to get the device icon
 func (kpp *KasaPowerPlug) GetDeviceIcon(children ...int) ([]byte, error) {
 	if children != nil {
-		return kpp.tellChild(getDeviceIcon)
+		return kpp.tellChild(getDeviceIcon, children...)
 	}
 	return kpp.talkToPlug(getDeviceIcon)
 }
 
-// SetDeviceIcon returns the JSON to set the devce icon
-func (kpp *KasaPowerPlug) SetDeviceIcon(s1, s2 string, children ...int) ([]byte, error) {
+// SetDeviceIcon returns the JSON to set the devce icon. icon is the base64 encoded image, and hash is its IconHash.
+// SetDeviceIconData does all of that for you.
+func (kpp *KasaPowerPlug) SetDeviceIcon(icon, hash string, children ...int) ([]byte, error) {
 	if children != nil {
-		return kpp.tellChild(fmt.Sprintf(setDeviceIconFormatString, s1, s2), children...)
+		return kpp.tellChild(fmt.Sprintf(setDeviceIconFormatString, jsonString(icon), jsonString(hash)), children...)
 	}
-	return kpp.talkToPlug(fmt.Sprintf(setDeviceIconFormatString, s1, s2))
+	return kpp.talkToPlug(fmt.Sprintf(setDeviceIconFormatString, jsonString(icon), jsonString(hash)))
 }
 
 //WLAN Commands
@@ -148,7 +181,8 @@ func (kpp *KasaPowerPlug) ScanForAccessPoints(children ...int) ([]byte, error) {
 	return kpp.talkToPlug(scanForAccessPoints)
 }
 
-// ConnectToAccessPoint Connect to AP with given SSID and Password
+// ConnectToAccessPoint Connect to AP with given SSID and Password. It always asks for WPA2, JoinWiFi works out the
+// right key type for you.
 func (kpp *KasaPowerPlug) ConnectToAccessPoint(ssid, passwd string) ([]byte, error) {
 	return kpp.talkToPlug(fmt.Sprintf(connecToAccessPointFormatString, ssid, passwd))
 }
@@ -167,7 +201,7 @@ func (kpp *KasaPowerPlug) GetFirmwareFromCloud() ([]byte, error) {
 
 // SetServerURL returns the JSON required to set a new server URL
 func (kpp *KasaPowerPlug) SetServerURL(newServer string) ([]byte, error) {
-	return kpp.talkToPlug(fmt.Sprintf(setCloudURLFormatString, newServer))
+	return kpp.talkToPlug(fmt.Sprintf(setCloudURLFormatString, jsonString(newServer)))
 }
 
 // SetDefaultServerURL is the JSON to set the default server URL (devs.tplinkcloud.com)
@@ -177,7 +211,7 @@ func (kpp *KasaPowerPlug) SetDefaultServerURL() ([]byte, error) {
 
 // ConnectWithUserPass returns the JSON required to connect to the TP-Link Cloud service with a username & password
 func (kpp *KasaPowerPlug) ConnectWithUserPass(user, pass string) ([]byte, error) {
-	return kpp.talkToPlug(fmt.Sprintf(cloudConnectFormatString, user, pass))
+	return kpp.talkToPlug(fmt.Sprintf(cloudConnectFormatString, jsonString(user), jsonString(pass)))
 }
 
 // UnregisterFromCloud is the JSON to unregister the device from a TP-Link Cloud Account
@@ -197,11 +231,17 @@ func (kpp *KasaPowerPlug) GetDeviceTimezone() ([]byte, error) {
 	return kpp.talkToPlug(getDeviceTimeZone)
 }
 
-// SetDeviceTimeZone returns the JSON to set the time, date and time zone
+// SetDeviceTimeZone returns the JSON to set the time, date and time zone. The time zone is taken from t's Location,
+// which has to be one the device knows about (see TimezoneIndex).
+//
+// Deprecated: use SetTimezone or SetDeviceTime instead, they check the device's answer for you.
 func (kpp *KasaPowerPlug) SetDeviceTimeZone(t *time.Time) ([]byte, error) {
-	var _, offset = t.Zone()
+	var index, err = TimezoneIndex(t.Location().String())
+	if err != nil {
+		return nil, err
+	}
 	return kpp.talkToPlug(fmt.Sprintf(setDeviceTimeFormatString,
-		t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), offset))
+		t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), index))
 }
 
 //EMeter Energy Usage Statistics Commands
@@ -212,6 +252,9 @@ func (kpp *KasaPowerPlug) GetRealtimeCurrentAndVoltage(children ...int) (respons
 	var (
 		jsonBytes []byte
 	)
+	if err = kpp.requireEnergyMeter(); err != nil {
+		return nil, err
+	}
 	if children != nil {
 		jsonBytes, err = kpp.tellChild(getCurrentAndVoltage, children...)
 	} else {
@@ -224,14 +267,20 @@ func (kpp *KasaPowerPlug) GetRealtimeCurrentAndVoltage(children ...int) (respons
 	if err != nil {
 		return
 	}
-	if response.EnergyMeter.Realtime.ErrorCode != 0 {
-		return nil, fmt.Errorf(response.EnergyMeter.Realtime.ErrorMessage)
+	if err = response.EnergyMeter.Realtime.err("emeter", "get_realtime"); err != nil {
+		return nil, err
+	}
+	if kpp.quirks()&QuirkEmeterUnitsV1 != 0 {
+		response.EnergyMeter.Realtime.fromV1Units()
 	}
 	return
 }
 
 // GetVGainAndIGain is the JSON to get EMeter VGain and IGain settings
 func (kpp *KasaPowerPlug) GetVGainAndIGain(children ...int) ([]byte, error) {
+	if err := kpp.requireEnergyMeter(); err != nil {
+		return nil, err
+	}
 	if children != nil {
 		return kpp.tellChild(getVandIGain, children...)
 	}
@@ -240,6 +289,9 @@ func (kpp *KasaPowerPlug) GetVGainAndIGain(children ...int) ([]byte, error) {
 
 // SetVGainAndIGain returns the JSON to set EMeter VGain and Igain values
 func (kpp *KasaPowerPlug) SetVGainAndIGain(newVGain, newIGain int, children ...int) ([]byte, error) {
+	if err := kpp.requireEnergyMeter(); err != nil {
+		return nil, err
+	}
 	if children != nil {
 		return kpp.tellChild(fmt.Sprintf(setVandIGainFormatString, newVGain, newIGain), children...)
 	}
@@ -248,6 +300,9 @@ func (kpp *KasaPowerPlug) SetVGainAndIGain(newVGain, newIGain int, children ...i
 
 // StartEMeterCalibration returns the JSON to start EMeter calibration
 func (kpp *KasaPowerPlug) StartEMeterCalibration(vTarget, iTarget int, children ...int) ([]byte, error) {
+	if err := kpp.requireEnergyMeter(); err != nil {
+		return nil, err
+	}
 	if children != nil {
 		return kpp.tellChild(fmt.Sprintf(startEMeterCalibrationFormatString, vTarget, iTarget), children...)
 	}
@@ -256,6 +311,9 @@ func (kpp *KasaPowerPlug) StartEMeterCalibration(vTarget, iTarget int, children
 
 // GetDailyStatsForMonthYear returns the JSON to get daily statistic for a given month
 func (kpp *KasaPowerPlug) GetDailyStatsForMonthYear(month, year int, children ...int) ([]byte, error) {
+	if err := kpp.requireEnergyMeter(); err != nil {
+		return nil, err
+	}
 	var jsonCmd string
 	if month > 11 || month < 0 {
 		return nil, fmt.Errorf("%d is an invalid value for month [0-11]", month)
@@ -275,6 +333,9 @@ func (kpp *KasaPowerPlug) GetDailyStatsForMonthYear(month, year int, children ..
 
 // GetMonthlyStatsForYear returns the JSON required to get monthly statistic for given year
 func (kpp *KasaPowerPlug) GetMonthlyStatsForYear(year int, children ...int) ([]byte, error) {
+	if err := kpp.requireEnergyMeter(); err != nil {
+		return nil, err
+	}
 	var jsonCmd string
 	if year > time.Now().Year() {
 		return nil, fmt.Errorf("%d appears to be in the future", year)
@@ -288,6 +349,9 @@ func (kpp *KasaPowerPlug) GetMonthlyStatsForYear(year int, children ...int) ([]b
 
 // EraseEMeterStats is the JSON to erase all EMeter statistics
 func (kpp *KasaPowerPlug) EraseEMeterStats(children ...int) ([]byte, error) {
+	if err := kpp.requireEnergyMeter(); err != nil {
+		return nil, err
+	}
 	if children != nil {
 		return kpp.tellChild(eraseEnergyMeterStats, children...)
 	}
@@ -332,29 +396,44 @@ func (kpp *KasaPowerPlug) DeleteAllScheduleRules(children ...int) ([]byte, error
 
 // GetCountdownRule is the JSON toge the existing countdown rule
 func (kpp *KasaPowerPlug) GetCountdownRule(children ...int) ([]byte, error) {
-	return kpp.talkToPlug(`{"count_down":{"get_rules":}}`)
+	if err := kpp.requireTimer(); err != nil {
+		return nil, err
+	}
+	return kpp.talkToPlug(`{"count_down":{"get_rules":{}}}`)
 }
 
 // AddNewCountdownRule is the JSON to add a new countdown rule
 func (kpp *KasaPowerPlug) AddNewCountdownRule(enable, delay, act int, name string) ([]byte, error) {
+	if err := kpp.requireTimer(); err != nil {
+		return nil, err
+	}
 	return kpp.talkToPlug(fmt.Sprintf("{\"count_down\":{\"add_rule\":{\"enable\":%d,\"delay\":%d,\"act\":%d,\"name\":\"%s\"}}}",
 		enable, delay, act, name))
 }
 
 // EditCountdownRule returns the JSON to edit a countdown rule with the given ID
 func (kpp *KasaPowerPlug) EditCountdownRule(enable, delay, act int, name, id string) ([]byte, error) {
+	if err := kpp.requireTimer(); err != nil {
+		return nil, err
+	}
 	return kpp.talkToPlug(fmt.Sprintf("{\"count_down\":{\"edit_rule\":{\"enable\":%d,\"id\":\"%s\",\"delay\":%d,\"act\":%d,\"name\":\"%s\"}}}",
 		enable, id, delay, act, name))
 }
 
 // DeleteCountdownRule returns the JSON to delete a countdown rule with the given ID
 func (kpp *KasaPowerPlug) DeleteCountdownRule(id string) ([]byte, error) {
+	if err := kpp.requireTimer(); err != nil {
+		return nil, err
+	}
 	return kpp.talkToPlug(fmt.Sprintf("{\"count_down\":{\"delete_rule\":{\"id\":\"%s\"}}}", id))
 }
 
 // DeleteAllCountdownRules is the JSON to delete all countdown rules
 func (kpp *KasaPowerPlug) DeleteAllCountdownRules(children ...int) ([]byte, error) {
-	return kpp.talkToPlug(`{"count_down":{"delete_all_rules":}}`)
+	if err := kpp.requireTimer(); err != nil {
+		return nil, err
+	}
+	return kpp.talkToPlug(`{"count_down":{"delete_all_rules":{}}}`)
 }
 
 //Anti-Theft Rule Commands (aka Away Mode)
@@ -362,7 +441,7 @@ func (kpp *KasaPowerPlug) DeleteAllCountdownRules(children ...int) ([]byte, erro
 
 // GetAntiTheftRules is the JSON to retrieve the existing anti-theft rule set
 func (kpp *KasaPowerPlug) GetAntiTheftRules(children ...int) ([]byte, error) {
-	return kpp.talkToPlug(`{"anti_theft":{"get_rules":}}`)
+	return kpp.talkToPlug(`{"anti_theft":{"get_rules":{}}}`)
 }
 
 // AddAntiTheftRule returns the JSON reuqired to add a new anti-theft rule
@@ -382,9 +461,15 @@ func (kpp *KasaPowerPlug) DeleteAntiTheftRule(id string) ([]byte, error) {
 
 // DeleteAllAntiTheftRules is the JSON to delete all the anti-theft rules
 func (kpp *KasaPowerPlug) DeleteAllAntiTheftRules(children ...int) ([]byte, error) {
-	return kpp.talkToPlug(`{"anti_theft":{"delete_all_rules":}}`)
+	return kpp.talkToPlug(`{"anti_theft":{"delete_all_rules":{}}}`)
 }
 
 func trimJSONArray(s string) string {
 	return strings.Replace(s, `,]`, `]`, 1)
 }
+
+// jsonString quotes s as a JSON string, for dropping user supplied text into the format strings above
+func jsonString(s string) string {
+	var b, _ = json.Marshal(s)
+	return string(b)
+}
@@ -2,6 +2,7 @@ package kasalink
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -24,7 +25,6 @@ var (
 func init() {
 
 	flag.BoolVar(&useMock, "useMock", true, "use the MockPlug instead of the real one.")
-	flag.Parse()
 }
 
 func mockOrNot(kpp **KasaPowerPlug, t *testing.T) {
@@ -157,3 +157,30 @@ func TestKasaPowerPlug_TurnDevice(t *testing.T) {
 		t.Fatal("Error response from the TPLink Device")
 	}
 }
+
+func TestKasaPowerPlug_SetDeviceAliasString(t *testing.T) {
+	var s, err = NewSimulator(SimulatorConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	var kpp *KasaPowerPlug
+	if kpp, err = NewKasaPowerPlug(s.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	defer kpp.Close()
+	var alias = `Tank "A" \ sump`
+	if _, err = kpp.SetDeviceAliasString(alias, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err = kpp.SetAlias(context.Background(), alias, 1); err != nil {
+		t.Fatal(err)
+	}
+	var sysInfo *SystemInfo
+	if sysInfo, err = kpp.fetchSystemInfo(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if sysInfo.Children[0].Alias != alias || sysInfo.Children[1].Alias != alias {
+		t.Errorf("aliases came back %q and %q", sysInfo.Children[0].Alias, sysInfo.Children[1].Alias)
+	}
+}
@@ -74,39 +74,123 @@ type childState struct {
 
 // SystemInfo is the system information about a TP-Link/Kasa device
 type SystemInfo struct {
-	SoftwareVersion string       `json:"sw_ver"`
-	HardwareVersion string       `json:"hw_ver"`
-	Model           string       `json:"model"`
-	DeviceID        string       `json:"deviceId"`
-	OEMID           string       `json:"oemId"`
-	HardwareID      string       `json:"hwId"`
-	RSSI            int          `json:"rssi"`
-	Longitude       int          `json:"longitude_i"`
-	Latitude        int          `json:"latitude_i"`
-	Alias           string       `json:"alias"`
-	MICType         string       `json:"mic_type"`
-	Feature         string       `json:"feature"`
-	MAC             string       `json:"mac"`
-	Updating        int          `json:"updating"`
-	LEDOff          int          `json:"led_off"`
-	Children        []childState `json:"children"`
-	ChildNum        int          `json:"child_num"`
-	ErrCode         int          `json:"err_code"`
+	SoftwareVersion string          `json:"sw_ver"`
+	HardwareVersion string          `json:"hw_ver"`
+	Model           string          `json:"model"`
+	DeviceID        string          `json:"deviceId"`
+	OEMID           string          `json:"oemId"`
+	HardwareID      string          `json:"hwId"`
+	RSSI            int             `json:"rssi"`
+	Longitude       int             `json:"longitude_i"`
+	Latitude        int             `json:"latitude_i"`
+	Alias           string          `json:"alias"`
+	MICType         string          `json:"mic_type"`
+	Type            string          `json:"type"`
+	DevName         string          `json:"dev_name"`
+	Feature         string          `json:"feature"`
+	MAC             string          `json:"mac"`
+	Updating        int             `json:"updating"`
+	LEDOff          int             `json:"led_off"`
+	RelayState      int             `json:"relay_state"`
+	OnTime          int             `json:"on_time"`
+	Children        []childState    `json:"children"`
+	ChildNum        int             `json:"child_num"`
+	Brightness      int             `json:"brightness"`
+	IsDimmable      int             `json:"is_dimmable"`
+	IsColor         int             `json:"is_color"`
+	IsVariableTemp  int             `json:"is_variable_color_temp"`
+	LightState      *lightState     `json:"light_state,omitempty"`
+	PreferredState  []LightPreset   `json:"preferred_state,omitempty"`
+	Length          int             `json:"length"`
+	EffectState     *LightingEffect `json:"lighting_effect_state,omitempty"`
+	// hardware 1.x HS110s give their location in degrees, instead of Longitude and Latitude
+	LongitudeV1 float64 `json:"longitude,omitempty"`
+	LatitudeV1  float64 `json:"latitude,omitempty"`
+	ErrCode     int     `json:"err_code"`
 }
 
 type systemResponse struct {
-	GetSysInfo *SystemInfo       `json:"get_sysinfo,omitempty"`
-	SetLED     *thingWithErrCode `json:"set_led_off,omitempty"`
+	GetSysInfo     *SystemInfo       `json:"get_sysinfo,omitempty"`
+	SetLED         *thingWithErrCode `json:"set_led_off,omitempty"`
+	SetDevAlias    *thingWithErrCode `json:"set_dev_alias,omitempty"`
+	SetDevLocation *thingWithErrCode `json:"set_dev_location,omitempty"`
+	DownloadFw     *thingWithErrCode `json:"download_firmware,omitempty"`
+	DownloadState  *downloadState    `json:"get_download_state,omitempty"`
+	FlashFw        *thingWithErrCode `json:"flash_firmware,omitempty"`
+	GetDevIcon     *deviceIcon       `json:"get_dev_icon,omitempty"`
+	SetDevIcon     *thingWithErrCode `json:"set_dev_icon,omitempty"`
+	thingWithErrCode
+}
+
+type deviceIcon struct {
+	Icon string `json:"icon"`
+	Hash string `json:"hash"`
+	thingWithErrCode
+}
+
+type downloadState struct {
+	Status     int `json:"status"`
+	Ratio      int `json:"ratio"`
+	RebootTime int `json:"reboot_time"`
+	FlashTime  int `json:"flash_time"`
+	thingWithErrCode
 }
 
 // KasaResponse is a wrapper object for JSON responses from KasaPlugs
 type KasaResponse struct {
 	System      *systemResponse `json:"system,omitempty"`
 	EnergyMeter *energyMeter    `json:"emeter,omitempty"`
+	Time        *timeModule     `json:"time,omitempty"`
+	NetIf       *netifModule    `json:"netif,omitempty"`
+	CnCloud     *cnCloudModule  `json:"cnCloud,omitempty"`
+	Schedule    *scheduleModule `json:"schedule,omitempty"`
+	// the bulbs keep their modules under longer names
+	LightingService *lightingService        `json:"smartlife.iot.smartbulb.lightingservice,omitempty"`
+	BulbEnergyMeter *energyMeter            `json:"smartlife.iot.common.emeter,omitempty"`
+	Dimmer          *dimmerModuleResponse   `json:"smartlife.iot.dimmer,omitempty"`
+	LightStrip      *lightingService        `json:"smartlife.iot.lightStrip,omitempty"`
+	LightingEffect  *lightingEffectResponse `json:"smartlife.iot.lighting_effect,omitempty"`
+	PIR             *pirModuleResponse      `json:"smartlife.iot.PIR,omitempty"`
+	LAS             *lasModuleResponse      `json:"smartlife.iot.LAS,omitempty"`
 }
 
 type energyMeter struct {
-	Realtime *realtimeEnergyMeter `json:"get_realtime"`
+	Realtime      *realtimeEnergyMeter `json:"get_realtime"`
+	VGainIGain    *emeterGains         `json:"get_vgain_igain,omitempty"`
+	SetVGainIGain *thingWithErrCode    `json:"set_vgain_igain,omitempty"`
+	DayStat       *statList            `json:"get_daystat,omitempty"`
+	MonthStat     *statList            `json:"get_monthstat,omitempty"`
+	thingWithErrCode
+}
+
+type scheduleModule struct {
+	DayStat   *statList `json:"get_daystat,omitempty"`
+	MonthStat *statList `json:"get_monthstat,omitempty"`
+	thingWithErrCode
+}
+
+// statList is what get_daystat and get_monthstat answer with, in the emeter and schedule modules both. Days only come
+// in day_list, months only in month_list.
+type statList struct {
+	DayList   []statEntry `json:"day_list,omitempty"`
+	MonthList []statEntry `json:"month_list,omitempty"`
+	thingWithErrCode
+}
+
+type statEntry struct {
+	Year  int `json:"year"`
+	Month int `json:"month"`
+	Day   int `json:"day,omitempty"`
+	// Time is minutes on, for the schedule module
+	Time int `json:"time,omitempty"`
+	// EnergyWh is for the emeter module, hardware 1.x HS110s give Energy in kWh instead
+	EnergyWh int     `json:"energy_wh,omitempty"`
+	Energy   float64 `json:"energy,omitempty"`
+}
+
+type emeterGains struct {
+	EMeterGains
+	thingWithErrCode
 }
 
 type realtimeEnergyMeter struct {
@@ -114,6 +198,71 @@ type realtimeEnergyMeter struct {
 	Current    int `json:"current_ma"`
 	Power      int `json:"power_mw"`
 	TotalWatts int `json:"total_wh"`
+	// hardware 1.x HS110s answer in these instead, see QuirkEmeterUnitsV1
+	VoltageV float64 `json:"voltage,omitempty"`
+	CurrentA float64 `json:"current,omitempty"`
+	PowerW   float64 `json:"power,omitempty"`
+	TotalKWh float64 `json:"total,omitempty"`
+	thingWithErrCode
+}
+
+type timeModule struct {
+	GetTime     *kasaTime         `json:"get_time,omitempty"`
+	GetTimezone *kasaTimezone     `json:"get_timezone,omitempty"`
+	SetTimezone *thingWithErrCode `json:"set_timezone,omitempty"`
+	thingWithErrCode
+}
+
+type kasaTime struct {
+	Year   int `json:"year"`
+	Month  int `json:"month"`
+	Day    int `json:"mday"`
+	Hour   int `json:"hour"`
+	Minute int `json:"min"`
+	Second int `json:"sec"`
+	thingWithErrCode
+}
+
+type kasaTimezone struct {
+	Index int `json:"index"`
+	thingWithErrCode
+}
+
+type netifModule struct {
+	GetScanInfo *scanInfo         `json:"get_scaninfo,omitempty"`
+	SetStaInfo  *thingWithErrCode `json:"set_stainfo,omitempty"`
+	thingWithErrCode
+}
+
+type scanInfo struct {
+	APList []AccessPoint `json:"ap_list"`
+	thingWithErrCode
+}
+
+type cnCloudModule struct {
+	GetInfo       *cloudInfo        `json:"get_info,omitempty"`
+	GetIntlFwList *firmwareList     `json:"get_intl_fw_list,omitempty"`
+	SetServerURL  *thingWithErrCode `json:"set_server_url,omitempty"`
+	Bind          *thingWithErrCode `json:"bind,omitempty"`
+	Unbind        *thingWithErrCode `json:"unbind,omitempty"`
+	thingWithErrCode
+}
+
+type cloudInfo struct {
+	Username      string `json:"username"`
+	Server        string `json:"server"`
+	Binded        int    `json:"binded"`
+	CldConnection int    `json:"cld_connection"`
+	IllegalType   int    `json:"illegalType"`
+	StopConnect   int    `json:"stopConnect"`
+	TCSPStatus    int    `json:"tcspStatus"`
+	FwDlPage      string `json:"fwDlPage"`
+	FwNotifyType  int    `json:"fwNotifyType"`
+	thingWithErrCode
+}
+
+type firmwareList struct {
+	FwList []FirmwareInfo `json:"fw_list"`
 	thingWithErrCode
 }
 
@@ -121,3 +270,122 @@ type thingWithErrCode struct {
 	ErrorCode    int    `json:"err_code,omitempty"`
 	ErrorMessage string `json:"err_msg,omitempty"`
 }
+
+type lightingService struct {
+	GetLightState        *lightState       `json:"get_light_state,omitempty"`
+	TransitionLightState *lightState       `json:"transition_light_state,omitempty"`
+	SetLightState        *lightState       `json:"set_light_state,omitempty"`
+	SetPreferredState    *thingWithErrCode `json:"set_preferred_state,omitempty"`
+	thingWithErrCode
+}
+
+type lightState struct {
+	OnOff      int    `json:"on_off"`
+	Mode       string `json:"mode,omitempty"`
+	Hue        int    `json:"hue"`
+	Saturation int    `json:"saturation"`
+	ColorTemp  int    `json:"color_temp"`
+	Brightness int    `json:"brightness"`
+	// DftOnState is what the bulb will come back on as, it's only there while the bulb is off
+	DftOnState *lightState `json:"dft_on_state,omitempty"`
+	thingWithErrCode
+}
+
+type dimmerModuleResponse struct {
+	GetDimmerParameters  *dimmerParameters `json:"get_dimmer_parameters,omitempty"`
+	GetDefaultBehavior   *dimmerBehavior   `json:"get_default_behavior,omitempty"`
+	SetBrightness        *thingWithErrCode `json:"set_brightness,omitempty"`
+	SetDimmerTransition  *thingWithErrCode `json:"set_dimmer_transition,omitempty"`
+	SetFadeOnTime        *thingWithErrCode `json:"set_fade_on_time,omitempty"`
+	SetFadeOffTime       *thingWithErrCode `json:"set_fade_off_time,omitempty"`
+	SetGentleOnTime      *thingWithErrCode `json:"set_gentle_on_time,omitempty"`
+	SetGentleOffTime     *thingWithErrCode `json:"set_gentle_off_time,omitempty"`
+	SetHardOnBehavior    *thingWithErrCode `json:"set_hard_on_behavior,omitempty"`
+	SetSoftOnBehavior    *thingWithErrCode `json:"set_soft_on_behavior,omitempty"`
+	SetLongPressBehavior *thingWithErrCode `json:"set_long_press_behavior,omitempty"`
+	SetDoubleClickAction *thingWithErrCode `json:"set_double_click_action,omitempty"`
+	thingWithErrCode
+}
+
+type dimmerParameters struct {
+	MinThreshold  int `json:"minThreshold"`
+	FadeOnTime    int `json:"fadeOnTime"`
+	FadeOffTime   int `json:"fadeOffTime"`
+	GentleOnTime  int `json:"gentleOnTime"`
+	GentleOffTime int `json:"gentleOffTime"`
+	RampRate      int `json:"rampRate"`
+	BulbType      int `json:"bulb_type"`
+	thingWithErrCode
+}
+
+type dimmerBehavior struct {
+	HardOn      *dimmerAction `json:"hard_on,omitempty"`
+	SoftOn      *dimmerAction `json:"soft_on,omitempty"`
+	LongPress   *dimmerAction `json:"long_press,omitempty"`
+	DoubleClick *dimmerAction `json:"double_click,omitempty"`
+	thingWithErrCode
+}
+
+type dimmerAction struct {
+	Mode  string `json:"mode"`
+	Index int    `json:"index,omitempty"`
+}
+
+type lightingEffectResponse struct {
+	GetLightingEffect *lightingEffectState `json:"get_lighting_effect,omitempty"`
+	SetLightingEffect *thingWithErrCode    `json:"set_lighting_effect,omitempty"`
+	thingWithErrCode
+}
+
+type lightingEffectState struct {
+	LightingEffect
+	thingWithErrCode
+}
+
+type pirModuleResponse struct {
+	GetConfig      *pirConfig        `json:"get_config,omitempty"`
+	GetADCValue    *sensorValue      `json:"get_adc_value,omitempty"`
+	SetEnable      *thingWithErrCode `json:"set_enable,omitempty"`
+	SetTriggerSens *thingWithErrCode `json:"set_trigger_sens,omitempty"`
+	SetColdTime    *thingWithErrCode `json:"set_cold_time,omitempty"`
+	thingWithErrCode
+}
+
+type pirConfig struct {
+	Enable       int    `json:"enable"`
+	Version      string `json:"version"`
+	TriggerIndex int    `json:"trigger_index"`
+	ColdTime     int    `json:"cold_time"`
+	MinADC       int    `json:"min_adc"`
+	MaxADC       int    `json:"max_adc"`
+	Array        []int  `json:"array"`
+	thingWithErrCode
+}
+
+type sensorValue struct {
+	Value int `json:"value"`
+	thingWithErrCode
+}
+
+type lasModuleResponse struct {
+	GetConfig     *lasConfig        `json:"get_config,omitempty"`
+	GetCurrentBrt *sensorValue      `json:"get_current_brt,omitempty"`
+	SetEnable     *thingWithErrCode `json:"set_enable,omitempty"`
+	SetBrtLevel   *thingWithErrCode `json:"set_brt_level,omitempty"`
+	thingWithErrCode
+}
+
+type lasConfig struct {
+	Version string      `json:"version"`
+	Devs    []lasDevice `json:"devs"`
+	thingWithErrCode
+}
+
+type lasDevice struct {
+	HardwareID string       `json:"hw_id"`
+	Enable     int          `json:"enable"`
+	DarkIndex  int          `json:"dark_index"`
+	MinADC     int          `json:"min_adc"`
+	MaxADC     int          `json:"max_adc"`
+	LevelArray []LightLevel `json:"level_array"`
+}
@@ -1,11 +1,15 @@
 package kasalink
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 )
 
 type unsafe struct {
+	kpp *KasaPowerPlug
 }
 
 // FactoryReset is the JSON used to issue a factory reset command to a Kasa API device
@@ -25,17 +29,17 @@ func (unsafe) SetDeviceMACString(newMAC string) (formatedJSON string, err error)
 
 // SetDeviceID takes a string and returns the JSON required to set the new Device ID
 func (unsafe) SetDeviceID(newDeviceID string) string {
-	return fmt.Sprintf("{\"system\":{\"set_device_id\":{\"deviceId\":\"%s\"}}}", newDeviceID)
+	return fmt.Sprintf("{\"system\":{\"set_device_id\":{\"deviceId\":%s}}}", jsonString(newDeviceID))
 }
 
 // SetHardwareID takes a string and returns the JSON required to set the new Hardware ID
 func (unsafe) SetHardwareID(newHardwareID string) string {
-	return fmt.Sprintf("{\"system\":{\"set_hw_id\":{\"hwId\":\"%s\"}}}", newHardwareID)
+	return fmt.Sprintf("{\"system\":{\"set_hw_id\":{\"hwId\":%s}}}", jsonString(newHardwareID))
 }
 
 //KasaBootloaderCheck is the JSON to perform a uBoot bootloader check
 func (unsafe) BootloaderCheck() string {
-	return `{"system":{"test_check_uboot":}}`
+	return `{"system":{"test_check_uboot":{}}}`
 }
 
 // Set Test Mode (command only accepted coming from IP 192.168.1.100)
@@ -45,7 +49,7 @@ func (unsafe) SetTestMode() string {
 
 // DownloadFirmaware returns the JSON to download firmware from a given URL
 func (unsafe) DownloadFirmaware(url string) string {
-	return fmt.Sprintf("{\"system\":{\"download_firmware\":{\"url\":\"%s\"}}}", url)
+	return fmt.Sprintf("{\"system\":{\"download_firmware\":{\"url\":%s}}}", jsonString(url))
 }
 
 // GetDownloadState is the JSON to get current download state
@@ -60,5 +64,123 @@ func (unsafe) FlashDownloadedFirmware() string {
 
 // CheckNewConfig is the JSON to check the current configuration of the device
 func (unsafe) CheckNewConfig() string {
-	return `{"system":{"check_new_config":}}`
+	return `{"system":{"check_new_config":{}}}`
+}
+
+// The Exec methods below actually send the unsafe commands. Every one of them wants a Confirmation naming the device
+// it's meant for, which gets checked against what the device says its ID is right before the command goes out.
+
+var (
+	// ErrNotConfirmed means the Confirmation didn't name the device the command was about to be sent to
+	ErrNotConfirmed = errors.New("unsafe command not confirmed for this device")
+	// ErrUnsafeDetached means the unsafe commands don't know which device to talk to, get your KasaPowerPlug from
+	// NewKasaPowerPlug
+	ErrUnsafeDetached = errors.New("unsafe commands aren't attached to a device")
+)
+
+// Confirmation is the per call token the unsafe commands want, DeviceID has to be the target device's ID
+type Confirmation struct {
+	DeviceID string
+}
+
+// UnsafeResult is what came back from an unsafe command
+type UnsafeResult struct {
+	// Action is the system method that was sent, like "reset" or "set_mac_addr"
+	Action   string
+	DeviceID string
+	// Response is the method's whole answer, for the commands that say more than an err_code
+	Response json.RawMessage
+}
+
+// ExecFactoryReset factory resets the device. It forgets its Wi-Fi, name, schedules and cloud account.
+func (u unsafe) ExecFactoryReset(ctx context.Context, confirm Confirmation) (*UnsafeResult, error) {
+	return u.exec(ctx, confirm, u.FactoryReset(), "reset")
+}
+
+// ExecSetDeviceMAC changes the device's MAC address
+func (u unsafe) ExecSetDeviceMAC(ctx context.Context, confirm Confirmation, newMAC string) (*UnsafeResult, error) {
+	var cmd, err = u.SetDeviceMACString(newMAC)
+	if err != nil {
+		return nil, err
+	}
+	return u.exec(ctx, confirm, cmd, "set_mac_addr")
+}
+
+// ExecSetDeviceID changes the device's ID. Confirm with the old one.
+func (u unsafe) ExecSetDeviceID(ctx context.Context, confirm Confirmation, newDeviceID string) (*UnsafeResult, error) {
+	var result, err = u.exec(ctx, confirm, u.SetDeviceID(newDeviceID), "set_device_id")
+	if err == nil {
+		// child IDs are built off the device ID, so keep up
+		u.kpp.deviceID = newDeviceID
+		u.kpp.SysInfo = nil
+	}
+	return result, err
+}
+
+// ExecSetHardwareID changes the device's hardware ID
+func (u unsafe) ExecSetHardwareID(ctx context.Context, confirm Confirmation, newHardwareID string) (*UnsafeResult, error) {
+	return u.exec(ctx, confirm, u.SetHardwareID(newHardwareID), "set_hw_id")
+}
+
+// ExecBootloaderCheck has the device check its uBoot bootloader, the answer is in the result's Response
+func (u unsafe) ExecBootloaderCheck(ctx context.Context, confirm Confirmation) (*UnsafeResult, error) {
+	return u.exec(ctx, confirm, u.BootloaderCheck(), "test_check_uboot")
+}
+
+// ExecSetTestMode puts the device in test mode, the device only takes this from 192.168.1.100
+func (u unsafe) ExecSetTestMode(ctx context.Context, confirm Confirmation) (*UnsafeResult, error) {
+	return u.exec(ctx, confirm, u.SetTestMode(), "set_test_mode")
+}
+
+// ExecCheckNewConfig has the device check its configuration, the answer is in the result's Response
+func (u unsafe) ExecCheckNewConfig(ctx context.Context, confirm Confirmation) (*UnsafeResult, error) {
+	return u.exec(ctx, confirm, u.CheckNewConfig(), "check_new_config")
+}
+
+// exec checks confirm against the device, logs what's about to happen, sends cmd and checks the answer to method
+func (u unsafe) exec(ctx context.Context, confirm Confirmation, cmd, method string) (*UnsafeResult, error) {
+	if u.kpp == nil {
+		return nil, ErrUnsafeDetached
+	}
+	var sysInfo, err = u.kpp.fetchSystemInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if confirm.DeviceID != sysInfo.DeviceID {
+		u.logf("Refused unsafe %s: confirmed for %q, but %s is %q", method, confirm.DeviceID,
+			u.kpp.plugNetworkLocation, sysInfo.DeviceID)
+		return nil, fmt.Errorf("%w: confirmed for %q, device is %q", ErrNotConfirmed, confirm.DeviceID,
+			sysInfo.DeviceID)
+	}
+	u.logf("Sending unsafe %s to %s (%s) at %s", method, sysInfo.Alias, sysInfo.DeviceID, u.kpp.plugNetworkLocation)
+
+	var jsonBytes []byte
+	if jsonBytes, err = u.kpp.talkToPlugContext(ctx, cmd); err != nil {
+		u.logf("Unsafe %s on %s failed: %s", method, sysInfo.DeviceID, err)
+		return nil, err
+	}
+	var response map[string]map[string]json.RawMessage
+	if err = json.Unmarshal(jsonBytes, &response); err != nil {
+		return nil, err
+	}
+	var result = &UnsafeResult{Action: method, DeviceID: sysInfo.DeviceID, Response: response["system"][method]}
+	if result.Response == nil {
+		return nil, errNoAnswer("system", method)
+	}
+	var answer thingWithErrCode
+	if err = json.Unmarshal(result.Response, &answer); err != nil {
+		return nil, err
+	}
+	if err = answer.err("system", method); err != nil {
+		u.logf("Unsafe %s on %s refused: %s", method, sysInfo.DeviceID, err)
+		return result, err
+	}
+	u.logf("Unsafe %s on %s done: %s", method, sysInfo.DeviceID, result.Response)
+	return result, nil
+}
+
+func (u unsafe) logf(format string, v ...interface{}) {
+	if u.kpp.log != nil {
+		u.kpp.log.Printf(format, v...)
+	}
 }
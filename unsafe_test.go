@@ -0,0 +1,41 @@
+package kasalink
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"testing"
+)
+
+func TestUnsafe_ExecSetDeviceMAC(t *testing.T) {
+	if !useMock {
+		t.Skip("not changing a real plug's MAC address from a test")
+	}
+	var mp, err = NewMockPlug()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mp.Close()
+	var kpp *KasaPowerPlug
+	if kpp, err = NewKasaPowerPlug(mp.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	kpp.SetLogger(log.New(os.Stderr, "unsafe: ", 0))
+	var ctx = context.Background()
+
+	if _, err = kpp.Unsafe.ExecSetDeviceMAC(ctx, Confirmation{DeviceID: "not-this-one"}, "B0:BE:76:80:14:AA"); !errors.Is(err, ErrNotConfirmed) {
+		t.Fatalf("expected ErrNotConfirmed, got %v", err)
+	}
+	var result *UnsafeResult
+	result, err = kpp.Unsafe.ExecSetDeviceMAC(ctx, Confirmation{DeviceID: kpp.SysInfo.DeviceID}, "B0:BE:76:80:14:AA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("%s: %s", result.Action, result.Response)
+
+	var detached KasaPowerPlug
+	if _, err = detached.Unsafe.ExecFactoryReset(ctx, Confirmation{}); err != ErrUnsafeDetached {
+		t.Fatalf("expected ErrUnsafeDetached, got %v", err)
+	}
+}
@@ -0,0 +1,146 @@
+package kasalink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// KeyType is the kind of Wi-Fi security an access point uses, as the netif module numbers them
+type KeyType int
+
+// The key types the netif module knows about. KeyTypeAuto isn't one of them, it tells JoinWiFi to go find out.
+const (
+	KeyTypeAuto KeyType = -1
+	KeyTypeNone KeyType = 0
+	KeyTypeWEP  KeyType = 1
+	KeyTypeWPA  KeyType = 2
+	KeyTypeWPA2 KeyType = 3
+)
+
+func (k KeyType) String() string {
+	switch k {
+	case KeyTypeAuto:
+		return "auto"
+	case KeyTypeNone:
+		return "none"
+	case KeyTypeWEP:
+		return "WEP"
+	case KeyTypeWPA:
+		return "WPA"
+	case KeyTypeWPA2:
+		return "WPA2"
+	default:
+		return fmt.Sprintf("KeyType(%d)", int(k))
+	}
+}
+
+// AccessPoint is a wireless network the device can see
+type AccessPoint struct {
+	SSID    string  `json:"ssid"`
+	KeyType KeyType `json:"key_type"`
+	RSSI    int     `json:"rssi,omitempty"`
+}
+
+const (
+	// wifiScanTimeout is how long the device gets to answer a scan, unless ctx runs out sooner. Devices take several
+	// seconds to scan, more than exchangeTimeout allows.
+	wifiScanTimeout = 15 * time.Second
+	// apDropTimeout is how long JoinWiFi waits for the device to leave its old network when ctx doesn't say
+	apDropTimeout = 30 * time.Second
+)
+
+var (
+	// ErrSSIDNotFound means the device couldn't see the network it was asked to join
+	ErrSSIDNotFound = errors.New("the device can't see that SSID")
+	// ErrStillOnNetwork means the device accepted new Wi-Fi settings, but it's still answering on its old network
+	ErrStillOnNetwork = errors.New("the device is still answering on its old network")
+)
+
+// ScanWiFi asks the device to scan for wireless access points and gives you back what it found
+func (kpp *KasaPowerPlug) ScanWiFi(ctx context.Context) ([]AccessPoint, error) {
+	var response, err = kpp.query(withExchangeTimeout(ctx, wifiScanTimeout), scanForAccessPoints)
+	if err != nil {
+		return nil, err
+	}
+	if response.NetIf == nil {
+		return nil, errNoAnswer("netif", "get_scaninfo")
+	}
+	if response.NetIf.GetScanInfo == nil {
+		return nil, response.NetIf.missing("netif", "get_scaninfo")
+	}
+	if err = response.NetIf.GetScanInfo.err("netif", "get_scaninfo"); err != nil {
+		return nil, err
+	}
+	return response.NetIf.GetScanInfo.APList, nil
+}
+
+// JoinWiFi tells the device to join a wireless network. With KeyTypeAuto the device scans first and the key type
+// comes from what the access point advertises. Once the device takes the new settings it drops whatever network it
+// was on (its own setup network for a fresh device), and JoinWiFi waits until it stops answering there, so a nil
+// error means the device really did go off to join ssid.
+func (kpp *KasaPowerPlug) JoinWiFi(ctx context.Context, ssid, pass string, keyType KeyType) error {
+	if keyType == KeyTypeAuto {
+		var aps, err = kpp.ScanWiFi(ctx)
+		if err != nil {
+			return err
+		}
+		for _, ap := range aps {
+			if ap.SSID == ssid {
+				keyType = ap.KeyType
+				break
+			}
+		}
+		if keyType == KeyTypeAuto {
+			return fmt.Errorf("%w: %s", ErrSSIDNotFound, ssid)
+		}
+	}
+	var response, err = kpp.query(ctx, fmt.Sprintf(joinWiFiFormatString, jsonString(ssid), jsonString(pass), keyType))
+	switch {
+	case err == nil:
+		if response.NetIf == nil {
+			return errNoAnswer("netif", "set_stainfo")
+		}
+		if response.NetIf.SetStaInfo == nil {
+			return response.NetIf.missing("netif", "set_stainfo")
+		}
+		if err = response.NetIf.SetStaInfo.err("netif", "set_stainfo"); err != nil {
+			return err
+		}
+	case errors.Is(err, io.EOF):
+		// some firmware drops the network before it gets around to answering
+	default:
+		return err
+	}
+	return kpp.waitForNetworkDrop(ctx)
+}
+
+// waitForNetworkDrop hangs up on the device and keeps trying to reach it again until it can't
+func (kpp *KasaPowerPlug) waitForNetworkDrop(ctx context.Context) error {
+	kpp.closer()
+	kpp.tplinkClient = nil
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, apDropTimeout)
+		defer cancel()
+	}
+	var dialer = net.Dialer{Timeout: time.Second}
+	for {
+		var conn, err = dialer.DialContext(ctx, "tcp", kpp.plugNetworkLocation)
+		if err != nil {
+			if ctx.Err() != nil {
+				return fmt.Errorf("%w: %s", ErrStillOnNetwork, kpp.plugNetworkLocation)
+			}
+			return nil
+		}
+		_ = conn.Close()
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %s", ErrStillOnNetwork, kpp.plugNetworkLocation)
+		case <-time.After(time.Second):
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package kasalink
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestKasaPowerPlug_ScanWiFi(t *testing.T) {
+	var (
+		kpp *KasaPowerPlug
+		aps []AccessPoint
+		err error
+	)
+	mockOrNot(&kpp, t)
+	aps, err = kpp.ScanWiFi(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("%+v", aps)
+	if useMock && (len(aps) != 2 || aps[0].KeyType != KeyTypeWPA2) {
+		t.Fatalf("unexpected scan results %+v", aps)
+	}
+}
+
+func TestKasaPowerPlug_JoinWiFi(t *testing.T) {
+	if !useMock {
+		t.Skip("not sending a real plug off to another network")
+	}
+	var mp, err = NewMockPlug()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kpp *KasaPowerPlug
+	if kpp, err = NewKasaPowerPlug(mp.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	var ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err = kpp.JoinWiFi(ctx, "NotThere", "hunter2", KeyTypeAuto); !errors.Is(err, ErrSSIDNotFound) {
+		t.Fatalf("expected ErrSSIDNotFound, got %v", err)
+	}
+	if err = kpp.JoinWiFi(ctx, "ReefNet", "hunter2", KeyTypeAuto); err != nil {
+		t.Fatal(err)
+	}
+}